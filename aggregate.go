@@ -0,0 +1,153 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Summary counts the reports that shared the same request signature over a period of time.
+type Summary struct {
+	Path, Method, Site, Mode string
+	// Count is the number of reports with this signature.
+	Count int
+	// First and Last are the times of the first and last report with this signature.
+	First, Last time.Time
+}
+
+// SummaryLogger is a type that can log Summaries.
+type SummaryLogger interface {
+	// LogSummary is called with every summary that needs to be logged.
+	// Implementations must not retain s after returning.
+	LogSummary(s *Summary)
+}
+
+// maxSignatures bounds the memory used by AggregatingLogger, as paths are chosen by clients.
+const maxSignatures = 10000
+
+type signature struct {
+	path, method, site, mode string
+}
+
+// AggregatingLogger is a ReportLogger and a RequestLogger that collapses reports with the same
+// path, method, site and mode into Summaries, which are periodically sent to a SummaryLogger.
+//
+// To bound memory usage, reports with new signatures are dropped and counted once 10000 distinct
+// signatures have been collected in a period. Close must be called to stop the periodic flushes.
+type AggregatingLogger struct {
+	sl      SummaryLogger
+	dropped atomic.Uint64
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	summary map[signature]*Summary
+	closed  bool
+}
+
+// NewAggregatingLogger returns an AggregatingLogger that sends summaries to sl every interval.
+func NewAggregatingLogger(sl SummaryLogger, interval time.Duration) *AggregatingLogger {
+	l := &AggregatingLogger{
+		sl:      sl,
+		done:    make(chan struct{}),
+		summary: make(map[signature]*Summary),
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				l.Flush()
+			case <-l.done:
+				return
+			}
+		}
+	}()
+	return l
+}
+
+// LogReport implements ReportLogger.
+func (l *AggregatingLogger) LogReport(rep *Report) {
+	sig := signature{path: rep.Path, method: rep.Method, site: rep.Site, mode: rep.Mode}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.summary[sig]
+	if !ok {
+		if len(l.summary) >= maxSignatures {
+			l.dropped.Add(1)
+			return
+		}
+		s = &Summary{Path: rep.Path, Method: rep.Method, Site: rep.Site, Mode: rep.Mode, First: rep.Time}
+		l.summary[sig] = s
+	}
+	s.Count++
+	s.Last = rep.Time
+}
+
+// LogRequest implements RequestLogger by converting r to a Report.
+func (l *AggregatingLogger) LogRequest(r *http.Request) {
+	LogRequestReport(l, r)
+}
+
+// Dropped returns the number of reports that were dropped because too many distinct signatures
+// were collected.
+func (l *AggregatingLogger) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Flush immediately sends the collected summaries, most frequent first, and starts a new period.
+func (l *AggregatingLogger) Flush() {
+	l.mu.Lock()
+	summary := l.summary
+	l.summary = make(map[signature]*Summary)
+	l.mu.Unlock()
+
+	ss := make([]*Summary, 0, len(summary))
+	for _, s := range summary {
+		ss = append(ss, s)
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].Count != ss[j].Count {
+			return ss[i].Count > ss[j].Count
+		}
+		return ss[i].First.Before(ss[j].First)
+	})
+	for _, s := range ss {
+		l.sl.LogSummary(s)
+	}
+}
+
+// Close stops the periodic flushes and flushes the collected summaries.
+// Close always returns nil.
+func (l *AggregatingLogger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mu.Unlock()
+	close(l.done)
+	l.wg.Wait()
+	l.Flush()
+	return nil
+}
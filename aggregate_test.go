@@ -0,0 +1,99 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type testSummaryLogger struct {
+	ss []Summary
+}
+
+func (t *testSummaryLogger) LogSummary(s *Summary) {
+	t.ss = append(t.ss, *s)
+}
+
+func TestAggregatingLogger(t *testing.T) {
+	var tl testSummaryLogger
+	// Use a long interval so that only explicit flushes happen during the test.
+	l := NewAggregatingLogger(&tl, time.Hour)
+	t0 := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	reps := []Report{
+		{Time: t0, Path: "/a", Method: "POST", Site: "cross-site", Mode: "cors"},
+		{Time: t0.Add(1 * time.Second), Path: "/b", Method: "POST", Site: "cross-site", Mode: "cors"},
+		{Time: t0.Add(2 * time.Second), Path: "/a", Method: "POST", Site: "cross-site", Mode: "cors"},
+		{Time: t0.Add(3 * time.Second), Path: "/a", Method: "POST", Site: "cross-site", Mode: "navigate"},
+		{Time: t0.Add(4 * time.Second), Path: "/a", Method: "POST", Site: "cross-site", Mode: "cors"},
+	}
+	for i := range reps {
+		l.LogReport(&reps[i])
+	}
+	l.Flush()
+	want := []Summary{
+		{Path: "/a", Method: "POST", Site: "cross-site", Mode: "cors", Count: 3, First: t0, Last: t0.Add(4 * time.Second)},
+		{Path: "/b", Method: "POST", Site: "cross-site", Mode: "cors", Count: 1, First: t0.Add(1 * time.Second), Last: t0.Add(1 * time.Second)},
+		{Path: "/a", Method: "POST", Site: "cross-site", Mode: "navigate", Count: 1, First: t0.Add(3 * time.Second), Last: t0.Add(3 * time.Second)},
+	}
+	if fmt.Sprint(tl.ss) != fmt.Sprint(want) {
+		t.Errorf("got summaries %+v, want %+v", tl.ss, want)
+	}
+
+	tl.ss = nil
+	l.LogReport(&reps[1])
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(tl.ss) != 1 || tl.ss[0].Path != "/b" || tl.ss[0].Count != 1 {
+		t.Errorf("Close: got summaries %+v, want one for /b", tl.ss)
+	}
+}
+
+func TestAggregatingLoggerMaxSignatures(t *testing.T) {
+	var tl testSummaryLogger
+	l := NewAggregatingLogger(&tl, time.Hour)
+	defer l.Close()
+	for i := 0; i < maxSignatures+10; i++ {
+		l.LogReport(&Report{Path: fmt.Sprintf("/%d", i)})
+	}
+	if got := l.Dropped(); got != 10 {
+		t.Errorf("got %d dropped reports, want 10", got)
+	}
+}
+
+func TestAggregatingLoggerInterval(t *testing.T) {
+	var tl testSummaryLogger
+	l := NewAggregatingLogger(&tl, time.Millisecond)
+	l.LogReport(&Report{Path: "/"})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		l.mu.Lock()
+		empty := len(l.summary) == 0
+		l.mu.Unlock()
+		if empty {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("summaries were not flushed periodically")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	l.Close()
+	if len(tl.ss) != 1 {
+		t.Errorf("got summaries %+v, want one", tl.ss)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+// forwardingHeaders are the request headers that commonly carry client IPs.
+var forwardingHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Real-Ip", "True-Client-Ip", "Cf-Connecting-Ip"}
+
+// AnonymizeReports makes the policy strip personal data from the Reports it sends and serves
+// with StatsHandler, and from the requests it passes to RequestLoggers, so that log-only mode
+// can be kept enabled in deployments subject to privacy regulations like the GDPR:
+//
+//   - client IPs are truncated to their /24 prefix for IPv4 and /48 prefix for IPv6, and
+//     ports are dropped;
+//   - the headers that commonly carry client IPs, like X-Forwarded-For, are removed;
+//   - User-Agent headers are reduced to their family, see UserAgentFamily;
+//   - the query and fragment of Referer headers are removed;
+//   - bodies captured by CaptureBody are dropped;
+//   - credentials are redacted as with RedactHeaders, which AnonymizeReports implies.
+//
+// Paths are reported unchanged, so applications must not put personal data in paths of
+// protected handlers, or exempt them.
+func AnonymizeReports() Option {
+	return func(p *Policy) {
+		RedactHeaders()(p)
+		p.anonymize = true
+		p.stats.anonymize = true
+	}
+}
+
+// anonymize strips personal data from rep, see AnonymizeReports.
+func (rep *Report) anonymize() {
+	rep.RemoteAddr = anonymizeAddr(rep.RemoteAddr)
+	rep.UserAgent = UserAgentFamily(rep.UserAgent)
+	if rep.Referer != "" {
+		rep.Referer = stripReferrer(rep.Referer)
+	}
+	rep.Body, rep.BodyTruncated = "", false
+}
+
+// anonymizeRequest strips personal data from r, which must be a copy, see AnonymizeReports.
+func anonymizeRequest(r *http.Request) {
+	r.RemoteAddr = anonymizeAddr(r.RemoteAddr)
+	for _, h := range forwardingHeaders {
+		r.Header.Del(h)
+	}
+	if ua := r.Header.Get("User-Agent"); ua != "" {
+		r.Header.Set("User-Agent", UserAgentFamily(ua))
+	}
+	if ref := r.Header.Get("Referer"); ref != "" {
+		r.Header.Set("Referer", stripReferrer(ref))
+	}
+	r.Body = http.NoBody
+	r.ContentLength = 0
+}
+
+// anonymizeAddr truncates the IP of the address addr, in the host:port format of
+// http.Request.RemoteAddr, to its /24 prefix for IPv4 and its /48 prefix for IPv6, and drops the
+// port. It returns "" if addr holds no IP.
+func anonymizeAddr(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+	ip = ip.Unmap().WithZone("")
+	bits := 48
+	if ip.Is4() {
+		bits = 24
+	}
+	prefix, _ := ip.Prefix(bits)
+	return prefix.Addr().String()
+}
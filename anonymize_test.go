@@ -0,0 +1,95 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizeAddr(t *testing.T) {
+	var tests = []struct {
+		addr, want string
+	}{
+		{"203.0.113.42:1234", "203.0.113.0"},
+		{"203.0.113.42", "203.0.113.0"},
+		{"[2001:db8:1234:5678::1]:443", "2001:db8:1234::"},
+		{"[fe80::1%eth0]:80", "fe80::"},
+		{"[::ffff:203.0.113.42]:80", "203.0.113.0"},
+		{"unix-socket", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := anonymizeAddr(tt.addr); got != tt.want {
+			t.Errorf("anonymizeAddr(%q): got %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestAnonymizeReports(t *testing.T) {
+	var tl testReportLogger
+	var rl testRequestLogger
+	p := ResourceIsolationPolicy(AnonymizeReports(), CaptureBody(100), ReportTo(&tl))
+	sh := p.StatsHandler()
+	var served *http.Request
+	h := p.ProtectLogOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = r
+	}), &rl)
+	r := httptest.NewRequest("POST", "/transfer", strings.NewReader("iban=XX00"))
+	r.RemoteAddr = "198.51.100.7:5555"
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	r.Header.Set("X-Forwarded-For", "192.0.2.1")
+	r.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0")
+	r.Header.Set("Referer", "https://evil.example/page?user=alice#top")
+	r.Header.Set("Cookie", "sid=1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	want := Report{RemoteAddr: "198.51.100.0", UserAgent: "firefox", Referer: "https://evil.example/page"}
+	check := func(name string, rep Report) {
+		t.Helper()
+		if rep.RemoteAddr != want.RemoteAddr || rep.UserAgent != want.UserAgent || rep.Referer != want.Referer || rep.Body != "" {
+			t.Errorf("%s: got %+v, want anonymized data %+v", name, rep, want)
+		}
+	}
+	if len(tl.reps) != 1 {
+		t.Fatalf("got %d reports, want 1", len(tl.reps))
+	}
+	check("report", tl.reps[0])
+
+	w := httptest.NewRecorder()
+	sh.ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	var stats struct{ Recent []Report }
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil || len(stats.Recent) != 1 {
+		t.Fatalf("got stats %s, %v, want one recent report", w.Body, err)
+	}
+	check("stats", stats.Recent[0])
+
+	if len(rl.rs) != 1 {
+		t.Fatalf("got %d logged requests, want 1", len(rl.rs))
+	}
+	lr := rl.rs[0]
+	var rep Report
+	rep.fill(lr, Decision{}, false)
+	check("logged request", rep)
+	if lr.Header.Get("X-Forwarded-For") != "" || lr.Header.Get("Cookie") != "REDACTED" || lr.Body != http.NoBody {
+		t.Errorf("logged request: got headers %v and body %v", lr.Header, lr.Body)
+	}
+	if served.RemoteAddr != r.RemoteAddr || served.Header.Get("X-Forwarded-For") == "" {
+		t.Errorf("served request was anonymized: %+v", served)
+	}
+}
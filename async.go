@@ -0,0 +1,104 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncLogger is a ReportLogger and a RequestLogger that hands reports over to another
+// ReportLogger on background goroutines, so slow loggers don't delay request handling.
+//
+// Reports are queued in a bounded buffer: when it is full new reports are dropped and counted.
+// Close must be called to flush the buffer and stop the background goroutines.
+type AsyncLogger struct {
+	rl      ReportLogger
+	queue   chan Report
+	wg      sync.WaitGroup
+	dropped atomic.Uint64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncLogger returns an AsyncLogger that buffers up to size reports and forwards them to rl
+// from the given number of worker goroutines. rl must be safe for concurrent use if workers is
+// greater than one.
+//
+// NewAsyncLogger panics if size is negative or workers is less than one.
+func NewAsyncLogger(rl ReportLogger, size, workers int) *AsyncLogger {
+	if size < 0 || workers < 1 {
+		panic("secfetch: invalid AsyncLogger size or workers")
+	}
+	l := &AsyncLogger{
+		rl:    rl,
+		queue: make(chan Report, size),
+	}
+	l.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go l.work()
+	}
+	return l
+}
+
+func (l *AsyncLogger) work() {
+	defer l.wg.Done()
+	for rep := range l.queue {
+		l.rl.LogReport(&rep)
+	}
+}
+
+// LogReport implements ReportLogger. It never blocks.
+func (l *AsyncLogger) LogReport(rep *Report) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		l.dropped.Add(1)
+		return
+	}
+	select {
+	case l.queue <- *rep:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// LogRequest implements RequestLogger by converting r to a Report. It never blocks.
+func (l *AsyncLogger) LogRequest(r *http.Request) {
+	LogRequestReport(l, r)
+}
+
+// Dropped returns the number of reports that were dropped because the buffer was full or the
+// logger was closed.
+func (l *AsyncLogger) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Close stops accepting reports and waits for the buffered ones to be logged.
+// Reports logged after Close are dropped. Close always returns nil.
+func (l *AsyncLogger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+	l.wg.Wait()
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type blockingReportLogger struct {
+	mu      sync.Mutex
+	unblock chan struct{}
+	reps    []Report
+}
+
+func (b *blockingReportLogger) LogReport(rep *Report) {
+	<-b.unblock
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reps = append(b.reps, *rep)
+}
+
+func TestAsyncLogger(t *testing.T) {
+	bl := &blockingReportLogger{unblock: make(chan struct{})}
+	l := NewAsyncLogger(bl, 2, 1)
+	h := ResourceIsolationPolicy(ReportTo(l)).
+		Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// The first report is picked up by the worker, which blocks, the next two fill the buffer
+	// and the remaining ones are dropped. None of the requests must block.
+	const reqs = 10
+	for i := 0; i < reqs; i++ {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("sec-fetch-site", "cross-site")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	close(bl.unblock)
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	logged, dropped := len(bl.reps), int(l.Dropped())
+	if logged+dropped != reqs {
+		t.Errorf("got %d logged and %d dropped reports, want %d in total", logged, dropped, reqs)
+	}
+	if logged < 2 || logged > 3 {
+		t.Errorf("got %d logged reports, want between 2 and 3", logged)
+	}
+	for _, rep := range bl.reps {
+		if rep.Rule != RuleCrossSiteMethod || !rep.Enforced {
+			t.Errorf("got report %+v", rep)
+		}
+	}
+
+	l.LogRequest(httptest.NewRequest("POST", "/", nil))
+	if got := int(l.Dropped()); got != dropped+1 {
+		t.Errorf("report after Close: got %d dropped reports, want %d", got, dropped+1)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
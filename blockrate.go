@@ -0,0 +1,156 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A BlockRateEvent describes the block rate of a policy crossing a threshold.
+type BlockRateEvent struct {
+	// Exceeded reports whether the rate rose to or above the threshold, as opposed to falling
+	// back below it.
+	Exceeded bool
+	// Rate is the fraction of requests rejected over Window, from 0 to 1.
+	Rate      float64
+	Threshold float64
+	Window    time.Duration
+	// Rejected and Total are the numbers of rejected and evaluated requests over Window.
+	// Rejected includes the requests that would have been rejected in log-only mode.
+	Rejected, Total uint64
+	Time            time.Time
+}
+
+// A BlockRateNotifier is notified when the rate of requests rejected by a policy crosses a
+// threshold, e.g. to page on-call engineers or to automatically roll back a policy change.
+type BlockRateNotifier interface {
+	// BlockRateCrossed is called synchronously while a request is evaluated, so it should not
+	// block. Calls are serialized, and alternate between events that exceed the threshold and
+	// events that fall back below it. When requests are evaluated concurrently, the event of a
+	// request may be notified after the rate was crossed again by another one, which is then
+	// notified once the next request is evaluated.
+	BlockRateCrossed(e BlockRateEvent)
+}
+
+// The BlockRateNotifierFunc type is an adapter to allow the use of ordinary functions as
+// BlockRateNotifiers.
+type BlockRateNotifierFunc func(e BlockRateEvent)
+
+// BlockRateCrossed calls f(e).
+func (f BlockRateNotifierFunc) BlockRateCrossed(e BlockRateEvent) {
+	f(e)
+}
+
+// AlertOnBlockRate makes the policy notify n when the fraction of rejected requests over the
+// last window rises to or above threshold, and again when it falls back below it. Requests that
+// would be rejected in log-only mode count as rejected, so this can be used to validate a policy
+// before enforcing it.
+//
+// The rate is computed as requests are evaluated, once at least minRequests were evaluated over
+// the window, so that a handful of requests can't trigger notifications. The window is tracked
+// with a granularity of a tenth of its duration.
+//
+// AlertOnBlockRate panics if threshold is not between 0 and 1 or if window is shorter than 10ns,
+// the shortest window that can be divided into tenths.
+func AlertOnBlockRate(threshold float64, window time.Duration, minRequests int, n BlockRateNotifier) Option {
+	if threshold <= 0 || threshold > 1 {
+		panic("secfetch: block rate threshold out of range")
+	}
+	if window < blockRateBuckets {
+		panic("secfetch: block rate window too short")
+	}
+	br := &blockRate{
+		threshold:   threshold,
+		window:      window,
+		minRequests: uint64(minRequests),
+		n:           n,
+		now:         time.Now,
+	}
+	return func(p *Policy) {
+		p.blockRates = append(p.blockRates, br)
+	}
+}
+
+// blockRateBuckets is the number of intervals a block rate window is divided into.
+const blockRateBuckets = 10
+
+// blockRate tracks the block rate of a policy against a threshold.
+//
+// Requests are counted with atomic operations, so counts may be slightly off when requests are
+// evaluated concurrently with a bucket being reset, which doesn't matter for alerting.
+type blockRate struct {
+	threshold   float64
+	window      time.Duration
+	minRequests uint64
+	n           BlockRateNotifier
+	now         func() time.Time
+
+	buckets [blockRateBuckets]rateBucket
+	// exceeded is only modified with mu held, which serializes notifications.
+	exceeded atomic.Bool
+	mu       sync.Mutex
+}
+
+type rateBucket struct {
+	// interval is the index of the interval counted by the bucket since the Unix epoch.
+	interval        atomic.Int64
+	rejected, total atomic.Uint64
+}
+
+func (br *blockRate) String() string {
+	return fmt.Sprintf("%g over %v", br.threshold, br.window)
+}
+
+// record counts an evaluated request and notifies the notifier if the threshold was crossed.
+func (br *blockRate) record(rejected bool) {
+	now := br.now()
+	iv := now.UnixNano() / int64(br.window/blockRateBuckets)
+	b := &br.buckets[iv%blockRateBuckets]
+	if old := b.interval.Load(); old != iv && b.interval.CompareAndSwap(old, iv) {
+		b.rejected.Store(0)
+		b.total.Store(0)
+	}
+	b.total.Add(1)
+	if rejected {
+		b.rejected.Add(1)
+	}
+	e := BlockRateEvent{Threshold: br.threshold, Window: br.window, Time: now}
+	for i := range br.buckets {
+		b := &br.buckets[i]
+		if iv-b.interval.Load() < blockRateBuckets {
+			e.Rejected += b.rejected.Load()
+			e.Total += b.total.Load()
+		}
+	}
+	if e.Total < br.minRequests {
+		return
+	}
+	e.Rejected = min(e.Rejected, e.Total)
+	e.Rate = float64(e.Rejected) / float64(e.Total)
+	e.Exceeded = e.Rate >= br.threshold
+	if e.Exceeded == br.exceeded.Load() {
+		return
+	}
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	// Another request may have crossed the threshold in the meantime.
+	if e.Exceeded != br.exceeded.Load() {
+		br.exceeded.Store(e.Exceeded)
+		br.n.BlockRateCrossed(e)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAlertOnBlockRate(t *testing.T) {
+	var events []BlockRateEvent
+	p := ResourceIsolationPolicy(AlertOnBlockRate(0.5, time.Minute, 4, BlockRateNotifierFunc(func(e BlockRateEvent) {
+		events = append(events, e)
+	})))
+	now := time.Unix(1000*60, 0)
+	p.blockRates[0].now = func() time.Time { return now }
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	send := func(h http.Handler, site string, n int) {
+		for i := 0; i < n; i++ {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", site)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}
+	}
+
+	// Below the minimum number of requests.
+	send(p.Protect(noop), "cross-site", 3)
+	if len(events) != 0 {
+		t.Fatalf("got events %+v before minimum requests", events)
+	}
+	send(p.ProtectLogOnly(noop, nil), "cross-site", 1)
+	want := BlockRateEvent{Exceeded: true, Rate: 1, Threshold: 0.5, Window: time.Minute, Rejected: 4, Total: 4, Time: now}
+	if len(events) != 1 || events[0] != want {
+		t.Fatalf("got events %+v, want %+v", events, want)
+	}
+
+	// Staying above the threshold doesn't notify again.
+	now = now.Add(30 * time.Second)
+	send(p.Protect(noop), "same-origin", 4)
+	if len(events) != 1 {
+		t.Fatalf("got events %+v, want one", events)
+	}
+	send(p.Protect(noop), "same-origin", 1)
+	want = BlockRateEvent{Rate: 4.0 / 9, Threshold: 0.5, Window: time.Minute, Rejected: 4, Total: 9, Time: now}
+	if len(events) != 2 || events[1] != want {
+		t.Fatalf("got events %+v, want second %+v", events, want)
+	}
+
+	// The rejected requests slide out of the window.
+	now = now.Add(40 * time.Second)
+	send(p.Protect(noop), "cross-site", 4)
+	if len(events) != 2 {
+		t.Fatalf("got events %+v, want two", events)
+	}
+	send(p.Protect(noop), "cross-site", 1)
+	want = BlockRateEvent{Exceeded: true, Rate: 0.5, Threshold: 0.5, Window: time.Minute, Rejected: 5, Total: 10, Time: now}
+	if len(events) != 3 || events[2] != want {
+		t.Fatalf("got events %+v, want third %+v", events, want)
+	}
+}
+
+func TestAlertOnBlockRatePanics(t *testing.T) {
+	n := BlockRateNotifierFunc(func(BlockRateEvent) {})
+	for _, tt := range []struct {
+		threshold float64
+		window    time.Duration
+	}{
+		{0, time.Minute},
+		{1.5, time.Minute},
+		{0.5, 0},
+		{0.5, -time.Minute},
+		{0.5, 9 * time.Nanosecond},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("AlertOnBlockRate(%v, %v) didn't panic", tt.threshold, tt.window)
+				}
+			}()
+			AlertOnBlockRate(tt.threshold, tt.window, 0, n)
+		}()
+	}
+}
+
+func TestAlertOnBlockRateConcurrent(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []BlockRateEvent
+	)
+	p := ResourceIsolationPolicy(AlertOnBlockRate(0.5, time.Minute, 1, BlockRateNotifierFunc(func(e BlockRateEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})))
+	h := p.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r := httptest.NewRequest("POST", "/", nil)
+				if (i+j)%2 == 0 {
+					r.Header.Set("sec-fetch-site", "cross-site")
+				}
+				h.ServeHTTP(httptest.NewRecorder(), r)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(events) == 0 {
+		t.Fatal("got no events")
+	}
+	for i, e := range events {
+		if e.Exceeded != (i%2 == 0) {
+			t.Fatalf("events don't alternate: %+v", events)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// CaptureBody makes the policy include up to n bytes of the body of rejected requests in
+// Reports, to investigate what would-be-blocked requests contained during a log-only rollout.
+// The captured bytes are read ahead from the body, which is left intact for the protected
+// handler.
+//
+// To avoid stalling on streaming requests, only bodies of known length are captured: requests
+// with chunked bodies and protocol upgrades are reported without a body. Bodies may contain
+// credentials and personal data, so reports must be handled accordingly. CaptureBody panics if
+// n is not positive.
+func CaptureBody(n int) Option {
+	if n <= 0 {
+		panic(fmt.Sprintf("secfetch: invalid body capture size %d", n))
+	}
+	return func(p *Policy) {
+		p.captureBody = n
+	}
+}
+
+// capturedBody is a request body whose first bytes were read ahead by CaptureBody.
+type capturedBody struct {
+	io.Reader
+	io.Closer
+	// prefix holds the bytes read ahead.
+	prefix []byte
+	// truncated reports whether the body is longer than prefix.
+	truncated bool
+}
+
+// captureRequestBody reads ahead the first bytes of the body of r, if it can be captured, and
+// restores it.
+func (p *Policy) captureRequestBody(r *http.Request) {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength <= 0 || r.Header.Get("Upgrade") != "" {
+		return
+	}
+	if _, ok := r.Body.(*capturedBody); ok {
+		return
+	}
+	n := min(int64(p.captureBody), r.ContentLength)
+	prefix := make([]byte, n)
+	// Errors, e.g. for bodies shorter than announced, are left for the handler to find, as the
+	// body is read again after the prefix.
+	read, _ := io.ReadFull(r.Body, prefix)
+	prefix = prefix[:read]
+	r.Body = &capturedBody{
+		Reader:    io.MultiReader(bytes.NewReader(prefix), r.Body),
+		Closer:    r.Body,
+		prefix:    prefix,
+		truncated: r.ContentLength > int64(read),
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCaptureBody(t *testing.T) {
+	const body = "name=alice&amount=100"
+	var tests = []struct {
+		name          string
+		site          string
+		chunked       bool
+		upgrade       bool
+		wantReport    bool
+		wantBody      string
+		wantTruncated bool
+	}{
+		{name: "truncated", site: "cross-site", wantReport: true, wantBody: "name=alice", wantTruncated: true},
+		{name: "chunked", site: "cross-site", chunked: true, wantReport: true},
+		{name: "upgrade", site: "cross-site", upgrade: true, wantReport: true},
+		{name: "allowed", site: "same-origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tl testReportLogger
+			var got string
+			h := ProtectHandlerLogOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("reading body: %v", err)
+				}
+				got = string(b)
+			}), nil, CaptureBody(10), ReportTo(&tl))
+			r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			if tt.upgrade {
+				r.Header.Set("Upgrade", "websocket")
+			}
+			r.Header.Set("Sec-Fetch-Site", tt.site)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != body {
+				t.Errorf("handler got body %q, want %q", got, body)
+			}
+			if !tt.wantReport {
+				if len(tl.reps) != 0 {
+					t.Errorf("got reports %+v, want none", tl.reps)
+				}
+				return
+			}
+			if len(tl.reps) != 1 {
+				t.Fatalf("got %d reports, want 1", len(tl.reps))
+			}
+			if rep := tl.reps[0]; rep.Body != tt.wantBody || rep.BodyTruncated != tt.wantTruncated {
+				t.Errorf("got body %q truncated %v, want %q truncated %v", rep.Body, rep.BodyTruncated, tt.wantBody, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestCaptureBodyShort(t *testing.T) {
+	var tl testReportLogger
+	p := ResourceIsolationPolicy(CaptureBody(100), ReportTo(&tl))
+	r := httptest.NewRequest("POST", "/", strings.NewReader("a=b"))
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	p.Evaluate(httptest.NewRecorder(), r)
+	if len(tl.reps) != 1 || tl.reps[0].Body != "a=b" || tl.reps[0].BodyTruncated {
+		t.Errorf("got reports %+v, want one with the whole body", tl.reps)
+	}
+}
+
+func TestCaptureBodyInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("CaptureBody(0) didn't panic")
+		}
+	}()
+	CaptureBody(0)
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import "net/http"
+
+// A Decider takes Decisions on requests. Policies are Deciders, and can be composed with All,
+// Any and Not to express requirements that a single Policy cannot, e.g. "resource isolation and
+// framing isolation, or internal clients":
+//
+//	d := secfetch.Any(
+//		secfetch.All(secfetch.ResourceIsolationPolicy(), secfetch.ResourceIsolationPolicy(secfetch.FramingIsolation())),
+//		internalNetwork,
+//	)
+//	if !d.Decide(r).Allowed {
+//		// Reject r.
+//	}
+type Decider interface {
+	// Decide evaluates r. It must be safe for concurrent use.
+	Decide(r *http.Request) Decision
+}
+
+// UseDecider makes the policy take decisions with d instead of its own rules, e.g. to protect
+// handlers with a composition of policies, or with fully custom logic. The rest of the policy
+// still applies: its mode, the response to rejected requests, reporting, metrics and hooks.
+//
+// Exemptions and routes are applied before d, which only decides the remaining requests:
+// requests exempted by ExemptPaths and the other exemption options, DynamicExemptions, or Exempt
+// are allowed with RuleExempt, and requests matching AllowCrossSite, DenyAll and Webhook are
+// decided by those rules. All the other options that take decisions, like
+// CrossSiteDestinations or the Block options, are replaced by d.
+//
+// The Rule and Allowed fields of the Decisions of d are used, while the Fetch Metadata fields
+// are always set from the request. d must not be the policy itself, or a Decider that calls it.
+func UseDecider(d Decider) Option {
+	return func(p *Policy) {
+		p.decider = d
+	}
+}
+
+// The DeciderFunc type is an adapter to allow the use of ordinary functions as Deciders.
+type DeciderFunc func(r *http.Request) Decision
+
+// Decide calls f(r).
+func (f DeciderFunc) Decide(r *http.Request) Decision {
+	return f(r)
+}
+
+// Decide implements Decider, it is equivalent to Check. It is the default Decider of policies,
+// see UseDecider.
+func (p *Policy) Decide(r *http.Request) Decision {
+	return p.Check(r)
+}
+
+// All returns a Decider that allows the requests allowed by every one of ds.
+//
+// ds are evaluated in order, and evaluation stops at the first one that rejects the request:
+// its Decision is returned. If all of ds allow the request, the Decision of the last one is
+// returned. All panics if ds is empty.
+func All(ds ...Decider) Decider {
+	if len(ds) == 0 {
+		panic("secfetch: All called without Deciders")
+	}
+	return DeciderFunc(func(r *http.Request) Decision {
+		var d Decision
+		for _, dd := range ds {
+			if d = dd.Decide(r); !d.Allowed {
+				return d
+			}
+		}
+		return d
+	})
+}
+
+// Any returns a Decider that allows the requests allowed by at least one of ds.
+//
+// ds are evaluated in order, and evaluation stops at the first one that allows the request: its
+// Decision is returned. If all of ds reject the request, the Decision of the last one is
+// returned. Any panics if ds is empty.
+func Any(ds ...Decider) Decider {
+	if len(ds) == 0 {
+		panic("secfetch: Any called without Deciders")
+	}
+	return DeciderFunc(func(r *http.Request) Decision {
+		var d Decision
+		for _, dd := range ds {
+			if d = dd.Decide(r); d.Allowed {
+				return d
+			}
+		}
+		return d
+	})
+}
+
+// Not returns a Decider that rejects the requests allowed by d, and vice versa. Decisions keep
+// the Rule reported by d, so for example a request rejected by Not(p) because p exempted it is
+// reported with RuleExempt.
+func Not(d Decider) Decider {
+	return DeciderFunc(func(r *http.Request) Decision {
+		dd := d.Decide(r)
+		dd.Allowed = !dd.Allowed
+		return dd
+	})
+}
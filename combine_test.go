@@ -0,0 +1,236 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCombinators(t *testing.T) {
+	resource := ResourceIsolationPolicy()
+	framing := ResourceIsolationPolicy(FramingIsolation(), CrossSiteDestinations("image", "iframe"))
+	// internal allows the requests from the 10.0.0.0/8 network.
+	internal := DeciderFunc(func(r *http.Request) Decision {
+		if strings.HasPrefix(r.RemoteAddr, "10.") {
+			return Decision{Allowed: true, Rule: RuleExempt}
+		}
+		return Decision{Rule: RuleCrossSiteMethod}
+	})
+	var tests = []struct {
+		name       string
+		d          Decider
+		method     string
+		remote     string
+		site, dest string
+		want       Decision
+	}{
+		{
+			name: "all allowed reports last",
+			d:    All(resource, framing),
+			site: "same-origin", dest: "iframe",
+			want: Decision{Allowed: true, Rule: RuleTrustedSite},
+		},
+		{
+			name: "all stops at first rejection",
+			d:    All(resource, framing),
+			site: "cross-site", dest: "iframe",
+			want: Decision{Rule: RuleCrossSiteDest},
+		},
+		{
+			name: "all rejected by second",
+			d:    All(framing, resource),
+			site: "cross-site", dest: "image",
+			want: Decision{Rule: RuleCrossSiteDest},
+		},
+		{
+			name: "any allowed by first",
+			d:    Any(framing, resource),
+			site: "cross-site", dest: "image",
+			want: Decision{Allowed: true, Rule: RuleCrossSiteSubresource},
+		},
+		{
+			name: "any rejected reports last",
+			d:    Any(resource, framing),
+			site: "cross-site", dest: "iframe",
+			want: Decision{Rule: RuleFraming},
+		},
+		{
+			name: "nested allowed by internal",
+			d:    Any(All(resource, framing), internal),
+			site: "cross-site", dest: "iframe", method: "POST", remote: "10.1.2.3:1234",
+			want: Decision{Allowed: true, Rule: RuleExempt},
+		},
+		{
+			name: "nested rejected",
+			d:    Any(All(resource, framing), internal),
+			site: "cross-site", dest: "iframe", method: "POST", remote: "192.0.2.1:1234",
+			want: Decision{Rule: RuleCrossSiteMethod},
+		},
+		{
+			name: "not",
+			d:    Not(resource),
+			site: "same-origin", dest: "empty",
+			want: Decision{Rule: RuleTrustedSite},
+		},
+		{
+			name: "not of rejected",
+			d:    All(Not(internal), resource),
+			site: "same-site", dest: "empty", remote: "192.0.2.1:1234",
+			want: Decision{Allowed: true, Rule: RuleTrustedSite},
+		},
+		{
+			name: "double negation",
+			d:    Not(Not(resource)),
+			site: "cross-site", dest: "empty", method: "POST",
+			want: Decision{Rule: RuleCrossSiteMethod},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			r := httptest.NewRequest(method, "/", nil)
+			if tt.remote != "" {
+				r.RemoteAddr = tt.remote
+			}
+			r.Header.Set("Sec-Fetch-Site", tt.site)
+			r.Header.Set("Sec-Fetch-Dest", tt.dest)
+			got := tt.d.Decide(r)
+			if got.Allowed != tt.want.Allowed || got.Rule != tt.want.Rule {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCombinatorsPanic(t *testing.T) {
+	for name, f := range map[string]func(...Decider) Decider{"All": All, "Any": Any} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s() didn't panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestUseDecider(t *testing.T) {
+	// The decider only allows requests for /public, regardless of their Fetch Metadata.
+	decider := DeciderFunc(func(r *http.Request) Decision {
+		if r.URL.Path == "/public" {
+			return Decision{Allowed: true, Rule: RuleExempt}
+		}
+		return Decision{Rule: RuleRouteDenied}
+	})
+	var (
+		tl  testReportLogger
+		got Decision
+	)
+	p := ResourceIsolationPolicy(
+		UseDecider(decider),
+		ReportTo(&tl),
+		OnAllow(func(r *http.Request, d Decision) { got = d }),
+		OnBlock(func(r *http.Request, d Decision, _ bool) { got = d }),
+	)
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var tests = []struct {
+		name, path  string
+		h           http.Handler
+		wantCode    int
+		wantRule    Rule
+		wantReports int
+	}{
+		{name: "allowed", path: "/public", h: p.Protect(noop), wantCode: http.StatusOK, wantRule: RuleExempt},
+		{name: "rejected", path: "/private", h: p.Protect(noop), wantCode: http.StatusForbidden, wantRule: RuleRouteDenied, wantReports: 1},
+		{name: "log-only", path: "/private", h: p.ProtectLogOnly(noop, nil), wantCode: http.StatusOK, wantRule: RuleRouteDenied, wantReports: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tl.reps, got = nil, Decision{}
+			r := httptest.NewRequest("GET", tt.path, nil)
+			r.Header.Set("Sec-Fetch-Site", "same-origin")
+			w := httptest.NewRecorder()
+			tt.h.ServeHTTP(w, r)
+			if w.Code != tt.wantCode {
+				t.Errorf("got code %d, want %d", w.Code, tt.wantCode)
+			}
+			if got.Rule != tt.wantRule || got.Site != "same-origin" {
+				t.Errorf("got decision %+v, want rule %v with Fetch Metadata", got, tt.wantRule)
+			}
+			if len(tl.reps) != tt.wantReports {
+				t.Errorf("got reports %+v, want %d", tl.reps, tt.wantReports)
+			}
+		})
+	}
+}
+
+func TestUseDeciderExemptionsAndRoutes(t *testing.T) {
+	// The decider rejects every request, so the requests it doesn't see are allowed or rejected by
+	// the other options.
+	rejectAll := DeciderFunc(func(r *http.Request) Decision {
+		return Decision{Rule: RuleRouteDenied}
+	})
+	var er ExemptionRegistry
+	er.AddExemption("/dynamic")
+	p := ResourceIsolationPolicy(
+		UseDecider(rejectAll),
+		ExemptPaths("/exempt"),
+		DynamicExemptions(&er),
+		AllowCrossSite("POST", "/cross-site"),
+		Webhook("/hook", func(r *http.Request, body []byte) bool { return r.Header.Get("X-Signature") == "ok" }),
+	)
+	var got Decision
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got, _ = FromContext(r.Context()) })
+	var tests = []struct {
+		name, path string
+		h          http.Handler
+		sig        string
+		wantCode   int
+		wantRule   Rule
+	}{
+		{name: "exempt path", path: "/exempt", h: p.Protect(noop), wantCode: http.StatusOK, wantRule: RuleExempt},
+		{name: "dynamic exemption", path: "/dynamic", h: p.Protect(noop), wantCode: http.StatusOK, wantRule: RuleExempt},
+		{name: "exempt handler", path: "/other", h: p.Protect(Exempt(noop)), wantCode: http.StatusOK, wantRule: RuleExempt},
+		{name: "route", path: "/cross-site", h: p.Protect(noop), wantCode: http.StatusOK, wantRule: RuleRouteAllowed},
+		{name: "webhook", path: "/hook", sig: "ok", h: p.Protect(noop), wantCode: http.StatusOK, wantRule: RuleWebhook},
+		{name: "unsigned webhook", path: "/hook", h: p.Protect(noop), wantCode: http.StatusForbidden},
+		{name: "decider", path: "/other", h: p.Protect(noop), wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = Decision{}
+			r := httptest.NewRequest("POST", tt.path, strings.NewReader("{}"))
+			r.Header.Set("Sec-Fetch-Site", "cross-site")
+			if tt.sig != "" {
+				r.Header.Set("X-Signature", tt.sig)
+			}
+			w := httptest.NewRecorder()
+			tt.h.ServeHTTP(w, r)
+			if w.Code != tt.wantCode {
+				t.Errorf("got code %d, want %d", w.Code, tt.wantCode)
+			}
+			if got.Rule != tt.wantRule {
+				t.Errorf("got rule %q, want %q", got.Rule, tt.wantRule)
+			}
+		})
+	}
+}
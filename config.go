@@ -0,0 +1,520 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Config is the declarative configuration of a Policy, which can be loaded from JSON or YAML
+// files with LoadPolicy. Field names in files are the snake_case versions of the Go ones, e.g.
+// "exempt_paths". The zero Config is the default ResourceIsolationPolicy.
+type Config struct {
+	// Mode is either "enforce", the default, "log-only", "disabled" or "off". See WithMode.
+	Mode string `json:"mode" yaml:"mode"`
+
+	// CrossSiteDestinations are added to the default destinations, see CrossSiteDestinations.
+	CrossSiteDestinations []string `json:"cross_site_destinations" yaml:"cross_site_destinations"`
+	// RequireUserActivation enables RequireUserActivation.
+	RequireUserActivation bool `json:"require_user_activation" yaml:"require_user_activation"`
+	// AllowedOrigins are passed to AllowOrigins.
+	AllowedOrigins []string `json:"allowed_origins" yaml:"allowed_origins"`
+	// AllowedRPCOrigins are passed to AllowRPCOrigins.
+	AllowedRPCOrigins []string `json:"allowed_rpc_origins" yaml:"allowed_rpc_origins"`
+	// AllowedWebSocketOrigins are passed to AllowWebSocketOrigins.
+	AllowedWebSocketOrigins []string `json:"allowed_websocket_origins" yaml:"allowed_websocket_origins"`
+	// AllowCORSPreflights enables AllowCORSPreflights.
+	AllowCORSPreflights bool `json:"allow_cors_preflights" yaml:"allow_cors_preflights"`
+	// FramingIsolation is either "off", the default, "cross-site" for FramingIsolation or
+	// "same-site" for SameSiteFramingIsolation.
+	FramingIsolation string `json:"framing_isolation" yaml:"framing_isolation"`
+	// FramingAllowedPaths are passed to AllowFramingPaths.
+	FramingAllowedPaths []string `json:"framing_allowed_paths" yaml:"framing_allowed_paths"`
+
+	// BlockImageHotlinking enables BlockImageHotlinking, without placeholder.
+	BlockImageHotlinking bool `json:"block_image_hotlinking" yaml:"block_image_hotlinking"`
+
+	// BlockScriptInclusion enables BlockScriptInclusion.
+	BlockScriptInclusion bool `json:"block_script_inclusion" yaml:"block_script_inclusion"`
+	// BlockEmbeddableDestinations enables BlockEmbeddableDestinations.
+	BlockEmbeddableDestinations bool `json:"block_embeddable_destinations" yaml:"block_embeddable_destinations"`
+	// BlockFencedFrames enables BlockFencedFrames.
+	BlockFencedFrames bool `json:"block_fenced_frames" yaml:"block_fenced_frames"`
+
+	// SameOriginOnly enables SameOriginOnly.
+	SameOriginOnly bool `json:"same_origin_only" yaml:"same_origin_only"`
+	// SameOriginOnlyPaths are passed to SameOriginOnlyPaths.
+	SameOriginOnlyPaths []string `json:"same_origin_only_paths" yaml:"same_origin_only_paths"`
+
+	// UntrustedSubdomains are passed to UntrustedSubdomains.
+	UntrustedSubdomains []string `json:"untrusted_subdomains" yaml:"untrusted_subdomains"`
+
+	// RejectMalformedMetadata enables RejectMalformedMetadata.
+	RejectMalformedMetadata bool `json:"reject_malformed_metadata" yaml:"reject_malformed_metadata"`
+	// Speculation is either "allow", the default, "deny", "mark" or "log-only". See Speculation.
+	Speculation string `json:"speculation" yaml:"speculation"`
+	// RejectMissingMetadata enables RejectMissingMetadata.
+	RejectMissingMetadata bool `json:"reject_missing_metadata" yaml:"reject_missing_metadata"`
+	// MissingMetadataPaths are passed to AllowMissingMetadataPaths.
+	MissingMetadataPaths []string `json:"missing_metadata_paths" yaml:"missing_metadata_paths"`
+	// MissingMetadataUserAgents are passed to AllowMissingMetadataUserAgents.
+	MissingMetadataUserAgents []string `json:"missing_metadata_user_agents" yaml:"missing_metadata_user_agents"`
+	// RefererFallback is either "off", the default, or "enforce" for RefererFallback.
+	RefererFallback string `json:"referer_fallback" yaml:"referer_fallback"`
+
+	// ExemptPaths are passed to ExemptPaths.
+	ExemptPaths []string `json:"exempt_paths" yaml:"exempt_paths"`
+	// ExemptHealthChecks enables ExemptHealthChecks, with HealthCheckPaths.
+	ExemptHealthChecks bool `json:"exempt_health_checks" yaml:"exempt_health_checks"`
+	// HealthCheckPaths are passed to ExemptHealthChecks.
+	HealthCheckPaths []string `json:"health_check_paths" yaml:"health_check_paths"`
+	// ExemptPathRegexps are compiled and passed to ExemptPathRegexps.
+	ExemptPathRegexps []string `json:"exempt_path_regexps" yaml:"exempt_path_regexps"`
+
+	// OAuthCallbackPaths are passed to OAuthCallback.
+	OAuthCallbackPaths []string `json:"oauth_callback_paths" yaml:"oauth_callback_paths"`
+	// SAMLACSPaths are passed to SAMLACS.
+	SAMLACSPaths []string `json:"saml_acs_paths" yaml:"saml_acs_paths"`
+	// ThreeDSecureCallbackPaths are passed to ThreeDSecureCallback.
+	ThreeDSecureCallbackPaths []string `json:"three_d_secure_callback_paths" yaml:"three_d_secure_callback_paths"`
+	// PaymentReturnPaths are passed to PaymentReturn.
+	PaymentReturnPaths []string `json:"payment_return_paths" yaml:"payment_return_paths"`
+	// StaticAssets are passed to AllowStaticAssets.
+	StaticAssets []string `json:"static_assets" yaml:"static_assets"`
+	// CrossSiteFontPaths are passed to AllowCrossSiteFonts.
+	CrossSiteFontPaths []string `json:"cross_site_font_paths" yaml:"cross_site_font_paths"`
+	// CrossSiteStylePaths are passed to AllowCrossSiteStyles.
+	CrossSiteStylePaths []string `json:"cross_site_style_paths" yaml:"cross_site_style_paths"`
+	// LoginPaths are passed to LoginEndpoints.
+	LoginPaths []string `json:"login_paths" yaml:"login_paths"`
+	// Routes are route rules, see RouteConfig.
+	Routes []RouteConfig `json:"routes" yaml:"routes"`
+
+	// Deny configures the response to rejected requests.
+	Deny DenyConfig `json:"deny" yaml:"deny"`
+	// DisableVary enables DisableVary.
+	DisableVary bool `json:"disable_vary" yaml:"disable_vary"`
+	// DebugHeader enables DebugHeader.
+	DebugHeader bool `json:"debug_header" yaml:"debug_header"`
+	// CorrelateRequests enables CorrelateRequests.
+	CorrelateRequests bool `json:"correlate_requests" yaml:"correlate_requests"`
+	// RedactHeaders enables RedactHeaders, with RedactedHeaders.
+	RedactHeaders bool `json:"redact_headers" yaml:"redact_headers"`
+	// RedactedHeaders are passed to RedactHeaders.
+	RedactedHeaders []string `json:"redacted_headers" yaml:"redacted_headers"`
+	// AnonymizeReports enables AnonymizeReports.
+	AnonymizeReports bool `json:"anonymize_reports" yaml:"anonymize_reports"`
+	// CaptureBody, if not zero, is passed to CaptureBody.
+	CaptureBody int `json:"capture_body" yaml:"capture_body"`
+	// EnforceCohort, if not nil, enables EnforceCohort, see CohortConfig.
+	EnforceCohort *CohortConfig `json:"enforce_cohort" yaml:"enforce_cohort"`
+}
+
+// CohortConfig configures EnforceCohort, see Config.
+type CohortConfig struct {
+	// Percent is the percentage of users the policy is enforced for.
+	Percent int `json:"percent" yaml:"percent"`
+	// Cookie is the name of the cookie identifying users, see CookieKey.
+	Cookie string `json:"cookie" yaml:"cookie"`
+}
+
+// RouteConfig configures a route rule, see Config.
+type RouteConfig struct {
+	// Action is either "allow-cross-site" for AllowCrossSite or "deny-all" for DenyAll.
+	Action string `json:"action" yaml:"action"`
+	// Method and Path are passed to the option selected by Action. Method is case-insensitive,
+	// empty or "*" match any method.
+	Method string `json:"method" yaml:"method"`
+	Path   string `json:"path" yaml:"path"`
+}
+
+// DenyConfig configures the response to rejected requests, see Config.
+type DenyConfig struct {
+	// Status, if not zero, is passed to DenyStatus.
+	Status int `json:"status" yaml:"status"`
+	// NotFound, if set, enables DenyNotFound with http.NotFoundHandler. It can't be used with
+	// Status.
+	NotFound bool `json:"not_found" yaml:"not_found"`
+	// Redirect, if not empty, is passed to DenyRedirect.
+	Redirect string `json:"redirect" yaml:"redirect"`
+	// JSON, if not nil, is passed to DenyJSON.
+	JSON interface{} `json:"json" yaml:"json"`
+	// Template, if not empty, is the path of an html/template file passed to DenyTemplate.
+	Template string `json:"template" yaml:"template"`
+	// Messages, if not empty, maps language tags to the messages passed to LocalizeDeny.
+	Messages map[string]string `json:"messages" yaml:"messages"`
+	// Tarpit, if not nil, enables Tarpit, see TarpitConfig.
+	Tarpit *TarpitConfig `json:"tarpit" yaml:"tarpit"`
+}
+
+// TarpitConfig configures Tarpit, see DenyConfig.
+type TarpitConfig struct {
+	// Min and Max are the bounds of the delay, in the format of time.ParseDuration, e.g. "500ms".
+	Min string `json:"min" yaml:"min"`
+	Max string `json:"max" yaml:"max"`
+	// MaxConcurrent is the maximum number of requests delayed at any time.
+	MaxConcurrent int `json:"max_concurrent" yaml:"max_concurrent"`
+}
+
+// Policy builds the Policy described by c, further configured with opts.
+func (c *Config) Policy(opts ...Option) (*Policy, error) {
+	var copts []Option
+	switch c.Mode {
+	case "", "enforce":
+	case "log-only":
+		copts = append(copts, WithMode(LogOnly))
+	case "disabled":
+		copts = append(copts, WithMode(Disabled))
+	case "off":
+		copts = append(copts, WithMode(Off))
+	default:
+		return nil, fmt.Errorf("secfetch: invalid mode %q", c.Mode)
+	}
+	if len(c.CrossSiteDestinations) > 0 {
+		copts = append(copts, CrossSiteDestinations(c.CrossSiteDestinations...))
+	}
+	if c.RequireUserActivation {
+		copts = append(copts, RequireUserActivation())
+	}
+	if len(c.AllowedOrigins) > 0 {
+		copts = append(copts, AllowOrigins(c.AllowedOrigins...))
+	}
+	if len(c.AllowedRPCOrigins) > 0 {
+		copts = append(copts, AllowRPCOrigins(c.AllowedRPCOrigins...))
+	}
+	if len(c.AllowedWebSocketOrigins) > 0 {
+		copts = append(copts, AllowWebSocketOrigins(c.AllowedWebSocketOrigins...))
+	}
+	if c.AllowCORSPreflights {
+		copts = append(copts, AllowCORSPreflights())
+	}
+	switch c.FramingIsolation {
+	case "", "off":
+	case "cross-site":
+		copts = append(copts, FramingIsolation())
+	case "same-site":
+		copts = append(copts, SameSiteFramingIsolation())
+	default:
+		return nil, fmt.Errorf("secfetch: invalid framing isolation %q", c.FramingIsolation)
+	}
+	if len(c.FramingAllowedPaths) > 0 {
+		if err := checkGlobs(c.FramingAllowedPaths); err != nil {
+			return nil, err
+		}
+		copts = append(copts, AllowFramingPaths(c.FramingAllowedPaths...))
+	}
+	if c.BlockImageHotlinking {
+		copts = append(copts, BlockImageHotlinking(nil))
+	}
+	if c.BlockScriptInclusion {
+		copts = append(copts, BlockScriptInclusion())
+	}
+	if c.BlockEmbeddableDestinations {
+		copts = append(copts, BlockEmbeddableDestinations())
+	}
+	if c.BlockFencedFrames {
+		copts = append(copts, BlockFencedFrames())
+	}
+	if c.SameOriginOnly {
+		copts = append(copts, SameOriginOnly())
+	}
+	if len(c.SameOriginOnlyPaths) > 0 {
+		if err := checkGlobs(c.SameOriginOnlyPaths); err != nil {
+			return nil, err
+		}
+		copts = append(copts, SameOriginOnlyPaths(c.SameOriginOnlyPaths...))
+	}
+	if len(c.UntrustedSubdomains) > 0 {
+		copts = append(copts, UntrustedSubdomains(c.UntrustedSubdomains...))
+	}
+	if c.RejectMalformedMetadata {
+		copts = append(copts, RejectMalformedMetadata())
+	}
+	switch c.Speculation {
+	case "", "allow":
+	case "deny":
+		copts = append(copts, Speculation(SpeculationDeny))
+	case "mark":
+		copts = append(copts, Speculation(SpeculationMark))
+	case "log-only":
+		copts = append(copts, Speculation(SpeculationLogOnly))
+	default:
+		return nil, fmt.Errorf("secfetch: invalid speculation %q", c.Speculation)
+	}
+	if c.RejectMissingMetadata {
+		copts = append(copts, RejectMissingMetadata())
+	}
+	if len(c.MissingMetadataPaths) > 0 {
+		copts = append(copts, AllowMissingMetadataPaths(c.MissingMetadataPaths...))
+	}
+	if len(c.MissingMetadataUserAgents) > 0 {
+		copts = append(copts, AllowMissingMetadataUserAgents(c.MissingMetadataUserAgents...))
+	}
+	switch c.RefererFallback {
+	case "", "off":
+	case "enforce":
+		copts = append(copts, RefererFallback())
+	default:
+		return nil, fmt.Errorf("secfetch: invalid referer fallback %q", c.RefererFallback)
+	}
+	if len(c.ExemptPaths) > 0 {
+		if err := checkGlobs(c.ExemptPaths); err != nil {
+			return nil, err
+		}
+		copts = append(copts, ExemptPaths(c.ExemptPaths...))
+	}
+	if c.ExemptHealthChecks {
+		if err := checkGlobs(c.HealthCheckPaths); err != nil {
+			return nil, err
+		}
+		copts = append(copts, ExemptHealthChecks(c.HealthCheckPaths...))
+	}
+	if len(c.ExemptPathRegexps) > 0 {
+		res := make([]*regexp.Regexp, 0, len(c.ExemptPathRegexps))
+		for _, expr := range c.ExemptPathRegexps {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("secfetch: %v", err)
+			}
+			res = append(res, re)
+		}
+		copts = append(copts, ExemptPathRegexps(res...))
+	}
+	if len(c.OAuthCallbackPaths) > 0 {
+		if err := checkGlobs(c.OAuthCallbackPaths); err != nil {
+			return nil, err
+		}
+		copts = append(copts, OAuthCallback(c.OAuthCallbackPaths...))
+	}
+	if len(c.SAMLACSPaths) > 0 {
+		if err := checkGlobs(c.SAMLACSPaths); err != nil {
+			return nil, err
+		}
+		copts = append(copts, SAMLACS(c.SAMLACSPaths...))
+	}
+	if len(c.ThreeDSecureCallbackPaths) > 0 {
+		if err := checkGlobs(c.ThreeDSecureCallbackPaths); err != nil {
+			return nil, err
+		}
+		copts = append(copts, ThreeDSecureCallback(c.ThreeDSecureCallbackPaths...))
+	}
+	if len(c.PaymentReturnPaths) > 0 {
+		if err := checkGlobs(c.PaymentReturnPaths); err != nil {
+			return nil, err
+		}
+		copts = append(copts, PaymentReturn(c.PaymentReturnPaths...))
+	}
+	if len(c.StaticAssets) > 0 {
+		copts = append(copts, AllowStaticAssets(c.StaticAssets...))
+	}
+	if len(c.CrossSiteFontPaths) > 0 {
+		copts = append(copts, AllowCrossSiteFonts(c.CrossSiteFontPaths...))
+	}
+	if len(c.CrossSiteStylePaths) > 0 {
+		copts = append(copts, AllowCrossSiteStyles(c.CrossSiteStylePaths...))
+	}
+	if len(c.LoginPaths) > 0 {
+		if err := checkGlobs(c.LoginPaths); err != nil {
+			return nil, err
+		}
+		copts = append(copts, LoginEndpoints(c.LoginPaths...))
+	}
+	for _, rc := range c.Routes {
+		if err := checkGlobs([]string{rc.Path}); err != nil {
+			return nil, err
+		}
+		rc.Method = strings.ToUpper(rc.Method)
+		if !validMethod(rc.Method) {
+			return nil, fmt.Errorf("secfetch: invalid route method %q", rc.Method)
+		}
+		switch rc.Action {
+		case "allow-cross-site":
+			copts = append(copts, AllowCrossSite(rc.Method, rc.Path))
+		case "deny-all":
+			copts = append(copts, DenyAll(rc.Method, rc.Path))
+		default:
+			return nil, fmt.Errorf("secfetch: invalid route action %q", rc.Action)
+		}
+	}
+	if c.Deny.Status != 0 {
+		if c.Deny.Status < 100 || c.Deny.Status > 999 {
+			return nil, fmt.Errorf("secfetch: invalid deny status %d", c.Deny.Status)
+		}
+		copts = append(copts, DenyStatus(c.Deny.Status))
+	}
+	if c.Deny.NotFound {
+		if c.Deny.Status != 0 {
+			return nil, fmt.Errorf("secfetch: deny status and not_found are mutually exclusive")
+		}
+		copts = append(copts, DenyNotFound(nil))
+	}
+	if c.Deny.Redirect != "" {
+		copts = append(copts, DenyRedirect(c.Deny.Redirect))
+	}
+	if c.Deny.JSON != nil {
+		if _, err := json.Marshal(c.Deny.JSON); err != nil {
+			return nil, fmt.Errorf("secfetch: invalid deny JSON: %v", err)
+		}
+		copts = append(copts, DenyJSON(c.Deny.JSON))
+	}
+	if c.Deny.Template != "" {
+		t, err := template.ParseFiles(c.Deny.Template)
+		if err != nil {
+			return nil, fmt.Errorf("secfetch: invalid deny template: %v", err)
+		}
+		copts = append(copts, DenyTemplate(t))
+	}
+	if tc := c.Deny.Tarpit; tc != nil {
+		lo, err := time.ParseDuration(tc.Min)
+		if err != nil {
+			return nil, fmt.Errorf("secfetch: invalid tarpit: %v", err)
+		}
+		hi, err := time.ParseDuration(tc.Max)
+		if err != nil {
+			return nil, fmt.Errorf("secfetch: invalid tarpit: %v", err)
+		}
+		if lo < 0 || hi < lo || tc.MaxConcurrent <= 0 {
+			return nil, fmt.Errorf("secfetch: invalid tarpit %v-%v with %d concurrent requests", lo, hi, tc.MaxConcurrent)
+		}
+		copts = append(copts, Tarpit(lo, hi, tc.MaxConcurrent))
+	}
+	if len(c.Deny.Messages) > 0 {
+		copts = append(copts, LocalizeDeny(Messages(c.Deny.Messages)))
+	}
+	if c.DisableVary {
+		copts = append(copts, DisableVary())
+	}
+	if c.DebugHeader {
+		copts = append(copts, DebugHeader())
+	}
+	if c.CorrelateRequests {
+		copts = append(copts, CorrelateRequests())
+	}
+	if c.RedactHeaders {
+		copts = append(copts, RedactHeaders(c.RedactedHeaders...))
+	}
+	if c.AnonymizeReports {
+		copts = append(copts, AnonymizeReports())
+	}
+	if c.CaptureBody != 0 {
+		if c.CaptureBody < 0 {
+			return nil, fmt.Errorf("secfetch: invalid body capture size %d", c.CaptureBody)
+		}
+		copts = append(copts, CaptureBody(c.CaptureBody))
+	}
+	if ec := c.EnforceCohort; ec != nil {
+		if ec.Percent < 0 || ec.Percent > 100 {
+			return nil, fmt.Errorf("secfetch: invalid cohort percentage %d", ec.Percent)
+		}
+		if ec.Cookie == "" {
+			return nil, fmt.Errorf("secfetch: missing cohort cookie")
+		}
+		copts = append(copts, EnforceCohort(ec.Percent, CookieKey(ec.Cookie)))
+	}
+	return ResourceIsolationPolicy(append(copts, opts...)...), nil
+}
+
+// checkGlobs returns an error if any of the path patterns accepted by ExemptPaths is malformed.
+func checkGlobs(patterns []string) error {
+	for _, pat := range patterns {
+		if _, err := compileGlob(pat); err != nil {
+			return fmt.Errorf("secfetch: malformed path pattern %q: %v", pat, err)
+		}
+	}
+	return nil
+}
+
+// validMethod reports whether method is empty, "*" or a valid HTTP method token.
+func validMethod(method string) bool {
+	if method == "" || method == "*" {
+		return true
+	}
+	for _, c := range method {
+		if c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// ParseConfig parses a Config from data, in JSON if format is "json" or in YAML if format is
+// "yaml". Unknown fields are rejected, to catch typos in security-relevant settings. Empty
+// documents are parsed as the zero Config, data following the first document is rejected.
+func ParseConfig(data []byte, format string) (*Config, error) {
+	var c Config
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("secfetch: cannot parse config: %v", err)
+		}
+		var rest json.RawMessage
+		if err := dec.Decode(&rest); err != io.EOF {
+			return nil, fmt.Errorf("secfetch: cannot parse config: unexpected data after the first document")
+		}
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&c); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("secfetch: cannot parse config: %v", err)
+		}
+		var rest yaml.Node
+		if err := dec.Decode(&rest); err != io.EOF {
+			return nil, fmt.Errorf("secfetch: cannot parse config: unexpected data after the first document")
+		}
+	default:
+		return nil, fmt.Errorf("secfetch: unknown config format %q", format)
+	}
+	return &c, nil
+}
+
+// LoadPolicy builds a Policy from the configuration file at path, further configured with opts,
+// which can be used to set what cannot be expressed in a file, like loggers and handlers.
+//
+// Files with the .json extension are parsed as JSON, files with the .yaml or .yml extension
+// as YAML. See Config for the schema.
+func LoadPolicy(path string, opts ...Option) (*Policy, error) {
+	var format string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		format = "json"
+	case ".yaml", ".yml":
+		format = "yaml"
+	default:
+		return nil, fmt.Errorf("secfetch: unknown config file extension %q", filepath.Ext(path))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ParseConfig(data, format)
+	if err != nil {
+		return nil, err
+	}
+	return c.Policy(opts...)
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testYAMLConfig = `
+mode: enforce
+cross_site_destinations: [document]
+exempt_paths: ["/public/**"]
+routes:
+  - {action: allow-cross-site, method: post, path: "/webhooks/*"}
+deny:
+  status: 404
+`
+
+const testJSONConfig = `{
+	"mode": "log-only",
+	"allowed_origins": ["https://partner.example"],
+	"debug_header": true
+}`
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var tests = []struct {
+		name       string
+		file       string
+		path       string
+		site       string
+		origin     string
+		want       int
+		wantHeader string
+	}{
+		{name: "yaml rejected", file: write("p.yaml", testYAMLConfig), path: "/", site: "cross-site", want: http.StatusNotFound},
+		{name: "yaml exempt", file: write("p.yml", testYAMLConfig), path: "/public/a/b", site: "cross-site", want: http.StatusOK},
+		{name: "yaml route", file: write("p.yml", testYAMLConfig), path: "/webhooks/github", site: "cross-site", want: http.StatusOK},
+		{name: "json log only", file: write("p.json", testJSONConfig), path: "/", site: "cross-site", want: http.StatusOK, wantHeader: "would-block; rule=cross-site-method"},
+		{name: "json allowed origin", file: write("p.json", testJSONConfig), path: "/", site: "cross-site", origin: "https://partner.example", want: http.StatusOK, wantHeader: "allowed; rule=allowed-origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := LoadPolicy(tt.file)
+			if err != nil {
+				t.Fatalf("LoadPolicy: %v", err)
+			}
+			r := httptest.NewRequest("POST", tt.path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			if tt.origin != "" {
+				r.Header.Set("origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			p.Protect(noop).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("X-SecFetch-Decision"); got != tt.wantHeader {
+				t.Errorf("got decision header %q, want %q", got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	dir := t.TempDir()
+	var tests = []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{name: "extension", file: "p.toml", content: "", wantErr: "extension"},
+		{name: "unknown json field", file: "p.json", content: `{"mdoe": "enforce"}`, wantErr: "mdoe"},
+		{name: "unknown yaml field", file: "p.yaml", content: "mdoe: enforce", wantErr: "mdoe"},
+		{name: "mode", file: "p.json", content: `{"mode": "bogus"}`, wantErr: "invalid mode"},
+		{name: "cohort percent", file: "p.json", content: `{"enforce_cohort": {"percent": 120, "cookie": "s"}}`, wantErr: "invalid cohort"},
+		{name: "cohort cookie", file: "p.yaml", content: "enforce_cohort: {percent: 10}", wantErr: "missing cohort cookie"},
+		{name: "framing", file: "p.json", content: `{"framing_isolation": "always"}`, wantErr: "invalid framing"},
+		{name: "referer", file: "p.json", content: `{"referer_fallback": "yes"}`, wantErr: "invalid referer"},
+		{name: "glob", file: "p.json", content: `{"exempt_paths": ["/[a"]}`, wantErr: "malformed path pattern"},
+		{name: "route action", file: "p.yaml", content: "routes: [{action: allow, path: /}]", wantErr: "invalid route action"},
+		{name: "route method", file: "p.yaml", content: "routes: [{action: deny-all, method: 'GET /', path: /}]", wantErr: "invalid route method"},
+		{name: "json trailing data", file: "p.json", content: `{"mode": "log-only"} {"mode": "off"}`, wantErr: "unexpected data"},
+		{name: "yaml trailing document", file: "p.yaml", content: "mode: log-only\n---\nmode: off\n", wantErr: "unexpected data"},
+		{name: "route glob", file: "p.yaml", content: "routes: [{action: deny-all, path: '/[a'}]", wantErr: "malformed path pattern"},
+		{name: "regexp", file: "p.json", content: `{"exempt_path_regexps": ["("]}`, wantErr: "missing closing"},
+		{name: "status", file: "p.yaml", content: "deny: {status: 42}", wantErr: "invalid deny status"},
+		{name: "not found", file: "p.yaml", content: "deny: {status: 404, not_found: true}", wantErr: "mutually exclusive"},
+		{name: "tarpit duration", file: "p.yaml", content: "deny: {tarpit: {min: 1x, max: 2s, max_concurrent: 1}}", wantErr: "invalid tarpit"},
+		{name: "tarpit bounds", file: "p.yaml", content: "deny: {tarpit: {min: 2s, max: 1s, max_concurrent: 1}}", wantErr: "invalid tarpit"},
+		{name: "capture body", file: "p.json", content: `{"capture_body": -1}`, wantErr: "invalid body capture"},
+		{name: "template", file: "p.yaml", content: "deny: {template: missing.html}", wantErr: "invalid deny template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(p, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadPolicy(p)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := LoadPolicy(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("missing file: got no error")
+	}
+}
+
+func TestLoadPolicyEmpty(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"p.json", "p.yaml"} {
+		for _, content := range []string{"", "\n"} {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			p, err := LoadPolicy(path)
+			if err != nil {
+				t.Errorf("%s %q: %v", name, content, err)
+				continue
+			}
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("Sec-Fetch-Site", "cross-site")
+			if p.Allowed(r) {
+				t.Errorf("%s %q: the policy is not the default one", name, content)
+			}
+		}
+	}
+}
+
+func TestConfigPolicyOptions(t *testing.T) {
+	c := &Config{Deny: DenyConfig{JSON: map[string]interface{}{"error": "nope"}}}
+	p, err := c.Policy(DenyStatus(http.StatusTeapot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("sec-fetch-site", "cross-site")
+	w := httptest.NewRecorder()
+	p.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("options are not applied after the config: got status %d, want %d", w.Code, http.StatusTeapot)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"net/http"
+)
+
+type decisionKey struct{}
+
+// decisionContext carries a Decision. It is used instead of context.WithValue so that storing a
+// Decision takes a single allocation, and reading it none.
+type decisionContext struct {
+	context.Context
+	d Decision
+}
+
+func (c *decisionContext) Value(key interface{}) interface{} {
+	if key == (decisionKey{}) {
+		return &c.d
+	}
+	return c.Context.Value(key)
+}
+
+// FromContext returns the Decision taken for the request ctx belongs to, and whether one was
+// taken at all.
+//
+// Decisions are stored by the handlers returned by Protect and ProtectLogOnly, so they can be
+// read by the handlers they wrap and by deny handlers.
+func FromContext(ctx context.Context) (Decision, bool) {
+	d, ok := ctx.Value(decisionKey{}).(*Decision)
+	if !ok {
+		return Decision{}, false
+	}
+	return *d, true
+}
+
+// DisableDecisionContext stops Protect and ProtectLogOnly from storing the Decision of allowed
+// requests in their context, which copies every request. FromContext then only finds the
+// Decisions of rejected requests, e.g. in deny handlers and log-only handlers. It should only be
+// used when neither the protected handlers, nor adapters and loggers, read the Decisions of
+// allowed requests.
+func DisableDecisionContext() Option {
+	return func(p *Policy) {
+		p.noDecisionContext = true
+	}
+}
+
+// NewContext returns a copy of ctx that carries d.
+func NewContext(ctx context.Context, d Decision) context.Context {
+	return &decisionContext{Context: ctx, d: d}
+}
+
+func withDecision(r *http.Request, d Decision) *http.Request {
+	return r.WithContext(NewContext(r.Context(), d))
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Errorf("FromContext: got a decision from an empty context")
+	}
+	var got []Decision
+	record := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, ok := FromContext(r.Context())
+		if !ok {
+			t.Errorf("no decision found in the request context")
+		}
+		got = append(got, d)
+	})
+	p := ResourceIsolationPolicy(DenyHandler(record))
+	var tl testRequestLogger
+	handlers := map[string]http.Handler{
+		"Protect":        p.Protect(record),
+		"ProtectLogOnly": p.ProtectLogOnly(record, &tl),
+	}
+	for name, h := range handlers {
+		for _, tt := range checkTests {
+			t.Run(name+" "+tt.name, func(t *testing.T) {
+				got = nil
+				defer tl.reset()
+				r := httptest.NewRequest(tt.method, "/", nil)
+				r.Header.Set("sec-fetch-site", tt.site)
+				r.Header.Set("sec-fetch-mode", tt.mode)
+				r.Header.Set("sec-fetch-dest", tt.dest)
+				h.ServeHTTP(httptest.NewRecorder(), r)
+				want := p.Check(r)
+				if len(got) != 1 || got[0] != want {
+					t.Errorf("got %+v, want [%+v]", got, want)
+				}
+				if len(tl.rs) == 0 {
+					return
+				}
+				if d, _ := FromContext(tl.rs[0].Context()); d != want {
+					t.Errorf("logged request: got %+v, want %+v", d, want)
+				}
+			})
+		}
+	}
+}
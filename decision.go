@@ -0,0 +1,215 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import "net/http"
+
+// A Rule identifies the part of a Policy that determined a Decision.
+type Rule string
+
+// Rules reported in Decisions.
+const (
+	// RuleExempt is reported for requests exempted from the policy, e.g. by ExemptPaths.
+	RuleExempt Rule = "exempt"
+	// RuleImageHotlink is reported for cross-site image requests rejected by
+	// BlockImageHotlinking.
+	RuleImageHotlink Rule = "image-hotlink"
+	// RuleScriptInclusion is reported for cross-site script requests rejected by
+	// BlockScriptInclusion.
+	RuleScriptInclusion Rule = "script-inclusion"
+	// RuleEmbeddableDestination is reported for the object and embed requests rejected by
+	// BlockEmbeddableDestinations.
+	RuleEmbeddableDestination Rule = "embeddable-destination"
+	// RuleFencedFrame is reported for the cross-site fenced frame requests rejected by
+	// BlockFencedFrames.
+	RuleFencedFrame Rule = "fenced-frame"
+	// RuleRouteAllowed is reported for requests allowed by AllowCrossSite.
+	RuleRouteAllowed Rule = "route-allowed"
+	// RuleRouteDenied is reported for requests rejected by DenyAll.
+	RuleRouteDenied Rule = "route-denied"
+	// RuleOAuthCallback is reported for the identity provider requests allowed by OAuthCallback.
+	RuleOAuthCallback Rule = "oauth-callback"
+	// RuleSAMLACS is reported for the identity provider requests allowed by SAMLACS.
+	RuleSAMLACS Rule = "saml-acs"
+	// RuleThreeDSecure is reported for the 3-D Secure requests allowed by ThreeDSecureCallback.
+	RuleThreeDSecure Rule = "3ds-callback"
+	// RulePaymentReturn is reported for the payment requests allowed by PaymentReturn.
+	RulePaymentReturn Rule = "payment-return"
+	// RuleStaticAsset is reported for the requests for static assets allowed by
+	// AllowStaticAssets.
+	RuleStaticAsset Rule = "static-asset"
+	// RuleCrossSiteFont is reported for the cross-site font requests allowed by
+	// AllowCrossSiteFonts.
+	RuleCrossSiteFont Rule = "cross-site-font"
+	// RuleCrossSiteStyle is reported for the cross-site stylesheet requests allowed by
+	// AllowCrossSiteStyles.
+	RuleCrossSiteStyle Rule = "cross-site-style"
+	// RuleLoginEndpoint is reported for the login requests rejected by LoginEndpoints.
+	RuleLoginEndpoint Rule = "login-endpoint"
+	// RuleWebhook is reported for webhook requests whose signature was verified, see Webhook.
+	RuleWebhook Rule = "webhook"
+	// RuleWebhookSignature is reported for webhook requests whose signature could not be
+	// verified, see Webhook.
+	RuleWebhookSignature Rule = "webhook-signature"
+	// RuleMissingMetadata is reported for requests without Fetch Metadata, which are
+	// rejected by RejectMissingMetadata and allowed otherwise.
+	RuleMissingMetadata Rule = "missing-metadata"
+	// RuleMalformedMetadata is reported for requests rejected by RejectMalformedMetadata.
+	RuleMalformedMetadata Rule = "malformed-metadata"
+	// RuleSpeculative is reported for the speculative requests rejected by Speculation.
+	RuleSpeculative Rule = "speculative"
+	// RuleRefererCrossSite is reported for requests rejected by RefererFallback.
+	RuleRefererCrossSite Rule = "referer-cross-site"
+	// RuleFraming is reported for requests rejected by FramingIsolation or
+	// SameSiteFramingIsolation.
+	RuleFraming Rule = "framing"
+	// RuleTrustedSite is reported for same-origin, same-site and user-initiated requests.
+	// Same-site requests are not trusted with SameOriginOnly, SameOriginOnlyPaths or
+	// UntrustedSubdomains.
+	RuleTrustedSite Rule = "trusted-site"
+	// RuleAllowedOrigin is reported for cross-site requests allowed by AllowOrigins or
+	// AllowOriginFunc.
+	RuleAllowedOrigin Rule = "allowed-origin"
+	// RuleRPCOrigin is reported for cross-site gRPC-Web and Connect calls allowed by
+	// AllowRPCOrigins.
+	RuleRPCOrigin Rule = "rpc-origin"
+	// RuleWebSocketOrigin is reported for WebSocket upgrades checked by AllowWebSocketOrigins.
+	RuleWebSocketOrigin Rule = "websocket-origin"
+	// RuleCORSPreflight is reported for cross-site CORS preflights lacking Sec-Fetch-Mode, or
+	// allowed by AllowCORSPreflights.
+	RuleCORSPreflight Rule = "cors-preflight"
+	// RuleCrossSiteMethod is reported for cross-site requests with state-changing methods.
+	RuleCrossSiteMethod Rule = "cross-site-method"
+	// RuleUserActivation is reported for cross-site navigations rejected by
+	// RequireUserActivation.
+	RuleUserActivation Rule = "user-activation"
+	// RuleCrossSiteNavigation is reported for allowed cross-site navigations.
+	RuleCrossSiteNavigation Rule = "cross-site-navigation"
+	// RuleCrossSiteSubresource is reported for cross-site subresource requests allowed by
+	// CrossSiteDestinations.
+	RuleCrossSiteSubresource Rule = "cross-site-subresource"
+	// RuleCrossSiteDest is reported for cross-site requests to destinations that are not
+	// allowed by CrossSiteDestinations.
+	RuleCrossSiteDest Rule = "cross-site-destination"
+)
+
+// A Decision describes the outcome of evaluating a request against a Policy.
+type Decision struct {
+	// Allowed reports whether the request was allowed.
+	Allowed bool
+	// Rule is the rule that determined the outcome.
+	Rule Rule
+	// Site, Mode, Dest and User are the raw values of the Sec-Fetch-Site, Sec-Fetch-Mode,
+	// Sec-Fetch-Dest and Sec-Fetch-User headers of the request.
+	Site, Mode, Dest, User string
+
+	// refererLogOnly is set for requests that RefererFallbackLogOnly would have rejected, so
+	// that they are logged when evaluated by handlers rather than when checked.
+	refererLogOnly bool
+}
+
+// String describes d in the format used by DebugHeader, e.g. "blocked; rule=cross-site-method".
+func (d Decision) String() string {
+	if d.Allowed {
+		return "allowed; rule=" + string(d.Rule)
+	}
+	return "blocked; rule=" + string(d.Rule)
+}
+
+// DebugHeader makes Protect and ProtectLogOnly describe their decision in an
+// X-SecFetch-Decision response header, e.g. "X-SecFetch-Decision: blocked; rule=framing".
+// In log-only mode rejected requests are described as "would-block".
+//
+// This is meant to debug policies in development and staging environments, as it discloses
+// details of the policy to clients.
+func DebugHeader() Option {
+	return func(p *Policy) {
+		p.debugHeader = true
+	}
+}
+
+func (p *Policy) setDebugHeader(w http.ResponseWriter, d Decision, m Mode) {
+	if !p.debugHeader {
+		return
+	}
+	v := d.String()
+	if m == LogOnly && !d.Allowed {
+		v = "would-block; rule=" + string(d.Rule)
+	}
+	w.Header().Set("X-SecFetch-Decision", v)
+}
+
+var defaultPolicy = ResourceIsolationPolicy()
+
+// Allowed reports whether r is allowed by the default ResourceIsolationPolicy.
+//
+// It is meant for frameworks that cannot use http.Handler middleware, ProtectHandler should be
+// preferred otherwise.
+func Allowed(r *http.Request) bool {
+	return defaultPolicy.Allowed(r)
+}
+
+// Allowed reports whether r is allowed by p.
+func (p *Policy) Allowed(r *http.Request) bool {
+	return p.Check(r).Allowed
+}
+
+// Check evaluates r against p and describes the outcome.
+func (p *Policy) Check(r *http.Request) Decision {
+	d := Decision{
+		Site: r.Header.Get("Sec-Fetch-Site"),
+		Mode: r.Header.Get("Sec-Fetch-Mode"),
+		Dest: r.Header.Get("Sec-Fetch-Dest"),
+		User: r.Header.Get("Sec-Fetch-User"),
+	}
+	d.Rule, d.Allowed = p.decide(r, &d)
+	return d
+}
+
+func (p *Policy) decide(r *http.Request, d *Decision) (Rule, bool) {
+	if p.exempted(r) {
+		return RuleExempt, true
+	}
+	if p.decider == nil {
+		if rule, ok := p.checkBlockedDest(d); ok {
+			return rule, false
+		}
+	}
+	if rule, allowed, ok := p.checkRoutes(r, d); ok {
+		return rule, allowed
+	}
+	if p.decider != nil {
+		cd := p.decider.Decide(r)
+		return cd.Rule, cd.Allowed
+	}
+	// The checks are called directly rather than through a slice of funcs, which would move d
+	// to the heap.
+	if rule, ok := p.checkMalformed(r, d); !ok {
+		return rule, false
+	}
+	if rule, ok := p.checkSpeculative(r, d); !ok {
+		return rule, false
+	}
+	if rule, ok := p.checkMissing(r, d); !ok {
+		return rule, false
+	}
+	if rule, ok := p.checkReferer(r, d); !ok {
+		return rule, false
+	}
+	if rule, ok := p.checkFraming(r, d); !ok {
+		return rule, false
+	}
+	return p.checkResource(r, d)
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	var tests = []struct {
+		name, path, site, mode, dest, user, method string
+		want                                       Decision
+	}{
+		{
+			name:   "exempt",
+			path:   "/public",
+			site:   "cross-site",
+			mode:   "cors",
+			method: "POST",
+			want:   Decision{Allowed: true, Rule: RuleExempt, Site: "cross-site", Mode: "cors"},
+		},
+		{
+			name:   "missing metadata",
+			method: "POST",
+			want:   Decision{Allowed: true, Rule: RuleMissingMetadata},
+		},
+		{
+			name:   "trusted site",
+			site:   "same-site",
+			mode:   "cors",
+			dest:   "empty",
+			method: "POST",
+			want:   Decision{Allowed: true, Rule: RuleTrustedSite, Site: "same-site", Mode: "cors", Dest: "empty"},
+		},
+		{
+			name:   "cors preflight",
+			site:   "cross-site",
+			method: "OPTIONS",
+			want:   Decision{Allowed: true, Rule: RuleCORSPreflight, Site: "cross-site"},
+		},
+		{
+			name:   "form submission",
+			site:   "cross-site",
+			mode:   "navigate",
+			dest:   "document",
+			user:   "?1",
+			method: "POST",
+			want:   Decision{Allowed: false, Rule: RuleCrossSiteMethod, Site: "cross-site", Mode: "navigate", Dest: "document", User: "?1"},
+		},
+		{
+			name:   "navigation",
+			site:   "cross-site",
+			mode:   "navigate",
+			dest:   "document",
+			method: "GET",
+			want:   Decision{Allowed: true, Rule: RuleCrossSiteNavigation, Site: "cross-site", Mode: "navigate", Dest: "document"},
+		},
+		{
+			name:   "framing",
+			site:   "cross-site",
+			mode:   "navigate",
+			dest:   "iframe",
+			method: "GET",
+			want:   Decision{Allowed: false, Rule: RuleFraming, Site: "cross-site", Mode: "navigate", Dest: "iframe"},
+		},
+		{
+			name:   "subresource",
+			site:   "cross-site",
+			mode:   "no-cors",
+			dest:   "image",
+			method: "GET",
+			want:   Decision{Allowed: false, Rule: RuleCrossSiteDest, Site: "cross-site", Mode: "no-cors", Dest: "image"},
+		},
+	}
+	p := ResourceIsolationPolicy(ExemptPaths("/public"), FramingIsolation())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			if path == "" {
+				path = "/"
+			}
+			r := httptest.NewRequest(tt.method, path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			r.Header.Set("sec-fetch-user", tt.user)
+			if got := p.Check(r); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebugHeader(t *testing.T) {
+	var tests = []struct {
+		name, site, method string
+		protect, logOnly   string
+	}{
+		{
+			name:    "allowed",
+			site:    "same-origin",
+			method:  "POST",
+			protect: "allowed; rule=trusted-site",
+			logOnly: "allowed; rule=trusted-site",
+		},
+		{
+			name:    "blocked",
+			site:    "cross-site",
+			method:  "POST",
+			protect: "blocked; rule=cross-site-method",
+			logOnly: "would-block; rule=cross-site-method",
+		},
+	}
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var tl testRequestLogger
+	p := ResourceIsolationPolicy(DebugHeader())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tl.reset()
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", "cors")
+			w := httptest.NewRecorder()
+			p.Protect(noop).ServeHTTP(w, r)
+			if got := w.Header().Get("X-SecFetch-Decision"); got != tt.protect {
+				t.Errorf("Protect: got %q, want %q", got, tt.protect)
+			}
+			w = httptest.NewRecorder()
+			p.ProtectLogOnly(noop, &tl).ServeHTTP(w, r)
+			if got := w.Header().Get("X-SecFetch-Decision"); got != tt.logOnly {
+				t.Errorf("ProtectLogOnly: got %q, want %q", got, tt.logOnly)
+			}
+		})
+	}
+	w := httptest.NewRecorder()
+	ProtectHandler(noop).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if got := w.Header().Get("X-SecFetch-Decision"); got != "" {
+		t.Errorf("got X-SecFetch-Decision %q without DebugHeader", got)
+	}
+}
+
+// newBenchRequest returns a request with the Fetch Metadata headers set with canonical keys, as
+// net/http servers do.
+func newBenchRequest(method, site, mode, dest string) *http.Request {
+	r := httptest.NewRequest(method, "/api/items", nil)
+	r.Header.Set("Sec-Fetch-Site", site)
+	r.Header.Set("Sec-Fetch-Mode", mode)
+	r.Header.Set("Sec-Fetch-Dest", dest)
+	return r
+}
+
+// benchPolicy is a policy with route rules and destination blocks, so that checking requests
+// goes through all the steps of decisions.
+var benchPolicy = ResourceIsolationPolicy(
+	OAuthCallback("/oauth/callback"),
+	AllowStaticAssets("/static/", ".css"),
+	BlockScriptInclusion(),
+	AllowFramingPaths("/embed/*"),
+	ExemptPaths("/public/*"),
+)
+
+func TestCheckAllocs(t *testing.T) {
+	for _, r := range []*http.Request{
+		newBenchRequest("GET", "same-origin", "cors", "empty"),
+		newBenchRequest("POST", "cross-site", "navigate", "document"),
+	} {
+		if n := testing.AllocsPerRun(100, func() { benchPolicy.Check(r) }); n != 0 {
+			t.Errorf("Check(%s %s) allocates %v times, want 0", r.Method, r.Header.Get("Sec-Fetch-Site"), n)
+		}
+	}
+}
+
+func BenchmarkCheck(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		r    *http.Request
+	}{
+		{"same-origin", newBenchRequest("GET", "same-origin", "cors", "empty")},
+		{"cross-site", newBenchRequest("POST", "cross-site", "navigate", "document")},
+		{"missing", httptest.NewRequest("GET", "/", nil)},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				benchPolicy.Check(bb.r)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DenyHandler sets the handler used to respond to requests rejected by the policy, for example
+// to render a branded error page or to return an API-specific error.
+//
+// The default handler responds with a 403 status and a short message, see DenyJSON. Responses
+// to rejected requests carry a "Cache-Control: no-store" header, unless h overrides it.
+func DenyHandler(h http.Handler) Option {
+	return func(p *Policy) {
+		p.deny = h
+		p.denyDesc = "handler"
+		p.stealth = false
+	}
+}
+
+// DenyStatus makes the policy respond to rejected requests with the given status code and an
+// empty body, for example to avoid disclosing which endpoints exist by responding with 404.
+//
+// DenyStatus and DenyHandler override each other, the last one passed to the policy is used.
+func DenyStatus(code int) Option {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	})
+	return func(p *Policy) {
+		p.deny = h
+		p.denyDesc = "status " + strconv.Itoa(code)
+		p.stealth = false
+	}
+}
+
+// DenyNotFound makes the policy respond to all rejected requests with notFound, which should be
+// the handler the application uses for unknown paths, so that cross-site probes can't tell
+// protected endpoints from missing ones. If notFound is nil, http.NotFoundHandler is used.
+//
+// Unlike with DenyHandler, the response is left entirely to notFound: the policy doesn't add the
+// Cache-Control and X-Request-Id headers, and ignores DenyRedirect, DenyTemplate and image
+// placeholders. The debug header of DebugHeader is still added, as it is not meant for
+// production. DenyNotFound, DenyHandler and DenyStatus override each other, the last one passed
+// to the policy is used.
+func DenyNotFound(notFound http.Handler) Option {
+	if notFound == nil {
+		notFound = http.NotFoundHandler()
+	}
+	return func(p *Policy) {
+		p.deny = notFound
+		p.denyDesc = "not found"
+		p.stealth = true
+	}
+}
+
+// DenyJSON sets the value that is encoded as JSON in the response to rejected requests made by
+// API clients, i.e. requests that accept "application/json", are sent by XMLHttpRequest or fetch.
+// Other rejected requests receive a plain text response.
+//
+// The default value is {"error": "Invalid resource access"}. DenyJSON panics if v cannot be
+// encoded as JSON. It has no effect if DenyHandler or DenyStatus are used.
+func DenyJSON(v interface{}) Option {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("secfetch: cannot encode deny value: %v", err))
+	}
+	return func(p *Policy) {
+		p.denyJSON = append(b, '\n')
+	}
+}
+
+// DenyPage is the data the templates passed to DenyTemplate are executed with.
+type DenyPage struct {
+	// Path is the path of the rejected request.
+	Path string
+	// RequestID is the ID of the rejected request, see RequestID, or "" if it has none. Use
+	// CorrelateRequests to make sure rejected requests have one.
+	RequestID string
+	// Rule is the rule that rejected the request.
+	Rule Rule
+	// Message is the message of the default response, localized if the policy uses
+	// LocalizeDeny.
+	Message string
+}
+
+// DenyTemplate sets the template used to render an HTML page in the response to rejected
+// requests that are not made by API clients, e.g. to explain to users who followed a link from
+// another site how to reach the application. t is executed with a DenyPage, and the response has
+// a 403 status. html/template escapes the request details, which are chosen by the client.
+//
+// If t fails to execute, the default plain text response is sent. DenyTemplate has no effect if
+// DenyHandler or DenyStatus are used.
+func DenyTemplate(t *template.Template) Option {
+	return func(p *Policy) {
+		p.denyTemplate = t
+	}
+}
+
+// serveTemplate renders the DenyTemplate page for r, and reports whether it succeeded.
+func (p *Policy) serveTemplate(w http.ResponseWriter, r *http.Request, msg string) bool {
+	d, _ := FromContext(r.Context())
+	page := DenyPage{Path: r.URL.Path, RequestID: RequestID(r), Rule: d.Rule, Message: msg}
+	// The page is rendered to a buffer so that errors can fall back to the default response.
+	var buf bytes.Buffer
+	if err := p.denyTemplate.Execute(&buf, page); err != nil {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	w.Write(buf.Bytes())
+	return true
+}
+
+// DenyRedirect redirects rejected navigations to url, for example an interstitial page that
+// invites users to open the application directly. Other rejected requests are handled as usual.
+//
+// Redirects use the 303 status, so rejected form submissions are turned into GET requests.
+// Browsers preserve the cross-site context across redirects, so url must be allowed by the
+// policy, e.g. with ExemptPaths, or it will be rejected too.
+func DenyRedirect(url string) Option {
+	return func(p *Policy) {
+		p.denyRedirect = url
+	}
+}
+
+// DisableVary stops Protect from adding the Fetch Metadata request headers to the Vary header
+// of responses.
+//
+// Responses of protected handlers depend on those headers, so they are listed in Vary by default
+// to prevent shared caches from serving a rejection to legitimate clients, or vice versa. This
+// should only be disabled when responses are never cached by shared caches.
+func DisableVary() Option {
+	return func(p *Policy) {
+		p.noVary = true
+	}
+}
+
+// vary returns the value of the Vary header to add to responses, if any.
+func (p *Policy) vary() string {
+	if p.noVary {
+		return ""
+	}
+	v := "Sec-Fetch-Site, Sec-Fetch-Mode, Sec-Fetch-Dest"
+	if p.requireUser {
+		v += ", Sec-Fetch-User"
+	}
+	if p.speculation != SpeculationAllow {
+		v += ", Sec-Purpose"
+	}
+	if len(p.origins) > 0 || len(p.originFuncs) > 0 || len(p.rpcOrigins) > 0 || len(p.wsOrigins) > 0 ||
+		len(p.untrustedHosts) > 0 {
+		v += ", Origin"
+	}
+	return v
+}
+
+// addVary adds the value in vary to the Vary header of h. If h has no Vary header, vary is
+// used rather than copied, so that protecting requests doesn't allocate: it must not be
+// modified.
+func addVary(h http.Header, vary []string) {
+	if v, ok := h["Vary"]; ok {
+		h["Vary"] = append(v, vary[0])
+		return
+	}
+	h["Vary"] = vary[:1:1]
+}
+
+var (
+	defaultDenyJSON = []byte(`{"error":"Invalid resource access"}` + "\n")
+	defaultDenyText = []byte(defaultDenyMessage + "\n")
+)
+
+// ServeDenied replies to r with the response p is configured to send to rejected requests.
+func (p *Policy) ServeDenied(w http.ResponseWriter, r *http.Request) {
+	if p.tarpit != nil {
+		p.tarpit.wait(r)
+	}
+	if p.stealth {
+		p.deny.ServeHTTP(w, r)
+		return
+	}
+	// Rejections depend on the context the request was sent from, so they must never be served
+	// from caches. Deny handlers can still override this.
+	w.Header().Set("Cache-Control", "no-store")
+	var id string
+	if p.correlate {
+		if id = RequestID(r); id != "" {
+			w.Header().Set(requestIDHeader, id)
+		}
+	}
+	if p.serveHotlinkPlaceholder(w, r) {
+		return
+	}
+	if p.denyRedirect != "" && isNavigation(r.Header.Get("Sec-Fetch-Mode")) {
+		http.Redirect(w, r, p.denyRedirect, http.StatusSeeOther)
+		return
+	}
+	if p.deny != nil {
+		p.deny.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if prefersJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(p.denyJSON)
+		return
+	}
+	msg, lang := p.denyMessage(r)
+	if lang != "" {
+		w.Header().Set("Content-Language", lang)
+	}
+	if p.denyTemplate != nil && p.serveTemplate(w, r, msg) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	switch {
+	case id != "":
+		fmt.Fprintf(w, "%s (request ID %s)\n", msg, id)
+	case lang != "":
+		io.WriteString(w, msg+"\n")
+	default:
+		w.Write(defaultDenyText)
+	}
+}
+
+// prefersJSON reports whether r looks like it was sent by an API client.
+func prefersJSON(r *http.Request) bool {
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" || r.Header.Get("Sec-Fetch-Dest") == "empty" {
+		return true
+	}
+	for _, v := range r.Header.Values("Accept") {
+		for _, mt := range strings.Split(v, ",") {
+			if i := strings.IndexByte(mt, ';'); i >= 0 {
+				mt = mt[:i]
+			}
+			mt = strings.ToLower(strings.TrimSpace(mt))
+			if mt == "application/json" || strings.HasPrefix(mt, "application/") && strings.HasSuffix(mt, "+json") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,347 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDenyHandler(t *testing.T) {
+	const data = "User Data"
+	deny := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTeapot)
+		fmt.Fprint(w, `{"error":"cross-site request"}`)
+	})
+	hf := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, data)
+	}), DenyHandler(deny))
+	for _, tt := range checkTests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			w := httptest.NewRecorder()
+			hf.ServeHTTP(w, r)
+			want := data
+			if !tt.want {
+				want = `{"error":"cross-site request"}`
+			}
+			if got := w.Body.String(); got != want {
+				t.Errorf("(%q,%q,%q,%q): got body %q, want %q", tt.method, tt.site, tt.mode, tt.dest, got, want)
+			}
+			if got := w.Code == http.StatusTeapot; got == tt.want {
+				t.Errorf("(%q,%q,%q,%q): got status %d", tt.method, tt.site, tt.mode, tt.dest, w.Code)
+			}
+		})
+	}
+}
+
+func TestDenyStatus(t *testing.T) {
+	var tests = []struct {
+		name string
+		opts []Option
+		want int
+	}{
+		{name: "not found", opts: []Option{DenyStatus(http.StatusNotFound)}, want: http.StatusNotFound},
+		{name: "no content", opts: []Option{DenyStatus(http.StatusNoContent)}, want: http.StatusNoContent},
+		{
+			name: "overrides handler",
+			opts: []Option{DenyHandler(http.NotFoundHandler()), DenyStatus(http.StatusBadRequest)},
+			want: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hf := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "User Data")
+			}), tt.opts...)
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", "cors")
+			w := httptest.NewRecorder()
+			hf.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if w.Body.Len() != 0 {
+				t.Errorf("got body %q, want empty", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDenyJSON(t *testing.T) {
+	var tests = []struct {
+		name, accept, xrw, dest string
+		wantType                string
+	}{
+		{name: "navigation", accept: "text/html,*/*;q=0.8", dest: "document", wantType: "text/plain; charset=utf-8"},
+		{name: "accept json", accept: "application/json", dest: "document", wantType: "application/json"},
+		{name: "accept json with params", accept: "text/html, application/json; q=0.9", wantType: "application/json"},
+		{name: "accept json suffix", accept: "application/problem+json", wantType: "application/json"},
+		{name: "xhr", xrw: "XMLHttpRequest", wantType: "application/json"},
+		{name: "fetch", dest: "empty", wantType: "application/json"},
+		{name: "image", accept: "image/*", dest: "image", wantType: "text/plain; charset=utf-8"},
+	}
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, p := range []struct {
+		name     string
+		h        http.Handler
+		wantJSON string
+	}{
+		{name: "default", h: ProtectHandler(noop), wantJSON: `{"error":"Invalid resource access"}` + "\n"},
+		{
+			name:     "custom",
+			h:        ProtectHandler(noop, DenyJSON(map[string]int{"code": 42})),
+			wantJSON: `{"code":42}` + "\n",
+		},
+	} {
+		for _, tt := range tests {
+			t.Run(p.name+" "+tt.name, func(t *testing.T) {
+				r := httptest.NewRequest("POST", "/", nil)
+				r.Header.Set("sec-fetch-site", "cross-site")
+				r.Header.Set("sec-fetch-mode", "cors")
+				r.Header.Set("sec-fetch-dest", tt.dest)
+				r.Header.Set("accept", tt.accept)
+				r.Header.Set("x-requested-with", tt.xrw)
+				w := httptest.NewRecorder()
+				p.h.ServeHTTP(w, r)
+				if w.Code != http.StatusForbidden {
+					t.Errorf("got status %d, want %d", w.Code, http.StatusForbidden)
+				}
+				if got := w.Header().Get("Content-Type"); got != tt.wantType {
+					t.Errorf("got Content-Type %q, want %q", got, tt.wantType)
+				}
+				want := "Invalid resource access\n"
+				if tt.wantType == "application/json" {
+					want = p.wantJSON
+				}
+				if got := w.Body.String(); got != want {
+					t.Errorf("got body %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestDenyJSONInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("DenyJSON with a value that cannot be encoded didn't panic")
+		}
+	}()
+	DenyJSON(make(chan int))
+}
+
+func TestDenyTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("deny").Parse(
+		`<p>{{.Path}} blocked by {{.Rule}}{{with .RequestID}}, ID {{.}}{{end}}</p>`))
+	broken := template.Must(template.New("broken").Parse(`{{.Missing}}`))
+	var tests = []struct {
+		name     string
+		tmpl     *template.Template
+		path     string
+		accept   string
+		id       string
+		wantType string
+		wantBody string
+	}{
+		{name: "page", tmpl: tmpl, path: "/account", wantType: "text/html; charset=utf-8", wantBody: "<p>/account blocked by cross-site-method</p>"},
+		{name: "escaped", tmpl: tmpl, path: "/<script>", id: `"a&b"`, wantType: "text/html; charset=utf-8",
+			wantBody: "<p>/&lt;script&gt; blocked by cross-site-method, ID &#34;a&amp;b&#34;</p>"},
+		{name: "api client", tmpl: tmpl, path: "/account", accept: "application/json", wantType: "application/json", wantBody: string(defaultDenyJSON)},
+		{name: "broken template", tmpl: broken, path: "/account", wantType: "text/plain; charset=utf-8", wantBody: string(defaultDenyText)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), DenyTemplate(tt.tmpl))
+			r := httptest.NewRequest("POST", "/", nil)
+			r.URL.Path = tt.path
+			r.Header.Set("Sec-Fetch-Site", "cross-site")
+			r.Header.Set("Sec-Fetch-Mode", "navigate")
+			r.Header.Set("Sec-Fetch-Dest", "document")
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if tt.id != "" {
+				r.Header.Set("X-Request-Id", tt.id)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusForbidden)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("got Content-Type %q, want %q", got, tt.wantType)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("got body %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDenyNotFound(t *testing.T) {
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-App", "1")
+		http.Error(w, "page not found", http.StatusNotFound)
+	})
+	var tests = []struct {
+		name string
+		opts []Option
+		// want is the handler of unknown paths.
+		want http.Handler
+	}{
+		{name: "app handler", opts: []Option{DenyNotFound(notFound)}, want: notFound},
+		{name: "default handler", opts: []Option{DenyNotFound(nil)}, want: http.NotFoundHandler()},
+		{name: "ignores other options", opts: []Option{DenyNotFound(notFound), DenyRedirect("/open"), CorrelateRequests()}, want: notFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tt.opts...)
+			r := httptest.NewRequest("POST", "/account", nil)
+			r.Header.Set("Sec-Fetch-Site", "cross-site")
+			r.Header.Set("Sec-Fetch-Mode", "navigate")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			// The response must be the one of an unknown path, except for Vary.
+			want := httptest.NewRecorder()
+			tt.want.ServeHTTP(want, httptest.NewRequest("GET", "/missing", nil))
+			want.Header().Set("Vary", w.Header().Get("Vary"))
+			if w.Code != want.Code || w.Body.String() != want.Body.String() || !reflect.DeepEqual(w.Header(), want.Header()) {
+				t.Errorf("got %d %v %q, want %d %v %q", w.Code, w.Header(), w.Body, want.Code, want.Header(), want.Body)
+			}
+		})
+	}
+	p := ResourceIsolationPolicy(DenyNotFound(nil), DenyStatus(http.StatusTeapot))
+	w := httptest.NewRecorder()
+	p.ServeDenied(w, httptest.NewRequest("POST", "/", nil))
+	if w.Code != http.StatusTeapot || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("DenyStatus after DenyNotFound: got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestDenyRedirect(t *testing.T) {
+	var tests = []struct {
+		name, mode, dest, method string
+		want                     int
+	}{
+		{name: "form submission", mode: "navigate", dest: "document", method: "POST", want: http.StatusSeeOther},
+		{name: "embed navigation", mode: "navigate", dest: "embed", method: "GET", want: http.StatusSeeOther},
+		{name: "nested navigation", mode: "nested-navigate", dest: "iframe", method: "POST", want: http.StatusSeeOther},
+		{name: "allowed navigation", mode: "navigate", dest: "document", method: "GET", want: http.StatusOK},
+		{name: "fetch", mode: "cors", dest: "empty", method: "POST", want: http.StatusNotFound},
+		{name: "subresource", mode: "no-cors", dest: "image", method: "GET", want: http.StatusNotFound},
+	}
+	hf := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		DenyRedirect("/open-directly"), DenyStatus(http.StatusNotFound))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/account", nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			w := httptest.NewRecorder()
+			hf.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if w.Code != http.StatusSeeOther {
+				return
+			}
+			if got := w.Header().Get("Location"); got != "/open-directly" {
+				t.Errorf("got Location %q, want %q", got, "/open-directly")
+			}
+		})
+	}
+}
+
+func TestVary(t *testing.T) {
+	var tests = []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{
+			name: "default",
+			want: []string{"Accept-Encoding", "Sec-Fetch-Site, Sec-Fetch-Mode, Sec-Fetch-Dest"},
+		},
+		{
+			name: "user activation and origins",
+			opts: []Option{RequireUserActivation(), AllowOrigins("https://partner.example")},
+			want: []string{"Accept-Encoding", "Sec-Fetch-Site, Sec-Fetch-Mode, Sec-Fetch-Dest, Sec-Fetch-User, Origin"},
+		},
+		{
+			name: "disabled",
+			opts: []Option{DisableVary()},
+			want: []string{"Accept-Encoding"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := ResourceIsolationPolicy(tt.opts...)
+			h := p.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			for _, site := range []string{"same-origin", "cross-site"} {
+				r := httptest.NewRequest("POST", "/", nil)
+				r.Header.Set("sec-fetch-site", site)
+				w := httptest.NewRecorder()
+				w.Header().Set("Vary", "Accept-Encoding")
+				h.ServeHTTP(w, r)
+				if got := w.Header().Values("Vary"); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: got Vary %q, want %q", site, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDenyCacheControl(t *testing.T) {
+	var tests = []struct {
+		name, mode string
+		opts       []Option
+	}{
+		{name: "default", mode: "cors"},
+		{name: "json", mode: "cors", opts: []Option{DenyJSON("blocked")}},
+		{name: "status", mode: "cors", opts: []Option{DenyStatus(http.StatusNotFound)}},
+		{name: "handler", mode: "cors", opts: []Option{DenyHandler(http.NotFoundHandler())}},
+		{name: "redirect", mode: "navigate", opts: []Option{DenyRedirect("/landing")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "public, max-age=3600")
+			}), tt.opts...)
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code == http.StatusOK {
+				t.Fatalf("request was not rejected")
+			}
+			if got := w.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("got Cache-Control %q, want %q", got, "no-store")
+			}
+		})
+	}
+}
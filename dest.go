@@ -0,0 +1,130 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"strings"
+)
+
+// A destBlock rejects the requests with a destination, see Policy.blockedDests.
+type destBlock struct {
+	rule Rule
+	// allSites makes the block apply to all requests, not just cross-site ones.
+	allSites bool
+}
+
+// blockDest makes p reject the requests with dest, reporting them with rule.
+func (p *Policy) blockDest(dest string, rule Rule, allSites bool) {
+	if p.blockedDests == nil {
+		p.blockedDests = make(map[string]destBlock)
+	}
+	p.blockedDests[dest] = destBlock{rule: rule, allSites: allSites}
+}
+
+// checkBlockedDest returns the rule of the destination block that applies to d, if any.
+func (p *Policy) checkBlockedDest(d *Decision) (Rule, bool) {
+	b, ok := p.blockedDests[d.Dest]
+	if !ok || !b.allSites && d.Site != "cross-site" {
+		return "", false
+	}
+	return b.rule, true
+}
+
+// BlockScriptInclusion rejects cross-site requests for scripts, i.e. the ones with the "script"
+// destination, so other sites cannot include the JavaScript and JSON endpoints of the
+// application with script elements to read their data (XSSI). Same-site requests are evaluated
+// as usual.
+//
+// Destination blocks are checked after exemptions and before route rules, so they override
+// CrossSiteDestinations and AllowStaticAssets. Rejected requests are reported with
+// RuleScriptInclusion.
+func BlockScriptInclusion() Option {
+	return func(p *Policy) {
+		p.blockDest("script", RuleScriptInclusion, false)
+	}
+}
+
+// BlockEmbeddableDestinations rejects all the requests with the "object" and "embed"
+// destinations, even same-origin ones. Plugin-style embedding is not needed by most modern
+// applications, and embedding resources as plugin content is a common vector for data
+// exfiltration.
+//
+// BlockEmbeddableDestinations is a destination block, see BlockScriptInclusion for the evaluation
+// order. Rejected requests are reported with RuleEmbeddableDestination.
+func BlockEmbeddableDestinations() Option {
+	return func(p *Policy) {
+		p.blockDest("object", RuleEmbeddableDestination, true)
+		p.blockDest("embed", RuleEmbeddableDestination, true)
+	}
+}
+
+// BlockFencedFrames rejects cross-site requests to be loaded in fenced frames, i.e. the ones with
+// the "fencedframe" destination, which are otherwise treated like iframes: allowed by default,
+// and rejected by FramingIsolation. Same-site requests are evaluated as usual.
+//
+// BlockFencedFrames is a destination block, see BlockScriptInclusion for the evaluation order.
+// Rejected requests are reported with RuleFencedFrame.
+func BlockFencedFrames() Option {
+	return func(p *Policy) {
+		p.blockDest("fencedframe", RuleFencedFrame, false)
+	}
+}
+
+// AllowCrossSiteFonts allows cross-site GET and HEAD requests for fonts, i.e. the ones with the
+// "font" destination, whose path starts with any of prefixes, so that routes like the ones of a
+// design system can be shared with other sites while the rest of the application is isolated.
+//
+// Allowed requests are reported with RuleCrossSiteFont. AllowCrossSiteFonts is a route rule, see
+// AllowCrossSite for the evaluation order.
+func AllowCrossSiteFonts(prefixes ...string) Option {
+	return destRoute("cross-site-fonts", "font", RuleCrossSiteFont, prefixes)
+}
+
+// AllowCrossSiteStyles is like AllowCrossSiteFonts, for stylesheets, i.e. requests with the
+// "style" destination. Allowed requests are reported with RuleCrossSiteStyle.
+func AllowCrossSiteStyles(prefixes ...string) Option {
+	return destRoute("cross-site-styles", "style", RuleCrossSiteStyle, prefixes)
+}
+
+// destRoute returns a route rule that allows GET and HEAD requests with dest whose path starts
+// with any of prefixes.
+func destRoute(action, dest string, rule Rule, prefixes []string) Option {
+	rr := routeRule{
+		desc:   action + " " + strings.Join(prefixes, " "),
+		method: "*",
+		globs:  [][]string{{"**"}},
+		when: func(r *http.Request, d Decision) bool {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead || d.Dest != dest {
+				return false
+			}
+			return hasAnyPrefix(cleanPath(r.URL.Path), prefixes)
+		},
+		rule:  rule,
+		allow: true,
+	}
+	return func(p *Policy) {
+		p.routes = append(p.routes, rr)
+	}
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
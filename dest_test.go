@@ -0,0 +1,134 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBlockScriptInclusion(t *testing.T) {
+	p := ResourceIsolationPolicy(CrossSiteDestinations("script"), BlockScriptInclusion())
+	var tests = []struct {
+		name, site, mode, dest string
+		want                   bool
+		wantRule               Rule
+	}{
+		{name: "cross-site script", site: "cross-site", mode: "no-cors", dest: "script", wantRule: RuleScriptInclusion},
+		{name: "same-site script", site: "same-site", mode: "no-cors", dest: "script", want: true, wantRule: RuleTrustedSite},
+		{name: "cross-site navigation", site: "cross-site", mode: "navigate", dest: "document", want: true, wantRule: RuleCrossSiteNavigation},
+		{name: "cross-site fetch", site: "cross-site", mode: "cors", dest: "empty", wantRule: RuleCrossSiteDest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/data.json", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			d := p.Check(r)
+			if d.Allowed != tt.want || d.Rule != tt.wantRule {
+				t.Errorf("got %v, want allowed %v by %q", d, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestBlockEmbeddableDestinations(t *testing.T) {
+	p := ResourceIsolationPolicy(CrossSiteDestinations("embed", "object"), BlockEmbeddableDestinations())
+	var tests = []struct {
+		name, site, mode, dest string
+		want                   bool
+		wantRule               Rule
+	}{
+		{name: "cross-site object", site: "cross-site", mode: "navigate", dest: "object", wantRule: RuleEmbeddableDestination},
+		{name: "same-origin object", site: "same-origin", mode: "navigate", dest: "object", wantRule: RuleEmbeddableDestination},
+		{name: "same-site embed", site: "same-site", mode: "no-cors", dest: "embed", wantRule: RuleEmbeddableDestination},
+		{name: "same-origin iframe", site: "same-origin", mode: "navigate", dest: "iframe", want: true, wantRule: RuleTrustedSite},
+		{name: "cross-site document", site: "cross-site", mode: "navigate", dest: "document", want: true, wantRule: RuleCrossSiteNavigation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/doc.pdf", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			d := p.Check(r)
+			if d.Allowed != tt.want || d.Rule != tt.wantRule {
+				t.Errorf("got %v, want allowed %v by %q", d, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestAllowCrossSiteFontsAndStyles(t *testing.T) {
+	p := ResourceIsolationPolicy(AllowCrossSiteFonts("/ds/fonts/"), AllowCrossSiteStyles("/ds/", "/theme/"))
+	var tests = []struct {
+		name, method, path, mode, dest string
+		want                           bool
+		wantRule                       Rule
+	}{
+		{name: "font", method: "GET", path: "/ds/fonts/inter.woff2", mode: "cors", dest: "font", want: true, wantRule: RuleCrossSiteFont},
+		{name: "font other path", method: "GET", path: "/app/inter.woff2", mode: "cors", dest: "font", wantRule: RuleCrossSiteDest},
+		{name: "style", method: "GET", path: "/theme/main.css", mode: "no-cors", dest: "style", want: true, wantRule: RuleCrossSiteStyle},
+		{name: "style in font path", method: "HEAD", path: "/ds/fonts/fonts.css", mode: "no-cors", dest: "style", want: true, wantRule: RuleCrossSiteStyle},
+		{name: "font in style path", method: "GET", path: "/theme/inter.woff2", mode: "cors", dest: "font", wantRule: RuleCrossSiteDest},
+		{name: "script", method: "GET", path: "/ds/app.js", mode: "no-cors", dest: "script", wantRule: RuleCrossSiteDest},
+		{name: "post", method: "POST", path: "/ds/fonts/x", mode: "cors", dest: "font", wantRule: RuleCrossSiteMethod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			d := p.Check(r)
+			if d.Allowed != tt.want || d.Rule != tt.wantRule {
+				t.Errorf("got %v, want allowed %v by %q", d, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestFencedFrames(t *testing.T) {
+	var tests = []struct {
+		name, site, mode string
+		opts             []Option
+		want             bool
+		wantRule         Rule
+	}{
+		{name: "cross-site navigation", site: "cross-site", mode: "navigate", want: true, wantRule: RuleCrossSiteNavigation},
+		{name: "cross-site fetch", site: "cross-site", mode: "no-cors", wantRule: RuleCrossSiteDest},
+		{name: "framing isolation", site: "cross-site", mode: "navigate", opts: []Option{FramingIsolation()}, wantRule: RuleFraming},
+		{name: "blocked", site: "cross-site", mode: "navigate", opts: []Option{BlockFencedFrames()}, wantRule: RuleFencedFrame},
+		{name: "blocked same-site", site: "same-site", mode: "navigate", opts: []Option{BlockFencedFrames()}, want: true, wantRule: RuleTrustedSite},
+		{name: "well-formed", site: "cross-site", mode: "navigate", opts: []Option{RejectMalformedMetadata()}, want: true, wantRule: RuleCrossSiteNavigation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := ResourceIsolationPolicy(tt.opts...)
+			r := httptest.NewRequest("GET", "/ad", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", "fencedframe")
+			d := p.Check(r)
+			if d.Allowed != tt.want || d.Rule != tt.wantRule {
+				t.Errorf("got %v, want allowed %v by %q", d, tt.want, tt.wantRule)
+			}
+			if got := d.Canonical().Dest; got != "fencedframe" {
+				t.Errorf("got canonical dest %q, want fencedframe", got)
+			}
+		})
+	}
+}
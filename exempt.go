@@ -0,0 +1,286 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// ExemptPaths exempts requests whose path matches any of the given patterns from the policy.
+// Exemptions are evaluated before any other check, so exempt requests are always allowed.
+//
+// Patterns are slash-separated lists of segments. Each segment is matched with path.Match, so
+// "*" matches any sequence of characters within a segment, and the special "**" segment matches
+// any number of segments, including none:
+//
+//	"/api/public/*" matches "/api/public/a" but not "/api/public/a/b"
+//	"/webhooks/**" matches "/webhooks", "/webhooks/a" and "/webhooks/a/b"
+//
+// Paths are cleaned before being matched. ExemptPaths panics if a pattern is malformed.
+func ExemptPaths(patterns ...string) Option {
+	globs := compileGlobs(patterns)
+	desc := "paths " + strings.Join(patterns, " ")
+	return func(p *Policy) {
+		p.exempt(desc, func(r *http.Request) bool {
+			return matchGlobs(globs, r.URL.Path)
+		})
+	}
+}
+
+// compileGlobs splits the path patterns accepted by ExemptPaths into segments, and panics if any
+// of them is malformed.
+func compileGlobs(patterns []string) [][]string {
+	globs := make([][]string, 0, len(patterns))
+	for _, p := range patterns {
+		g, err := compileGlob(p)
+		if err != nil {
+			panic(fmt.Sprintf("secfetch: malformed path pattern %q: %v", p, err))
+		}
+		globs = append(globs, g)
+	}
+	return globs
+}
+
+// compileGlob splits the path pattern p into segments.
+func compileGlob(p string) ([]string, error) {
+	g := strings.Split(p, "/")
+	for _, s := range g {
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// matchGlobs reports whether the cleaned p matches any of globs.
+func matchGlobs(globs [][]string, p string) bool {
+	p = cleanPath(p)
+	for _, g := range globs {
+		if matchSegments(g, p, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExemptPathRegexps exempts requests whose path matches any of the given regular expressions
+// from the policy.
+//
+// Expressions are matched against the cleaned path and are not implicitly anchored: use "^" and
+// "$" to match from the beginning or up to the end of the path, e.g. `^/v[0-9]+/public/`.
+func ExemptPathRegexps(res ...*regexp.Regexp) Option {
+	desc := "regexps"
+	for _, re := range res {
+		desc += " " + re.String()
+	}
+	return func(p *Policy) {
+		p.exempt(desc, func(r *http.Request) bool {
+			path := cleanPath(r.URL.Path)
+			for _, re := range res {
+				if re.MatchString(path) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+}
+
+// ExemptIf exempts requests for which f returns true from the policy.
+//
+// f is called for every request that is not exempted by a previous exemption, so it should be
+// cheap and must be safe for concurrent use. It must not read the request body.
+func ExemptIf(f func(*http.Request) bool) Option {
+	return func(p *Policy) {
+		p.exempt("predicate", f)
+	}
+}
+
+type exemption struct {
+	// desc describes the exemption in the policy configuration.
+	desc  string
+	match func(*http.Request) bool
+}
+
+func (p *Policy) exempt(desc string, match func(*http.Request) bool) {
+	p.exemptions = append(p.exemptions, exemption{desc: desc, match: match})
+}
+
+func (p *Policy) exempted(r *http.Request) bool {
+	if exemptHandlers.Load() && r.Context().Value(exemptKey{}) != nil {
+		return true
+	}
+	for _, e := range p.exemptions {
+		if e.match(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanPath is like path.Clean, but preserves trailing slashes.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	if p[len(p)-1] == '/' && np != "/" {
+		np += "/"
+	}
+	return np
+}
+
+// matchSegments reports whether the slash-separated segments of p match glob, or, if end is set,
+// whether glob matches no segments. It is equivalent to matching strings.Split(p, "/"), but
+// doesn't allocate.
+func matchSegments(glob []string, p string, end bool) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for {
+				if matchSegments(glob[1:], p, end) {
+					return true
+				}
+				if end {
+					return false
+				}
+				var found bool
+				_, p, found = strings.Cut(p, "/")
+				end = !found
+			}
+		}
+		if end {
+			return false
+		}
+		seg, rest, found := strings.Cut(p, "/")
+		if ok, _ := path.Match(glob[0], seg); !ok {
+			return false
+		}
+		glob, p, end = glob[1:], rest, !found
+	}
+	return end
+}
+
+// exemptHandlers is set once Exempt is first called, so that routes are only looked up by
+// policies when exempt handlers exist.
+var exemptHandlers atomic.Bool
+
+// exemptHandler is a handler returned by Exempt.
+type exemptHandler struct {
+	http.Handler
+}
+
+// Exempt marks h as exempt from the policies of the handlers returned by Protect and
+// ProtectLogOnly that enclose it, so exemptions can be declared along with routes:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/", appHandler)
+//	mux.Handle("POST /webhooks/", secfetch.Exempt(webhookHandler))
+//	srv := http.Server{Handler: secfetch.ProtectHandler(mux)}
+//
+// Exempt handlers are found by matching requests against the protected handler, so they must be
+// either the protected handler itself, or registered on it if it is a router with a
+// Handler(*http.Request) (http.Handler, string) method, like http.ServeMux, possibly through
+// nested routers. Handlers registered behind other middlewares, or http.StripPrefix, are not
+// found and remain protected.
+//
+// Requests for exempt handlers are reported with RuleExempt.
+func Exempt(h http.Handler) http.Handler {
+	exemptHandlers.Store(true)
+	return exemptHandler{h}
+}
+
+// router is implemented by http.ServeMux.
+type router interface {
+	Handler(r *http.Request) (h http.Handler, pattern string)
+}
+
+// maxRouterDepth bounds the lookups in nested routers.
+const maxRouterDepth = 8
+
+// exemptRoute reports whether h routes r to a handler returned by Exempt.
+func exemptRoute(h http.Handler, r *http.Request) bool {
+	if !exemptHandlers.Load() {
+		return false
+	}
+	for i := 0; i < maxRouterDepth; i++ {
+		switch rh := h.(type) {
+		case exemptHandler:
+			return true
+		case router:
+			h, _ = rh.Handler(r)
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+type exemptKey struct{}
+
+// withExemption returns r with a context that marks it as exempt.
+func withExemption(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), exemptKey{}, true))
+}
+
+// defaultHealthCheckPaths are the health check paths exempted by ExemptHealthChecks by default.
+var defaultHealthCheckPaths = []string{"/healthz", "/readyz", "/livez"}
+
+// probeUserAgents are prefixes of the User-Agent headers of common health checkers.
+var probeUserAgents = []string{"kube-probe/", "GoogleHC/", "ELB-HealthChecker/", "Consul Health Check"}
+
+// ExemptHealthChecks exempts health checks from the policy, so that RejectMissingMetadata and
+// the other options that reject requests without Fetch Metadata don't break the probes of
+// Kubernetes and cloud load balancers. Health checks are GET and HEAD requests that either
+// target a path matching any of patterns, or "/healthz", "/readyz" and "/livez" if none are
+// given, or lack Fetch Metadata and come from a well-known health checker, like kube-probe,
+// Google Cloud and AWS ELB health checks.
+//
+// Patterns have the syntax of ExemptPaths. ExemptHealthChecks panics if a pattern is malformed.
+func ExemptHealthChecks(patterns ...string) Option {
+	if len(patterns) == 0 {
+		patterns = defaultHealthCheckPaths
+	}
+	globs := compileGlobs(patterns)
+	desc := "health checks " + strings.Join(patterns, " ")
+	return func(p *Policy) {
+		p.exempt(desc, func(r *http.Request) bool {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				return false
+			}
+			if matchGlobs(globs, r.URL.Path) {
+				return true
+			}
+			if r.Header.Get("Sec-Fetch-Site") != "" {
+				return false
+			}
+			ua := r.Header.Get("User-Agent")
+			for _, p := range probeUserAgents {
+				if strings.HasPrefix(ua, p) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+}
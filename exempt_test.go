@@ -0,0 +1,226 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestExemptPaths(t *testing.T) {
+	var tests = []struct {
+		path string
+		want bool
+	}{
+		{path: "/api/public/a", want: true},
+		{path: "/api/public/a/", want: false},
+		{path: "/api/public/a/b", want: false},
+		{path: "/api/public", want: false},
+		{path: "/api/private/a", want: false},
+		{path: "/api/public/../private/a", want: false},
+		{path: "/webhooks", want: true},
+		{path: "/webhooks/", want: true},
+		{path: "/webhooks/github", want: true},
+		{path: "/webhooks/github/push", want: true},
+		{path: "/webhooksevil", want: false},
+		{path: "/v1/users/avatar.png", want: true},
+		{path: "/v1/users/avatar.jpg", want: false},
+		{path: "/v1/users/x/avatar.png", want: true},
+		{path: "/", want: false},
+	}
+	p := ResourceIsolationPolicy(ExemptPaths("/api/public/*", "/webhooks/**", "/v1/**/*.png"))
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.path, nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", "cors")
+			if got := p.Allowed(r); got != tt.want {
+				t.Errorf("%q: got %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExemptPathsMalformed(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("ExemptPaths with a malformed pattern didn't panic")
+		}
+	}()
+	ExemptPaths("/api/[")
+}
+
+func TestExemptPathRegexps(t *testing.T) {
+	var tests = []struct {
+		name, path string
+		want       bool
+	}{
+		{name: "anchored match", path: "/v1/public/a", want: true},
+		{name: "anchored multi digit", path: "/v12/public/", want: true},
+		{name: "anchored no version", path: "/v/public/a", want: false},
+		{name: "anchored prefix", path: "/api/v1/public/a", want: false},
+		{name: "anchored after cleaning", path: "/v1/private/../public/a", want: true},
+		{name: "anchored escape", path: "/v1/public/../private", want: false},
+		{name: "unanchored suffix", path: "/static/app.js", want: true},
+		{name: "unanchored anywhere", path: "/static/app.json", want: true},
+		{name: "unanchored no match", path: "/static/app.css", want: false},
+		{name: "end anchored", path: "/feed.xml", want: true},
+		{name: "end anchored suffix", path: "/feed.xml/edit", want: false},
+	}
+	p := ResourceIsolationPolicy(
+		RejectMissingMetadata(),
+		ExemptPathRegexps(regexp.MustCompile(`^/v[0-9]+/public/`), regexp.MustCompile(`\.js`)),
+		ExemptPathRegexps(regexp.MustCompile(`\.xml$`)),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.path, nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", "cors")
+			if got := p.Allowed(r); got != tt.want {
+				t.Errorf("%q: got %v, want %v", tt.path, got, tt.want)
+			}
+			// Exemptions are evaluated before strict mode.
+			r.Header.Del("sec-fetch-site")
+			r.Header.Del("sec-fetch-mode")
+			if got := p.Allowed(r); got != tt.want {
+				t.Errorf("%q without metadata: got %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExemptIf(t *testing.T) {
+	var calls int
+	p := ResourceIsolationPolicy(
+		ExemptPaths("/public"),
+		ExemptIf(func(r *http.Request) bool {
+			calls++
+			return r.Header.Get("authorization") != ""
+		}),
+	)
+	var tests = []struct {
+		name, path, auth string
+		want             bool
+		wantCalls        int
+	}{
+		{name: "predicate match", path: "/", auth: "Bearer token", want: true, wantCalls: 1},
+		{name: "predicate no match", path: "/", want: false, wantCalls: 1},
+		{name: "previous exemption", path: "/public", want: true, wantCalls: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			r := httptest.NewRequest("POST", tt.path, nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", "cors")
+			r.Header.Set("authorization", tt.auth)
+			if got := p.Allowed(r); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("predicate called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestExemptHandler(t *testing.T) {
+	var served bool
+	serve := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	})
+	api := http.NewServeMux()
+	api.Handle("/api/", serve)
+	api.Handle("POST /api/callback", Exempt(serve))
+	mux := http.NewServeMux()
+	mux.Handle("/", serve)
+	mux.Handle("/webhooks/", Exempt(serve))
+	mux.Handle("/api/", api)
+	mux.Handle("/wrapped/", http.StripPrefix("/wrapped", Exempt(serve)))
+	p := ResourceIsolationPolicy()
+	var tests = []struct {
+		name, method, path string
+		h                  http.Handler
+		want               bool
+	}{
+		{name: "protected route", method: "POST", path: "/", h: p.Protect(mux)},
+		{name: "exempt route", method: "POST", path: "/webhooks/github", h: p.Protect(mux), want: true},
+		{name: "nested exempt route", method: "POST", path: "/api/callback", h: p.Protect(mux), want: true},
+		{name: "nested method mismatch", method: "PUT", path: "/api/callback", h: p.Protect(mux)},
+		{name: "nested protected route", method: "POST", path: "/api/data", h: p.Protect(mux)},
+		{name: "behind middleware", method: "POST", path: "/wrapped/", h: p.Protect(mux)},
+		{name: "exempt handler", method: "POST", path: "/", h: p.Protect(Exempt(serve)), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served = false
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			w := httptest.NewRecorder()
+			tt.h.ServeHTTP(w, r)
+			if served != tt.want {
+				t.Errorf("served: got %v, want %v (status %d)", served, tt.want, w.Code)
+			}
+		})
+	}
+
+	// Exemptions are reported like the ones declared on the policy.
+	var got Decision
+	mux.Handle("/webhooks/stripe", Exempt(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	})))
+	r := httptest.NewRequest("POST", "/webhooks/stripe", nil)
+	r.Header.Set("sec-fetch-site", "cross-site")
+	p.Protect(mux).ServeHTTP(httptest.NewRecorder(), r)
+	if got.Rule != RuleExempt || !got.Allowed {
+		t.Errorf("got decision %v, want exempt", got)
+	}
+}
+
+func TestExemptHealthChecks(t *testing.T) {
+	var tests = []struct {
+		name, method, path, site, ua string
+		opt                          Option
+		want                         bool
+	}{
+		{name: "default path", method: "GET", path: "/healthz", opt: ExemptHealthChecks(), want: true},
+		{name: "default path head", method: "HEAD", path: "/readyz", opt: ExemptHealthChecks(), want: true},
+		{name: "default path post", method: "POST", path: "/healthz", opt: ExemptHealthChecks()},
+		{name: "custom path", method: "GET", path: "/status/ping", opt: ExemptHealthChecks("/status/*"), want: true},
+		{name: "custom replaces defaults", method: "GET", path: "/healthz", opt: ExemptHealthChecks("/status/*")},
+		{name: "kubernetes probe", method: "GET", path: "/", ua: "kube-probe/1.30", opt: ExemptHealthChecks(), want: true},
+		{name: "load balancer probe", method: "GET", path: "/", ua: "ELB-HealthChecker/2.0", opt: ExemptHealthChecks(), want: true},
+		{name: "probe with metadata", method: "GET", path: "/", site: "cross-site", ua: "kube-probe/1.30", opt: ExemptHealthChecks()},
+		{name: "other client", method: "GET", path: "/", ua: "curl/8.0", opt: ExemptHealthChecks()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := ResourceIsolationPolicy(RejectMissingMetadata(), tt.opt)
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.site != "" {
+				r.Header.Set("sec-fetch-site", tt.site)
+				r.Header.Set("sec-fetch-mode", "no-cors")
+				r.Header.Set("sec-fetch-dest", "script")
+			}
+			r.Header.Set("user-agent", tt.ua)
+			if got := p.Check(r).Rule == RuleExempt; got != tt.want {
+				t.Errorf("got exempt %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"expvar"
+)
+
+// PublishExpvar makes the policy count the requests it evaluates in an expvar.Map published
+// with the given name, which is served as JSON by the expvar handler.
+//
+// The map holds the "allowed", "blocked" and "would-block" counters, counting requests by
+// outcome, and the "missing-metadata" counter, counting requests without Fetch Metadata.
+// Policies using the same name share the same counters. PublishExpvar panics if name is already
+// used by an expvar.Var that is not an expvar.Map.
+func PublishExpvar(name string) Option {
+	var m *expvar.Map
+	if v := expvar.Get(name); v != nil {
+		var ok bool
+		if m, ok = v.(*expvar.Map); !ok {
+			panic("secfetch: expvar " + name + " is not an expvar.Map")
+		}
+	} else {
+		m = expvar.NewMap(name)
+	}
+	return RecordMetrics(expvarRecorder{m})
+}
+
+type expvarRecorder struct {
+	m *expvar.Map
+}
+
+func (e expvarRecorder) RecordDecision(ctx context.Context, ms *Measurement) {
+	e.m.Add(string(ms.Outcome), 1)
+	if ms.Decision.Site == "" {
+		e.m.Add("missing-metadata", 1)
+	}
+}
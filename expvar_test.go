@@ -0,0 +1,57 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	p := ResourceIsolationPolicy(PublishExpvar("secfetch_test"))
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	send := func(h http.Handler, site string) {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("sec-fetch-site", site)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	send(p.Protect(noop), "")
+	send(p.Protect(noop), "same-origin")
+	send(p.Protect(noop), "cross-site")
+	send(p.ProtectLogOnly(noop, nil), "cross-site")
+	// Policies with the same name share counters.
+	send(ResourceIsolationPolicy(PublishExpvar("secfetch_test")).Protect(noop), "cross-site")
+
+	m := expvar.Get("secfetch_test").(*expvar.Map)
+	want := map[string]int64{"allowed": 2, "blocked": 2, "would-block": 1, "missing-metadata": 1}
+	for k, v := range want {
+		got, _ := m.Get(k).(*expvar.Int)
+		if got == nil || got.Value() != v {
+			t.Errorf("%s: got %v, want %d", k, got, v)
+		}
+	}
+}
+
+func TestPublishExpvarConflict(t *testing.T) {
+	expvar.NewInt("secfetch_test_conflict")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("PublishExpvar with a conflicting name didn't panic")
+		}
+	}()
+	PublishExpvar("secfetch_test_conflict")
+}
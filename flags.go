@@ -0,0 +1,90 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// A ModeProvider determines the mode requests are evaluated in, e.g. from the flags of a feature
+// flag service, so that enforcement can be ramped up with existing flag tooling.
+type ModeProvider interface {
+	// Mode returns the mode to evaluate r in. It is called for every request, so it should not
+	// block, e.g. by reading flag values cached by the SDK of the flag service. It must be safe
+	// for concurrent use.
+	Mode(r *http.Request) Mode
+}
+
+// The ModeProviderFunc type is an adapter to allow the use of ordinary functions as
+// ModeProviders.
+type ModeProviderFunc func(r *http.Request) Mode
+
+// Mode calls f(r).
+func (f ModeProviderFunc) Mode(r *http.Request) Mode {
+	return f(r)
+}
+
+// ProtectWithModeProvider isolates h from the requests rejected by p, in the mode returned by mp
+// for each request, see ProtectMode. Unknown modes are treated as Enforce.
+//
+// Flags can target users or request attributes, e.g. to enforce the policy for employees first:
+//
+//	h := p.ProtectWithModeProvider(mux, secfetch.ModeProviderFunc(func(r *http.Request) secfetch.Mode {
+//		if flags.BoolVariation("secfetch-enforce", userFromRequest(r), false) {
+//			return secfetch.Enforce
+//		}
+//		return secfetch.LogOnly
+//	}), logger)
+//
+// As with the other handlers, the mode of p caps the mode returned by mp, see Policy.SetMode.
+func (p *Policy) ProtectWithModeProvider(h http.Handler, mp ModeProvider, rl RequestLogger) http.Handler {
+	return p.protect(h, rl, func(r *http.Request) Mode {
+		m := mp.Mode(r)
+		if m < Enforce || m > Off {
+			return Enforce
+		}
+		return m
+	})
+}
+
+// WatchMode calls f every interval and sets the mode of p to the returned one, see SetMode,
+// until ctx is done. It is meant for flags that apply to the whole service rather than to
+// individual requests. Errors returned by f, and unknown modes, are passed to onError, which
+// may be nil, and leave the mode of p unchanged.
+func (p *Policy) WatchMode(ctx context.Context, interval time.Duration, f func(context.Context) (Mode, error), onError func(error)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		m, err := f(ctx)
+		if err == nil && (m < Enforce || m > Off) {
+			err = fmt.Errorf("secfetch: unknown mode %d", m)
+		}
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+		} else {
+			p.SetMode(m)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProtectWithModeProvider(t *testing.T) {
+	var rl countingRequestLogger
+	p := ResourceIsolationPolicy()
+	// Enforce for the users in the "beta" group only.
+	mp := ModeProviderFunc(func(r *http.Request) Mode {
+		switch r.Header.Get("X-Group") {
+		case "beta":
+			return Enforce
+		case "broken":
+			return 42
+		case "off":
+			return Off
+		}
+		return LogOnly
+	})
+	h := p.ProtectWithModeProvider(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), mp, &rl)
+	var tests = []struct {
+		group      string
+		wantCode   int
+		wantLogged int
+	}{
+		{group: "beta", wantCode: http.StatusForbidden},
+		{group: "", wantCode: http.StatusOK, wantLogged: 1},
+		{group: "broken", wantCode: http.StatusForbidden},
+		{group: "off", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		rl = 0
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("Sec-Fetch-Site", "cross-site")
+		r.Header.Set("X-Group", tt.group)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.wantCode || int(rl) != tt.wantLogged {
+			t.Errorf("group %q: got status %d and %d logged requests, want %d and %d", tt.group, w.Code, rl, tt.wantCode, tt.wantLogged)
+		}
+	}
+}
+
+func TestWatchMode(t *testing.T) {
+	p := ResourceIsolationPolicy()
+	results := make(chan struct {
+		m   Mode
+		err error
+	})
+	var errs []error
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.WatchMode(ctx, time.Millisecond, func(context.Context) (Mode, error) {
+			r := <-results
+			return r.m, r.err
+		}, func(err error) { errs = append(errs, err) })
+		close(done)
+	}()
+	send := func(m Mode, err error) {
+		results <- struct {
+			m   Mode
+			err error
+		}{m, err}
+	}
+	send(LogOnly, nil)
+	send(Enforce, errors.New("flag service unavailable"))
+	send(42, nil)
+	// The previous results are applied by the time the next one is requested.
+	send(Disabled, nil)
+	cancel()
+	<-done
+	if got := p.Mode(); got != Disabled {
+		t.Errorf("got mode %v, want %v", got, Disabled)
+	}
+	if len(errs) != 2 {
+		t.Errorf("got errors %v, want 2", errs)
+	}
+}
@@ -1,3 +1,8 @@
 module github.com/empijei/go-sec-fetch
 
-go 1.12
+go 1.22
+
+require (
+	go.yaml.in/yaml/v3 v3.0.5
+	golang.org/x/net v0.35.0
+)
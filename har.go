@@ -0,0 +1,285 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The types below are the subset of the HAR 1.2 format used to export and import requests, see
+// http://www.softwareishard.com/blog/har-12-spec/.
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+// modulePath is the path of this module, which is the creator of exported HAR files.
+const modulePath = "github.com/empijei/go-sec-fetch"
+
+// moduleVersion returns the version of this module in the running binary, or "(devel)" if it is
+// unknown.
+func moduleVersion() string {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Path == modulePath && bi.Main.Version != "" {
+			return bi.Main.Version
+		}
+		for _, m := range bi.Deps {
+			if m.Path == modulePath {
+				return m.Version
+			}
+		}
+	}
+	return "(devel)"
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harNameVal `json:"cookies"`
+	Headers     []harNameVal `json:"headers"`
+	QueryString []harNameVal `json:"queryString"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int          `json:"status"`
+	StatusText  string       `json:"statusText"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harNameVal `json:"cookies"`
+	Headers     []harNameVal `json:"headers"`
+	Content     harContent   `json:"content"`
+	RedirectURL string       `json:"redirectURL"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+type harNameVal struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HARRecorder is a RequestLogger and a ReportLogger that keeps the most recent rejected requests
+// to export them as a HAR file, which can be imported in browser developer tools and proxies to
+// inspect and replay them when investigating false positives.
+//
+// Requests passed to LogRequest are exported with all their headers, while Reports only hold
+// the Fetch Metadata, Origin, Referer and User-Agent headers. Bodies are exported if they were
+// captured with CaptureBody. Reports don't record the scheme of requests, which are exported as
+// https, as browsers only send Fetch Metadata to secure origins.
+type HARRecorder struct {
+	mu      sync.Mutex
+	max     int
+	entries []harEntry
+	next    int
+}
+
+// NewHARRecorder returns a HARRecorder that keeps the last max requests. NewHARRecorder panics
+// if max is not positive.
+func NewHARRecorder(max int) *HARRecorder {
+	if max <= 0 {
+		panic(fmt.Sprintf("secfetch: invalid HARRecorder size %d", max))
+	}
+	return &HARRecorder{max: max}
+}
+
+// LogRequest implements RequestLogger.
+func (h *HARRecorder) LogRequest(r *http.Request) {
+	d, _ := FromContext(r.Context())
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	req := harRequest{
+		Method:      r.Method,
+		URL:         scheme + "://" + r.Host + r.URL.RequestURI(),
+		HTTPVersion: r.Proto,
+		Headers:     []harNameVal{},
+		Cookies:     []harNameVal{},
+		QueryString: []harNameVal{},
+		HeadersSize: -1,
+		BodySize:    r.ContentLength,
+	}
+	for k, vs := range r.Header {
+		for _, v := range vs {
+			req.Headers = append(req.Headers, harNameVal{k, v})
+		}
+	}
+	sort.SliceStable(req.Headers, func(i, j int) bool { return req.Headers[i].Name < req.Headers[j].Name })
+	for _, c := range r.Cookies() {
+		req.Cookies = append(req.Cookies, harNameVal{c.Name, c.Value})
+	}
+	for k, vs := range r.URL.Query() {
+		for _, v := range vs {
+			req.QueryString = append(req.QueryString, harNameVal{k, v})
+		}
+	}
+	sort.SliceStable(req.QueryString, func(i, j int) bool { return req.QueryString[i].Name < req.QueryString[j].Name })
+	if b, ok := r.Body.(*capturedBody); ok {
+		req.PostData = harBody(r.Header.Get("Content-Type"), string(b.prefix), b.truncated)
+	}
+	h.add(time.Now(), req, d, false)
+}
+
+// LogReport implements ReportLogger.
+func (h *HARRecorder) LogReport(rep *Report) {
+	req := harRequest{
+		Method:      rep.Method,
+		URL:         "https://" + rep.Host + rep.Path,
+		HTTPVersion: "HTTP/1.1",
+		Headers:     []harNameVal{},
+		Cookies:     []harNameVal{},
+		QueryString: []harNameVal{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	for _, hv := range []harNameVal{
+		{"Sec-Fetch-Site", rep.Site},
+		{"Sec-Fetch-Mode", rep.Mode},
+		{"Sec-Fetch-Dest", rep.Dest},
+		{"Sec-Fetch-User", rep.User},
+		{"Origin", rep.Origin},
+		{"Referer", rep.Referer},
+		{"User-Agent", rep.UserAgent},
+	} {
+		if hv.Value != "" {
+			req.Headers = append(req.Headers, hv)
+		}
+	}
+	if rep.Body != "" {
+		req.PostData = harBody("", rep.Body, rep.BodyTruncated)
+	}
+	d := Decision{Rule: rep.Rule, Site: rep.Site, Mode: rep.Mode, Dest: rep.Dest, User: rep.User}
+	h.add(rep.Time, req, d, rep.Enforced)
+}
+
+func harBody(mimeType, text string, truncated bool) *harPostData {
+	pd := &harPostData{MimeType: mimeType, Text: text}
+	if truncated {
+		pd.Comment = "truncated"
+	}
+	return pd
+}
+
+func (h *HARRecorder) add(t time.Time, req harRequest, d Decision, enforced bool) {
+	e := harEntry{
+		StartedDateTime: t,
+		Request:         req,
+		Response: harResponse{
+			HTTPVersion: req.HTTPVersion,
+			Cookies:     []harNameVal{},
+			Headers:     []harNameVal{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Comment: "secfetch: would-block; rule=" + string(d.Rule),
+	}
+	if enforced {
+		// The actual response depends on the deny options of the policy, only its outcome is
+		// known.
+		e.Response.Status = http.StatusForbidden
+		e.Response.StatusText = http.StatusText(http.StatusForbidden)
+		e.Comment = "secfetch: " + d.String()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) < h.max {
+		h.entries = append(h.entries, e)
+		return
+	}
+	h.entries[h.next] = e
+	h.next = (h.next + 1) % h.max
+}
+
+// WriteTo writes the recorded requests to w as a HAR file, oldest first.
+func (h *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	h.mu.Lock()
+	entries := make([]harEntry, 0, len(h.entries))
+	entries = append(entries, h.entries[h.next:]...)
+	entries = append(entries, h.entries[:h.next]...)
+	h.mu.Unlock()
+
+	f := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: modulePath, Version: moduleVersion()},
+		Entries: entries,
+	}}
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// Handler returns a handler that serves the recorded requests as a HAR file download.
+//
+// The response discloses details of the rejected requests, possibly including credentials, so
+// the handler must only be served to administrators, e.g. on an internal port. See RedactHeaders.
+func (h *HARRecorder) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="secfetch.har"`)
+		w.Header().Set("Cache-Control", "no-store")
+		h.WriteTo(w)
+	})
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeHAR serves the HAR file of h and decodes it.
+func decodeHAR(t *testing.T, h *HARRecorder) harFile {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/har", nil))
+	if got := w.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment") {
+		t.Errorf("got Content-Disposition %q", got)
+	}
+	var f harFile
+	if err := json.Unmarshal(w.Body.Bytes(), &f); err != nil {
+		t.Fatalf("cannot decode %q: %v", w.Body, err)
+	}
+	return f
+}
+
+func TestHARRecorder(t *testing.T) {
+	har := NewHARRecorder(10)
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	p := ResourceIsolationPolicy(CaptureBody(5), ReportTo(har))
+
+	r := httptest.NewRequest("POST", "https://example.com/transfer?to=bob", strings.NewReader("amount=100"))
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Cookie", "sid=1")
+	p.ProtectLogOnly(noop, har).ServeHTTP(httptest.NewRecorder(), r)
+
+	f := decodeHAR(t, har)
+	if f.Log.Version != "1.2" || f.Log.Creator.Name != modulePath {
+		t.Errorf("got log %+v", f.Log)
+	}
+	if len(f.Log.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(f.Log.Entries))
+	}
+	// The report is sent before the request is logged.
+	rep, req := f.Log.Entries[0], f.Log.Entries[1]
+
+	if got, want := rep.Request.Headers, []harNameVal{{"Sec-Fetch-Site", "cross-site"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("report headers: got %v, want %v", got, want)
+	}
+	if rep.Request.URL != "https://example.com/transfer" || rep.Comment != "secfetch: would-block; rule=cross-site-method" {
+		t.Errorf("report entry: got %+v", rep)
+	}
+
+	if req.Request.Method != "POST" || req.Request.URL != "https://example.com/transfer?to=bob" {
+		t.Errorf("request entry: got %s %s", req.Request.Method, req.Request.URL)
+	}
+	wantHeaders := []harNameVal{
+		{"Content-Type", "application/x-www-form-urlencoded"},
+		{"Cookie", "sid=1"},
+		{"Sec-Fetch-Site", "cross-site"},
+	}
+	if !reflect.DeepEqual(req.Request.Headers, wantHeaders) {
+		t.Errorf("request headers: got %v, want %v", req.Request.Headers, wantHeaders)
+	}
+	if got, want := req.Request.Cookies, []harNameVal{{"sid", "1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cookies: got %v, want %v", got, want)
+	}
+	if got, want := req.Request.QueryString, []harNameVal{{"to", "bob"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("query: got %v, want %v", got, want)
+	}
+	wantBody := &harPostData{MimeType: "application/x-www-form-urlencoded", Text: "amoun", Comment: "truncated"}
+	if !reflect.DeepEqual(req.Request.PostData, wantBody) {
+		t.Errorf("body: got %+v, want %+v", req.Request.PostData, wantBody)
+	}
+}
+
+func TestHARRecorderEnforced(t *testing.T) {
+	har := NewHARRecorder(2)
+	h := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), ReportTo(har))
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("POST", fmt.Sprintf("/%d", i), nil)
+		r.Header.Set("Sec-Fetch-Site", "cross-site")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	f := decodeHAR(t, har)
+	var urls []string
+	for _, e := range f.Log.Entries {
+		urls = append(urls, e.Request.URL)
+		if e.Response.Status != http.StatusForbidden || e.Comment != "secfetch: blocked; rule=cross-site-method" {
+			t.Errorf("entry %s: got response %+v, comment %q", e.Request.URL, e.Response, e.Comment)
+		}
+	}
+	if want := []string{"https://example.com/1", "https://example.com/2"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("got entries %v, want %v", urls, want)
+	}
+}
+
+func TestNewHARRecorderInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewHARRecorder(0) didn't panic")
+		}
+	}()
+	NewHARRecorder(0)
+}
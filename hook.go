@@ -0,0 +1,52 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import "net/http"
+
+// OnAllow makes the policy call f with every request it allows, and the Decision that allowed it,
+// before the request is served.
+//
+// Hooks are called synchronously by Protect, ProtectLogOnly and Evaluate, after the Decision has
+// been stored in the context of r, see FromContext, so they should not block.
+func OnAllow(f func(r *http.Request, d Decision)) Option {
+	return func(p *Policy) {
+		p.onAllow = append(p.onAllow, f)
+	}
+}
+
+// OnBlock makes the policy call f with every request it rejects, and the Decision that rejected
+// it, before the response is served. enforced reports whether the request is actually rejected,
+// as opposed to only logged in log-only mode.
+//
+// OnBlock is meant for custom telemetry and escalation, e.g. to flag the client to a WAF. See
+// OnAllow for the calling conventions of hooks.
+func OnBlock(f func(r *http.Request, d Decision, enforced bool)) Option {
+	return func(p *Policy) {
+		p.onBlock = append(p.onBlock, f)
+	}
+}
+
+func (p *Policy) runHooks(r *http.Request, d Decision, m Mode) {
+	if d.Allowed {
+		for _, f := range p.onAllow {
+			f(r, d)
+		}
+		return
+	}
+	for _, f := range p.onBlock {
+		f(r, d, m == Enforce)
+	}
+}
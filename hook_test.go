@@ -0,0 +1,95 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	type call struct {
+		hook     string
+		path     string
+		rule     Rule
+		enforced bool
+	}
+	var calls []call
+	p := ResourceIsolationPolicy(
+		OnAllow(func(r *http.Request, d Decision) {
+			if cd, ok := FromContext(r.Context()); !ok || cd != d {
+				t.Errorf("OnAllow: got context decision %v, want %v", cd, d)
+			}
+			calls = append(calls, call{hook: "allow", path: r.URL.Path, rule: d.Rule})
+		}),
+		OnBlock(func(r *http.Request, d Decision, enforced bool) {
+			calls = append(calls, call{hook: "block", path: r.URL.Path, rule: d.Rule, enforced: enforced})
+		}),
+		OnBlock(func(r *http.Request, d Decision, enforced bool) {
+			calls = append(calls, call{hook: "block2", path: r.URL.Path, rule: d.Rule, enforced: enforced})
+		}),
+	)
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var tests = []struct {
+		name, path, site string
+		h                http.Handler
+		want             []call
+	}{
+		{
+			name: "allowed",
+			path: "/allowed",
+			site: "same-origin",
+			h:    p.Protect(noop),
+			want: []call{{hook: "allow", path: "/allowed", rule: RuleTrustedSite}},
+		},
+		{
+			name: "blocked",
+			path: "/blocked",
+			site: "cross-site",
+			h:    p.Protect(noop),
+			want: []call{
+				{hook: "block", path: "/blocked", rule: RuleCrossSiteMethod, enforced: true},
+				{hook: "block2", path: "/blocked", rule: RuleCrossSiteMethod, enforced: true},
+			},
+		},
+		{
+			name: "would block",
+			path: "/would-block",
+			site: "cross-site",
+			h:    p.ProtectLogOnly(noop, nil),
+			want: []call{
+				{hook: "block", path: "/would-block", rule: RuleCrossSiteMethod},
+				{hook: "block2", path: "/would-block", rule: RuleCrossSiteMethod},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			r := httptest.NewRequest("POST", tt.path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			tt.h.ServeHTTP(httptest.NewRecorder(), r)
+			if len(calls) != len(tt.want) {
+				t.Fatalf("got calls %+v, want %+v", calls, tt.want)
+			}
+			for i := range calls {
+				if calls[i] != tt.want[i] {
+					t.Errorf("call %d: got %+v, want %+v", i, calls[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
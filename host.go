@@ -0,0 +1,54 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ProtectHosts isolates h with a different Policy depending on the host requests are sent to,
+// for servers that serve several domains with different requirements.
+//
+// Keys of policies are host names without ports, e.g. "api.example.com". A key starting with
+// "*." matches all subdomains of the rest of the key, e.g. "*.example.com" matches
+// "a.example.com" and "a.b.example.com" but not "example.com"; exact keys take precedence over
+// wildcards, and longer wildcards over shorter ones. Requests for hosts that don't match any key
+// are protected by fallback, or by the default ResourceIsolationPolicy if fallback is nil.
+func ProtectHosts(h http.Handler, policies map[string]*Policy, fallback *Policy) http.Handler {
+	if fallback == nil {
+		fallback = ResourceIsolationPolicy()
+	}
+	handlers := make(map[string]http.Handler, len(policies))
+	for host, p := range policies {
+		handlers[strings.ToLower(host)] = p.Protect(h)
+	}
+	fh := fallback.Protect(h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.TrimSuffix(strings.ToLower(hostname(r.Host)), ".")
+		if ph, ok := handlers[host]; ok {
+			ph.ServeHTTP(w, r)
+			return
+		}
+		for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+			host = host[i+1:]
+			if ph, ok := handlers["*."+host]; ok {
+				ph.ServeHTTP(w, r)
+				return
+			}
+		}
+		fh.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtectHosts(t *testing.T) {
+	h := ProtectHosts(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		map[string]*Policy{
+			"api.example.com":   ResourceIsolationPolicy(DenyStatus(http.StatusBadRequest)),
+			"*.example.com":     ResourceIsolationPolicy(DenyStatus(http.StatusNotFound)),
+			"*.cdn.example.com": ResourceIsolationPolicy(ExemptPaths("/**")),
+		},
+		ResourceIsolationPolicy(DenyStatus(http.StatusTeapot)))
+	var tests = []struct {
+		host string
+		want int
+	}{
+		{host: "api.example.com", want: http.StatusBadRequest},
+		{host: "API.example.com:8443", want: http.StatusBadRequest},
+		{host: "api.example.com.", want: http.StatusBadRequest},
+		{host: "app.example.com", want: http.StatusNotFound},
+		{host: "a.b.example.com", want: http.StatusNotFound},
+		{host: "img.cdn.example.com", want: http.StatusOK},
+		{host: "example.com", want: http.StatusTeapot},
+		{host: "evil-example.com", want: http.StatusTeapot},
+		{host: "", want: http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Host = tt.host
+			r.Header.Set("sec-fetch-site", "cross-site")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+
+	// The default fallback is the resource isolation policy.
+	h = ProtectHosts(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), nil, nil)
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("sec-fetch-site", "cross-site")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("default fallback: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
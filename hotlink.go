@@ -0,0 +1,55 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import "net/http"
+
+// BlockImageHotlinking rejects cross-site requests for images, i.e. the ones with the "image"
+// destination, so other sites cannot embed the images of the application. Same-site requests are
+// evaluated as usual.
+//
+// If placeholder is not nil, it is served instead of the usual response to rejected requests,
+// with the 403 status and the content type detected by http.DetectContentType, so that other
+// sites display it in place of the requested images.
+//
+// BlockImageHotlinking is a destination block, see BlockScriptInclusion for the evaluation order.
+// Rejected requests are reported with RuleImageHotlink.
+func BlockImageHotlinking(placeholder []byte) Option {
+	var ct string
+	if placeholder != nil {
+		ct = http.DetectContentType(placeholder)
+	}
+	return func(p *Policy) {
+		p.blockDest("image", RuleImageHotlink, false)
+		p.hotlinkImage = placeholder
+		p.hotlinkType = ct
+	}
+}
+
+// serveHotlinkPlaceholder serves the placeholder of BlockImageHotlinking to r if it was rejected
+// as a hotlink, and reports whether it did.
+func (p *Policy) serveHotlinkPlaceholder(w http.ResponseWriter, r *http.Request) bool {
+	if p.hotlinkImage == nil {
+		return false
+	}
+	if d, ok := FromContext(r.Context()); !ok || d.Rule != RuleImageHotlink {
+		return false
+	}
+	w.Header().Set("Content-Type", p.hotlinkType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusForbidden)
+	w.Write(p.hotlinkImage)
+	return true
+}
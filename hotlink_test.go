@@ -0,0 +1,66 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBlockImageHotlinking(t *testing.T) {
+	gif := []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var tests = []struct {
+		name, site, mode, dest string
+		placeholder            []byte
+		wantStatus             int
+		wantType               string
+		wantBody               []byte
+	}{
+		{name: "cross-site image", site: "cross-site", mode: "no-cors", dest: "image", wantStatus: http.StatusForbidden, wantType: "text/plain; charset=utf-8"},
+		{name: "placeholder", site: "cross-site", mode: "no-cors", dest: "image", placeholder: gif, wantStatus: http.StatusForbidden, wantType: "image/gif", wantBody: gif},
+		{name: "same-site image", site: "same-site", mode: "no-cors", dest: "image", placeholder: gif, wantStatus: http.StatusOK},
+		{name: "cross-site script", site: "cross-site", mode: "no-cors", dest: "script", placeholder: gif, wantStatus: http.StatusOK},
+		{name: "cross-site navigation", site: "cross-site", mode: "navigate", dest: "document", placeholder: gif, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Images and scripts would otherwise be allowed.
+			p := ResourceIsolationPolicy(AllowStaticAssets("/"), BlockImageHotlinking(tt.placeholder))
+			r := httptest.NewRequest("GET", "/logo.png", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			w := httptest.NewRecorder()
+			p.Protect(noop).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantType != "" && w.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("got Content-Type %q, want %q", w.Header().Get("Content-Type"), tt.wantType)
+			}
+			if tt.wantBody != nil && !bytes.Equal(w.Body.Bytes(), tt.wantBody) {
+				t.Errorf("got body %q, want %q", w.Body.Bytes(), tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusForbidden {
+				if d := p.Check(r); d.Rule != RuleImageHotlink {
+					t.Errorf("got %v, want rule %q", d, RuleImageHotlink)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import "net/http"
+
+// RejectMalformedMetadata makes the policy reject requests with malformed Fetch Metadata, which
+// are otherwise evaluated like well-formed ones, and may fall into more permissive paths:
+//   - duplicated Fetch Metadata headers;
+//   - values not defined by the Fetch Metadata specification and the Fetch standard;
+//   - contradictory values, like Sec-Fetch-Mode without Sec-Fetch-Site, Sec-Fetch-User on
+//     requests that are not navigations, or navigations to destinations that can't be navigated.
+//
+// Browsers never send such requests, so they are either forged or mangled by proxies. New
+// destinations are occasionally added to the standard, so requests from future browsers may be
+// rejected until this package is updated.
+func RejectMalformedMetadata() Option {
+	return func(p *Policy) {
+		p.rejectMalformed = true
+	}
+}
+
+// navigableDests are the destinations of navigations.
+var navigableDests = map[string]bool{
+	"document": true, "embed": true, "fencedframe": true, "frame": true, "iframe": true,
+	"object": true,
+}
+
+func (p *Policy) checkMalformed(r *http.Request, d *Decision) (Rule, bool) {
+	if p.rejectMalformed && malformed(r, d) {
+		return RuleMalformedMetadata, false
+	}
+	return "", true
+}
+
+// malformed reports whether r carries malformed Fetch Metadata.
+func malformed(r *http.Request, d *Decision) bool {
+	for _, h := range [...]string{"Sec-Fetch-Site", "Sec-Fetch-Mode", "Sec-Fetch-Dest", "Sec-Fetch-User"} {
+		if len(r.Header.Values(h)) > 1 {
+			return true
+		}
+	}
+	if d.Site == "" {
+		return d.Mode != "" || d.Dest != "" || d.User != ""
+	}
+	if !knownSites[d.Site] || d.Mode != "" && !knownModes[d.Mode] || d.Dest != "" && !knownDests[d.Dest] {
+		return true
+	}
+	if d.User != "" && (d.User != "?1" || !isNavigation(d.Mode)) {
+		return true
+	}
+	return isNavigation(d.Mode) && d.Dest != "" && !navigableDests[d.Dest]
+}
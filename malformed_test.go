@@ -0,0 +1,61 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRejectMalformedMetadata(t *testing.T) {
+	var tests = []struct {
+		name    string
+		headers [][2]string
+		want    bool
+	}{
+		{name: "well-formed navigation", headers: [][2]string{{"Sec-Fetch-Site", "same-origin"}, {"Sec-Fetch-Mode", "navigate"}, {"Sec-Fetch-Dest", "document"}, {"Sec-Fetch-User", "?1"}}, want: true},
+		{name: "well-formed fetch", headers: [][2]string{{"Sec-Fetch-Site", "same-site"}, {"Sec-Fetch-Mode", "cors"}, {"Sec-Fetch-Dest", "empty"}}, want: true},
+		{name: "site only", headers: [][2]string{{"Sec-Fetch-Site", "same-origin"}}, want: true},
+		{name: "no metadata", want: true},
+		{name: "duplicated site", headers: [][2]string{{"Sec-Fetch-Site", "same-origin"}, {"Sec-Fetch-Site", "cross-site"}}},
+		{name: "unknown site", headers: [][2]string{{"Sec-Fetch-Site", "same-origin-ish"}}},
+		{name: "unknown mode", headers: [][2]string{{"Sec-Fetch-Site", "same-origin"}, {"Sec-Fetch-Mode", "teleport"}}},
+		{name: "unknown dest", headers: [][2]string{{"Sec-Fetch-Site", "same-origin"}, {"Sec-Fetch-Dest", "hologram"}}},
+		{name: "mode without site", headers: [][2]string{{"Sec-Fetch-Mode", "cors"}}},
+		{name: "invalid user", headers: [][2]string{{"Sec-Fetch-Site", "same-origin"}, {"Sec-Fetch-Mode", "navigate"}, {"Sec-Fetch-User", "?0"}}},
+		{name: "user without navigation", headers: [][2]string{{"Sec-Fetch-Site", "same-origin"}, {"Sec-Fetch-Mode", "cors"}, {"Sec-Fetch-User", "?1"}}},
+		{name: "navigation to image", headers: [][2]string{{"Sec-Fetch-Site", "same-origin"}, {"Sec-Fetch-Mode", "navigate"}, {"Sec-Fetch-Dest", "image"}}},
+	}
+	p := ResourceIsolationPolicy(RejectMalformedMetadata())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			for _, h := range tt.headers {
+				r.Header.Add(h[0], h[1])
+			}
+			d := p.Check(r)
+			if d.Allowed != tt.want {
+				t.Errorf("got %v, want allowed %v", d, tt.want)
+			}
+			if !tt.want && d.Rule != RuleMalformedMetadata {
+				t.Errorf("got rule %q, want %q", d.Rule, RuleMalformedMetadata)
+			}
+			// Without the option, the same requests are evaluated normally.
+			if d := ResourceIsolationPolicy().Check(r); d.Rule == RuleMalformedMetadata {
+				t.Errorf("got %v without RejectMalformedMetadata", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultDenyMessage is the message of the default plain text response to rejected requests.
+const defaultDenyMessage = "Invalid resource access"
+
+// A MessageCatalog provides the localized messages sent to users whose requests are rejected.
+type MessageCatalog interface {
+	// DenyMessage returns the message for the language tag lang, e.g. "fr" or "pt-BR", and
+	// whether the catalog has one. lang is spelled as sent by the client, so tags should be
+	// compared case-insensitively.
+	DenyMessage(lang string) (string, bool)
+}
+
+// Messages is a MessageCatalog that maps language tags to messages.
+type Messages map[string]string
+
+// DenyMessage implements MessageCatalog, comparing tags case-insensitively.
+func (m Messages) DenyMessage(lang string) (string, bool) {
+	if msg, ok := m[lang]; ok {
+		return msg, true
+	}
+	for l, msg := range m {
+		if strings.EqualFold(l, lang) {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// LocalizeDeny makes the policy localize the message of the plain text response to rejected
+// requests, and the DenyPage.Message passed to DenyTemplate, according to the Accept-Language
+// header of requests, for sites whose users may end up on the deny response.
+//
+// Languages are tried in order of preference, each one first with its full tag and then with its
+// primary subtag, e.g. "fr-CA" and then "fr". The default English message is used if c has no
+// message for any of them. Responses carry the language of the message in the Content-Language
+// header. The JSON responses sent to API clients are not localized, see DenyJSON.
+func LocalizeDeny(c MessageCatalog) Option {
+	return func(p *Policy) {
+		p.messages = c
+	}
+}
+
+// denyMessage returns the message for r and its language, or "" if it is the default one.
+func (p *Policy) denyMessage(r *http.Request) (msg, lang string) {
+	if p.messages == nil {
+		return defaultDenyMessage, ""
+	}
+	for _, l := range acceptedLanguages(r.Header.Values("Accept-Language")) {
+		if msg, ok := p.messages.DenyMessage(l); ok {
+			return msg, l
+		}
+		if base, _, ok := strings.Cut(l, "-"); ok {
+			if msg, ok := p.messages.DenyMessage(base); ok {
+				return msg, base
+			}
+		}
+	}
+	return defaultDenyMessage, ""
+}
+
+// acceptedLanguages returns the language tags of Accept-Language header values, sorted by
+// decreasing quality. Wildcards and languages with zero quality are omitted.
+func acceptedLanguages(vs []string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var ls []weighted
+	for _, v := range vs {
+		for _, l := range strings.Split(v, ",") {
+			tag, params, _ := strings.Cut(l, ";")
+			tag = strings.TrimSpace(tag)
+			if tag == "" || tag == "*" {
+				continue
+			}
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.EqualFold(k, "q") {
+					if f, err := strconv.ParseFloat(v, 64); err == nil {
+						q = f
+					}
+				}
+			}
+			if q <= 0 {
+				continue
+			}
+			ls = append(ls, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(ls, func(i, j int) bool { return ls[i].q > ls[j].q })
+	tags := make([]string, len(ls))
+	for i, l := range ls {
+		tags[i] = l.tag
+	}
+	return tags
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAcceptedLanguages(t *testing.T) {
+	var tests = []struct {
+		name string
+		vs   []string
+		want []string
+	}{
+		{name: "none", want: []string{}},
+		{name: "single", vs: []string{"fr"}, want: []string{"fr"}},
+		{name: "quality", vs: []string{"en;q=0.5, fr-CA, de;q=0.8"}, want: []string{"fr-CA", "de", "en"}},
+		{name: "stable", vs: []string{"it, es"}, want: []string{"it", "es"}},
+		{name: "multiple headers", vs: []string{"it;q=0.1", "es"}, want: []string{"es", "it"}},
+		{name: "wildcard and zero", vs: []string{"*, de;q=0, nl ; q=0.3"}, want: []string{"nl"}},
+		{name: "malformed quality", vs: []string{"pl;q=abc, ,"}, want: []string{"pl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acceptedLanguages(tt.vs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalizeDeny(t *testing.T) {
+	msgs := Messages{"fr": "Accès refusé", "pt-BR": "Acesso negado"}
+	var tests = []struct {
+		name     string
+		lang     string
+		id       string
+		wantLang string
+		wantBody string
+	}{
+		{name: "default", wantBody: "Invalid resource access\n"},
+		{name: "unknown", lang: "de, ja", wantBody: "Invalid resource access\n"},
+		{name: "exact", lang: "pt-BR", wantLang: "pt-BR", wantBody: "Acesso negado\n"},
+		{name: "case insensitive", lang: "PT-br", wantLang: "PT-br", wantBody: "Acesso negado\n"},
+		{name: "primary subtag", lang: "de;q=0.5, fr-CA", wantLang: "fr", wantBody: "Accès refusé\n"},
+		{name: "request ID", lang: "fr", id: "abc", wantLang: "fr", wantBody: "Accès refusé (request ID abc)\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{LocalizeDeny(msgs)}
+			if tt.id != "" {
+				opts = append(opts, CorrelateRequests())
+			}
+			h := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), opts...)
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("Sec-Fetch-Site", "cross-site")
+			if tt.lang != "" {
+				r.Header.Set("Accept-Language", tt.lang)
+			}
+			if tt.id != "" {
+				r.Header.Set("X-Request-Id", tt.id)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Header().Get("Content-Language"); got != tt.wantLang {
+				t.Errorf("got Content-Language %q, want %q", got, tt.wantLang)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("got body %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestLocalizeDenyTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("deny").Parse(`<p>{{.Message}}</p>`))
+	h := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		DenyTemplate(tmpl), LocalizeDeny(Messages{"it": "Accesso <negato>"}))
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	r.Header.Set("Accept-Language", "it-IT")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got, want := w.Body.String(), "<p>Accesso &lt;negato&gt;</p>"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Content-Language"); got != "it" {
+		t.Errorf("got Content-Language %q, want %q", got, "it")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"time"
+)
+
+// An Outcome is the effect a Decision had on a request.
+type Outcome string
+
+// Outcomes of decisions.
+const (
+	OutcomeAllowed    Outcome = "allowed"
+	OutcomeBlocked    Outcome = "blocked"
+	OutcomeWouldBlock Outcome = "would-block"
+)
+
+// A Measurement describes the evaluation of a request by a policy.
+type Measurement struct {
+	Decision Decision
+	Mode     Mode
+	Outcome  Outcome
+	// Elapsed is the time it took to evaluate the request.
+	Elapsed time.Duration
+}
+
+// A MetricsRecorder records the evaluations performed by a policy, e.g. to export them as
+// metrics. See the secfetchprom package for a Prometheus implementation.
+type MetricsRecorder interface {
+	// RecordDecision is called for every request evaluated by Protect and ProtectLogOnly, and
+	// by handlers in Disabled mode.
+	// It must be safe for concurrent use.
+	RecordDecision(ctx context.Context, m *Measurement)
+}
+
+// RecordMetrics makes the policy send a Measurement to each of mrs for every evaluated request.
+func RecordMetrics(mrs ...MetricsRecorder) Option {
+	return func(p *Policy) {
+		p.metrics = append(p.metrics, mrs...)
+	}
+}
+
+func outcome(d Decision, m Mode) Outcome {
+	switch {
+	case d.Allowed:
+		return OutcomeAllowed
+	case m == Enforce:
+		return OutcomeBlocked
+	}
+	return OutcomeWouldBlock
+}
+
+// Header values defined by the Fetch Metadata specification and the Fetch standard.
+var (
+	knownSites = map[string]bool{"cross-site": true, "same-origin": true, "same-site": true, "none": true}
+	knownModes = map[string]bool{
+		"cors": true, "navigate": true, "nested-navigate": true, "no-cors": true,
+		"same-origin": true, "websocket": true,
+	}
+	knownDests = map[string]bool{
+		"audio": true, "audioworklet": true, "document": true, "embed": true, "empty": true,
+		"fencedframe": true, "font": true, "frame": true, "iframe": true, "image": true, "json": true,
+		"manifest": true, "object": true, "paintworklet": true, "report": true, "script": true,
+		"serviceworker": true, "sharedworker": true, "style": true, "track": true, "video": true,
+		"webidentity": true, "worker": true, "xslt": true,
+	}
+)
+
+// Canonical returns a copy of d in which the Fetch Metadata values that are not defined by the
+// specification are replaced by "other". Missing values are preserved.
+//
+// Fetch Metadata headers are controlled by clients, so this should be used before using them as
+// metric labels or aggregation keys, to bound their cardinality.
+func (d Decision) Canonical() Decision {
+	d.Site = canonical(knownSites, d.Site)
+	d.Mode = canonical(knownModes, d.Mode)
+	d.Dest = canonical(knownDests, d.Dest)
+	if d.User != "" && d.User != "?1" {
+		d.User = "other"
+	}
+	return d
+}
+
+func canonical(known map[string]bool, v string) string {
+	if v == "" || known[v] {
+		return v
+	}
+	return "other"
+}
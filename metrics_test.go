@@ -0,0 +1,77 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testMetricsRecorder struct {
+	ms []Measurement
+}
+
+func (t *testMetricsRecorder) RecordDecision(ctx context.Context, m *Measurement) {
+	t.ms = append(t.ms, *m)
+}
+
+func TestRecordMetrics(t *testing.T) {
+	var tm testMetricsRecorder
+	p := ResourceIsolationPolicy(RecordMetrics(&tm))
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var tests = []struct {
+		name, site string
+		h          http.Handler
+		mode       Mode
+		want       Outcome
+	}{
+		{name: "allowed", site: "same-origin", h: p.Protect(noop), mode: Enforce, want: OutcomeAllowed},
+		{name: "blocked", site: "cross-site", h: p.Protect(noop), mode: Enforce, want: OutcomeBlocked},
+		{name: "log only allowed", site: "same-origin", h: p.ProtectLogOnly(noop, nil), mode: LogOnly, want: OutcomeAllowed},
+		{name: "would block", site: "cross-site", h: p.ProtectLogOnly(noop, nil), mode: LogOnly, want: OutcomeWouldBlock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm.ms = nil
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			tt.h.ServeHTTP(httptest.NewRecorder(), r)
+			if len(tm.ms) != 1 {
+				t.Fatalf("got %d measurements, want 1", len(tm.ms))
+			}
+			m := tm.ms[0]
+			if m.Mode != tt.mode || m.Outcome != tt.want || m.Decision != p.Check(r) {
+				t.Errorf("got %+v, want mode %v and outcome %v", m, tt.mode, tt.want)
+			}
+			if m.Elapsed < 0 {
+				t.Errorf("got negative elapsed time %v", m.Elapsed)
+			}
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	d := Decision{Site: "cross-site", Mode: "navigate", Dest: "", User: "?1"}
+	if got := d.Canonical(); got != d {
+		t.Errorf("Canonical(%+v): got %+v", d, got)
+	}
+	d = Decision{Site: "cross-origin", Mode: "x", Dest: "<script>", User: "?0"}
+	want := Decision{Site: "other", Mode: "other", Dest: "other", User: "other"}
+	if got := d.Canonical(); got != want {
+		t.Errorf("Canonical(%+v): got %+v, want %+v", d, got, want)
+	}
+}
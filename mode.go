@@ -0,0 +1,78 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import "fmt"
+
+// Mode is the enforcement mode a policy is applied with.
+type Mode int
+
+// Enforcement modes.
+const (
+	// Enforce rejects the requests that are not allowed by the policy.
+	Enforce Mode = iota
+	// LogOnly only logs the requests that are not allowed by the policy, see
+	// Policy.ProtectLogOnly.
+	LogOnly
+	// Disabled lets all requests through without logging them, but still evaluates them and
+	// records the decisions in metrics and statistics, see RecordMetrics and StatsHandler, to
+	// measure how many requests a policy would reject before rolling it out, even in LogOnly mode.
+	Disabled
+	// Off disables the policy: requests are neither evaluated nor logged.
+	Off
+)
+
+// String returns "enforce", "log-only", "disabled" or "off".
+func (m Mode) String() string {
+	switch m {
+	case Enforce:
+		return "enforce"
+	case LogOnly:
+		return "log-only"
+	case Disabled:
+		return "disabled"
+	case Off:
+		return "off"
+	}
+	return "unknown"
+}
+
+// WithMode sets the initial mode of the policy, see Policy.SetMode. The default is Enforce.
+func WithMode(m Mode) Option {
+	return func(p *Policy) {
+		p.SetMode(m)
+	}
+}
+
+// SetMode atomically switches the mode of p, e.g. to downgrade it to LogOnly during an incident
+// without redeploying. It can be called while p is serving requests.
+//
+// The mode of p caps the mode of all the handlers it returned: with LogOnly, handlers returned
+// by Protect and ProtectRollout only log rejected requests, with Disabled all handlers let every
+// request through and only record decisions, and with Off all handlers let every request through
+// without evaluating it. Switching back to Enforce restores the handlers to
+// their own mode, so handlers returned by ProtectLogOnly are never enforced.
+// SetMode panics if m is not a known Mode.
+func (p *Policy) SetMode(m Mode) {
+	if m < Enforce || m > Off {
+		panic(fmt.Sprintf("secfetch: unknown mode %d", m))
+	}
+	p.mode.Store(int32(m))
+}
+
+// Mode returns the current mode of p.
+func (p *Policy) Mode() Mode {
+	return Mode(p.mode.Load())
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithMode(t *testing.T) {
+	var tests = []struct {
+		mode Mode
+		want int
+	}{
+		{mode: Enforce, want: http.StatusForbidden},
+		{mode: LogOnly, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			var rl testReportLogger
+			h := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+				WithMode(tt.mode), ReportTo(&rl))
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if len(rl.reps) != 1 || rl.reps[0].Enforced != (tt.mode == Enforce) {
+				t.Errorf("got reports %+v, want one with enforced %v", rl.reps, tt.mode == Enforce)
+			}
+		})
+	}
+}
+
+// countingRequestLogger counts logged requests.
+type countingRequestLogger int
+
+func (c *countingRequestLogger) LogRequest(*http.Request) { *c++ }
+
+func TestProtectHandlerMode(t *testing.T) {
+	var tests = []struct {
+		mode        Mode
+		wantCode    int
+		wantReports int
+		wantLogged  int
+		wantMetrics []Outcome
+	}{
+		{mode: Enforce, wantCode: http.StatusForbidden, wantReports: 1, wantMetrics: []Outcome{OutcomeBlocked}},
+		{mode: LogOnly, wantCode: http.StatusOK, wantReports: 1, wantLogged: 1, wantMetrics: []Outcome{OutcomeWouldBlock}},
+		{mode: Disabled, wantCode: http.StatusOK, wantMetrics: []Outcome{OutcomeWouldBlock}},
+		{mode: Off, wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			var (
+				rep testReportLogger
+				rl  countingRequestLogger
+				mr  testMetricsRecorder
+				hd  bool
+			)
+			h := ProtectHandlerMode(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, hd = FromContext(r.Context())
+			}), tt.mode, &rl, ReportTo(&rep), RecordMetrics(&mr), DebugHeader())
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("Sec-Fetch-Site", "cross-site")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantCode {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantCode)
+			}
+			if len(rep.reps) != tt.wantReports || int(rl) != tt.wantLogged {
+				t.Errorf("got %d reports and %d logged requests, want %d and %d", len(rep.reps), rl, tt.wantReports, tt.wantLogged)
+			}
+			if len(mr.ms) != len(tt.wantMetrics) || len(mr.ms) == 1 && (mr.ms[0].Outcome != tt.wantMetrics[0] || mr.ms[0].Mode != tt.mode) {
+				t.Errorf("got measurements %+v, want outcomes %v", mr.ms, tt.wantMetrics)
+			}
+			if got, want := w.Header().Get("X-SecFetch-Decision") != "", tt.mode < Disabled; got != want {
+				t.Errorf("got debug header %v, want %v", got, want)
+			}
+			if tt.wantCode == http.StatusOK && hd != (tt.mode != Off) {
+				t.Errorf("got decision in context %v, want %v", hd, tt.mode != Off)
+			}
+		})
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("ProtectHandlerMode(42): got no panic")
+		}
+	}()
+	ProtectHandlerMode(http.NotFoundHandler(), 42, nil)
+}
+
+func TestSetMode(t *testing.T) {
+	var rl testReportLogger
+	p := ResourceIsolationPolicy(ReportTo(&rl))
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	enforced := p.Protect(noop)
+	logOnly := p.ProtectLogOnly(noop, nil)
+	var tests = []struct {
+		mode         Mode
+		wantEnforced int
+		wantLogOnly  int
+		wantReports  int
+	}{
+		{mode: Enforce, wantEnforced: http.StatusForbidden, wantLogOnly: http.StatusOK, wantReports: 2},
+		{mode: LogOnly, wantEnforced: http.StatusOK, wantLogOnly: http.StatusOK, wantReports: 2},
+		{mode: Disabled, wantEnforced: http.StatusOK, wantLogOnly: http.StatusOK, wantReports: 0},
+		{mode: Off, wantEnforced: http.StatusOK, wantLogOnly: http.StatusOK, wantReports: 0},
+		{mode: Enforce, wantEnforced: http.StatusForbidden, wantLogOnly: http.StatusOK, wantReports: 2},
+	}
+	for _, tt := range tests {
+		p.SetMode(tt.mode)
+		if got := p.Mode(); got != tt.mode {
+			t.Errorf("Mode: got %v, want %v", got, tt.mode)
+		}
+		rl.reps = nil
+		for _, c := range []struct {
+			h    http.Handler
+			want int
+		}{{enforced, tt.wantEnforced}, {logOnly, tt.wantLogOnly}} {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			w := httptest.NewRecorder()
+			c.h.ServeHTTP(w, r)
+			if w.Code != c.want {
+				t.Errorf("%v: got status %d, want %d", tt.mode, w.Code, c.want)
+			}
+		}
+		if len(rl.reps) != tt.wantReports {
+			t.Errorf("%v: got %d reports, want %d", tt.mode, len(rl.reps), tt.wantReports)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("SetMode(42): got no panic")
+		}
+	}()
+	p.SetMode(42)
+}
@@ -0,0 +1,500 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// A Policy decides which requests are allowed to reach a protected handler.
+//
+// Policies are built by one of the preset constructors, like ResourceIsolationPolicy, and
+// are safe for concurrent use once built.
+type Policy struct {
+	mode atomic.Int32
+
+	crossSiteDests map[string]bool
+	table          *decisionTable
+	decider        Decider
+
+	cohortPercent int
+	cohortKey     KeyFunc
+	requireUser   bool
+	origins       map[string]bool
+	originFuncs   []func(*http.Request, string) bool
+	rpcOrigins    map[string]bool
+	wsOrigins     map[string]bool
+	preflights    bool
+	framing       framingIsolation
+
+	sameOrigin      bool
+	sameOriginPaths [][]string
+	framingPaths    [][]string
+	framingDesc     []string
+	sameOriginDesc  []string
+	untrustedHosts  []string
+
+	rejectMalformed bool
+	speculation     SpeculationAction
+
+	strict           bool
+	strictPaths      []string
+	strictUserAgents []string
+
+	referer       refererFallback
+	refererLogger RequestLogger
+
+	exemptions []exemption
+
+	blockedDests map[string]destBlock
+	hotlinkImage []byte
+	hotlinkType  string
+	routes       []routeRule
+
+	debugHeader bool
+	correlate   bool
+	reporters   []ReportLogger
+	metrics     []MetricsRecorder
+	blockRates  []*blockRate
+	onAllow     []func(*http.Request, Decision)
+	onBlock     []func(*http.Request, Decision, bool)
+
+	noVary            bool
+	varyHeader        []string
+	noDecisionContext bool
+	deny              http.Handler
+	denyDesc          string
+	stealth           bool
+	tarpit            *tarpit
+	captureBody       int
+	redacted          []string
+	redactKey         []byte
+	anonymize         bool
+	denyJSON          []byte
+	denyRedirect      string
+	denyTemplate      *template.Template
+	messages          MessageCatalog
+
+	stats stats
+}
+
+// An Option configures a Policy.
+type Option func(*Policy)
+
+// ResourceIsolationPolicy returns the Resource Isolation Policy recommended by
+// https://web.dev/fetch-metadata/, which is the one used by ProtectHandler.
+//
+// The policy allows:
+//   - requests without Fetch Metadata, sent by browsers that don't support it;
+//   - same-origin, same-site and browser-initiated ("none") requests;
+//   - cross-site GET and HEAD navigations, except the ones to embed and object destinations;
+//   - CORS preflights that lack Sec-Fetch-Mode, to work around
+//     https://bugs.chromium.org/p/chromium/issues/detail?id=979946.
+//
+// Every other request, including the ones carrying unrecognized Sec-Fetch-Site values, is
+// rejected. The policy can be adjusted with opts.
+func ResourceIsolationPolicy(opts ...Option) *Policy {
+	p := &Policy{
+		denyJSON: defaultDenyJSON,
+		crossSiteDests: map[string]bool{
+			"document":    true,
+			"frame":       true,
+			"iframe":      true,
+			"fencedframe": true,
+		},
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	p.buildTable()
+	if v := p.vary(); v != "" {
+		p.varyHeader = []string{v}
+	}
+	return p
+}
+
+// CrossSiteDestinations adds dests to the request destinations (the values of Sec-Fetch-Dest)
+// that are acceptable for cross-site GET and HEAD requests.
+//
+// Document destinations ("document", "frame", "iframe" and "fencedframe") are accepted by
+// default, and only for navigations. All other destinations (e.g. "image" or "style") are
+// accepted regardless of the request mode once added, while by default cross-site subresource
+// requests and plugin navigations ("embed" and "object") are rejected. To reject cross-site
+// framing, use FramingIsolation.
+func CrossSiteDestinations(dests ...string) Option {
+	return func(p *Policy) {
+		for _, d := range dests {
+			p.crossSiteDests[d] = true
+		}
+	}
+}
+
+// RequireUserActivation only allows cross-site navigations that were triggered by a user
+// activation, i.e. that carry a "Sec-Fetch-User: ?1" header.
+//
+// This prevents other sites from programmatically navigating users to the protected handlers,
+// at the cost of breaking redirects and navigations not initiated by the user.
+func RequireUserActivation() Option {
+	return func(p *Policy) {
+		p.requireUser = true
+	}
+}
+
+// AllowOrigins allows cross-site requests coming from the given origins, for example
+// "https://partner.example", to reach the protected handlers regardless of their mode, destination
+// and method.
+//
+// Origins are matched against the Origin header, which browsers only send with CORS requests and
+// with requests other than GET and HEAD: cross-site no-cors GET requests from allowed origins are
+// still subject to the rest of the policy. The opaque "null" origin is never allowed.
+func AllowOrigins(origins ...string) Option {
+	return func(p *Policy) {
+		if p.origins == nil {
+			p.origins = make(map[string]bool, len(origins))
+		}
+		for _, o := range origins {
+			p.origins[normalizeOrigin(o)] = true
+		}
+	}
+}
+
+// AllowOriginFunc behaves like AllowOrigins, but allows the origins for which f returns true,
+// e.g. to share the allowlist of a CORS library. f is called with the request and the value of its
+// Origin header, which is never empty or "null". It must be safe for concurrent use.
+func AllowOriginFunc(f func(r *http.Request, origin string) bool) Option {
+	return func(p *Policy) {
+		p.originFuncs = append(p.originFuncs, f)
+	}
+}
+
+// AllowCORSPreflights allows cross-site CORS preflights, OPTIONS requests carrying the
+// Access-Control-Request-Method header, to reach the protected handlers, so that the CORS handler
+// of the application can answer them and browsers report proper CORS errors instead of opaque
+// rejections. Preflights never carry credentials, and the requests they precede are still
+// subject to the policy.
+func AllowCORSPreflights() Option {
+	return func(p *Policy) {
+		p.preflights = true
+	}
+}
+
+// isPreflight reports whether r is a CORS preflight.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(origin), "/")
+}
+
+func (p *Policy) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		return false
+	}
+	if p.origins[normalizeOrigin(origin)] {
+		return true
+	}
+	for _, f := range p.originFuncs {
+		if f(r, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// FramingIsolation enables the Framing Isolation Policy on top of the default resource
+// isolation: cross-site requests to be rendered in a frame, iframe, embed or object are rejected
+// regardless of their mode and method.
+//
+// Use SameSiteFramingIsolation to also reject same-site framing.
+func FramingIsolation() Option {
+	return func(p *Policy) {
+		p.framing = framingCrossSite
+	}
+}
+
+// SameSiteFramingIsolation behaves like FramingIsolation but also rejects requests to be framed
+// by same-site contexts. Only same-origin and user-initiated requests can be framed.
+func SameSiteFramingIsolation() Option {
+	return func(p *Policy) {
+		p.framing = framingSameSite
+	}
+}
+
+// AllowFramingPaths exempts requests whose path matches any of the given patterns from
+// FramingIsolation and SameSiteFramingIsolation, for the pages that are meant to be embedded by
+// other sites, like widgets. The requests are still subject to the rest of the policy. Patterns
+// use the syntax of ExemptPaths. AllowFramingPaths panics if a pattern is malformed.
+func AllowFramingPaths(patterns ...string) Option {
+	globs := compileGlobs(patterns)
+	return func(p *Policy) {
+		p.framingPaths = append(p.framingPaths, globs...)
+		p.framingDesc = append(p.framingDesc, patterns...)
+	}
+}
+
+// ClickjackingProtection rejects requests to be rendered in frames unless they are same-origin
+// or user-initiated, as a complement to X-Frame-Options and the frame-ancestors directive of
+// Content-Security-Policy. Requests whose path matches any of embeddable, which use the syntax of
+// ExemptPaths, can still be framed.
+//
+// It is equivalent to SameSiteFramingIsolation and AllowFramingPaths(embeddable...).
+func ClickjackingProtection(embeddable ...string) Option {
+	allow := AllowFramingPaths(embeddable...)
+	return func(p *Policy) {
+		p.framing = framingSameSite
+		allow(p)
+	}
+}
+
+// SameOriginOnly makes the policy only trust same-origin and user-initiated requests:
+// same-site requests, which are otherwise always allowed, are treated like cross-site ones.
+//
+// This protects against compromised or untrusted sibling subdomains, at the cost of breaking
+// legitimate same-site requests, which then need to be allowed explicitly, e.g. with
+// AllowOrigins.
+func SameOriginOnly() Option {
+	return func(p *Policy) {
+		p.sameOrigin = true
+	}
+}
+
+// SameOriginOnlyPaths behaves like SameOriginOnly, but only for requests whose path matches any
+// of the given patterns, which use the syntax of ExemptPaths. It panics if a pattern is
+// malformed.
+func SameOriginOnlyPaths(patterns ...string) Option {
+	globs := compileGlobs(patterns)
+	return func(p *Policy) {
+		p.sameOriginPaths = append(p.sameOriginPaths, globs...)
+		p.sameOriginDesc = append(p.sameOriginDesc, patterns...)
+	}
+}
+
+// UntrustedSubdomains makes the policy treat same-site requests sent by the given hosts like
+// cross-site ones, e.g. for subdomains serving user content or sandboxes under the same
+// registrable domain. A host starting with "*." matches all subdomains of the rest of the host,
+// e.g. "*.usercontent.example.com" matches "a.usercontent.example.com".
+//
+// The sender is identified by the Origin header or, if missing, by the Referer header. Same-site
+// requests carrying neither, which include GET navigations from pages with a strict referrer
+// policy, are still trusted: use SameOriginOnly to distrust all same-site requests.
+func UntrustedSubdomains(hosts ...string) Option {
+	return func(p *Policy) {
+		for _, h := range hosts {
+			p.untrustedHosts = append(p.untrustedHosts, strings.TrimSuffix(strings.ToLower(h), "."))
+		}
+	}
+}
+
+// untrustedSender reports whether r was sent by one of the hosts passed to UntrustedSubdomains.
+func (p *Policy) untrustedSender(r *http.Request) bool {
+	if len(p.untrustedHosts) == 0 {
+		return false
+	}
+	sender := r.Header.Get("Origin")
+	if sender == "" || sender == "null" {
+		sender = r.Header.Get("Referer")
+	}
+	u, err := url.Parse(sender)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, h := range p.untrustedHosts {
+		if host == h || strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedSite reports whether requests from site are allowed regardless of the rest of the
+// policy.
+func (p *Policy) trustedSite(r *http.Request, site string) bool {
+	switch site {
+	case "same-origin", "none":
+		return true
+	case "same-site":
+		return !p.sameOrigin && !matchGlobs(p.sameOriginPaths, r.URL.Path) && !p.untrustedSender(r)
+	}
+	return false
+}
+
+// RejectMissingMetadata makes the policy fail closed by rejecting requests that don't carry a
+// Sec-Fetch-Site header, which are otherwise allowed to support browsers that don't send Fetch
+// Metadata.
+//
+// Browsers only send Fetch Metadata to potentially trustworthy origins, so this should only be
+// used on services that are exclusively reached over HTTPS by modern browsers. Non-browser
+// clients can be let through with AllowMissingMetadataPaths and AllowMissingMetadataUserAgents.
+func RejectMissingMetadata() Option {
+	return func(p *Policy) {
+		p.strict = true
+	}
+}
+
+// AllowMissingMetadataPaths exempts requests for the given paths from RejectMissingMetadata.
+// Paths ending in a slash match all the paths they are a prefix of, like in http.ServeMux.
+//
+// Requests carrying Fetch Metadata for those paths are still subject to the policy.
+func AllowMissingMetadataPaths(paths ...string) Option {
+	return func(p *Policy) {
+		p.strictPaths = append(p.strictPaths, paths...)
+	}
+}
+
+// AllowMissingMetadataUserAgents exempts requests whose User-Agent header contains any of the
+// given substrings from RejectMissingMetadata.
+//
+// The User-Agent header is controlled by the client: this is meant to accommodate well-behaved
+// non-browser clients, not to authenticate them.
+func AllowMissingMetadataUserAgents(substrings ...string) Option {
+	return func(p *Policy) {
+		p.strictUserAgents = append(p.strictUserAgents, substrings...)
+	}
+}
+
+type framingIsolation int
+
+const (
+	framingOff framingIsolation = iota
+	framingCrossSite
+	framingSameSite
+)
+
+func matchPath(patterns []string, path string) bool {
+	for _, pat := range patterns {
+		if pat == path || strings.HasSuffix(pat, "/") && strings.HasPrefix(path, pat) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNavigation(mode string) bool {
+	return mode == "navigate" || mode == "nested-navigate"
+}
+
+func isDocumentDest(dest string) bool {
+	return dest == "document" || dest == "frame" || dest == "iframe" || dest == "fencedframe"
+}
+
+func isFramingDest(dest string) bool {
+	switch dest {
+	case "frame", "iframe", "fencedframe", "embed", "object":
+		return true
+	}
+	return false
+}
+
+func (p *Policy) checkMissing(r *http.Request, d *Decision) (Rule, bool) {
+	if !p.strict || d.Site != "" {
+		return "", true
+	}
+	if matchPath(p.strictPaths, cleanPath(r.URL.Path)) {
+		return "", true
+	}
+	ua := r.Header.Get("User-Agent")
+	for _, s := range p.strictUserAgents {
+		if strings.Contains(ua, s) {
+			return "", true
+		}
+	}
+	return RuleMissingMetadata, false
+}
+
+func (p *Policy) checkFraming(r *http.Request, d *Decision) (Rule, bool) {
+	if p.framingRejected(d) && !matchGlobs(p.framingPaths, r.URL.Path) {
+		return RuleFraming, false
+	}
+	return "", true
+}
+
+// framingRejected reports whether framing isolation rejects requests with d, unless their path
+// was passed to AllowFramingPaths.
+func (p *Policy) framingRejected(d *Decision) bool {
+	if p.framing == framingOff || !isFramingDest(d.Dest) {
+		return false
+	}
+	return d.Site == "cross-site" || d.Site == "same-site" && p.framing == framingSameSite
+}
+
+func (p *Policy) checkResource(r *http.Request, d *Decision) (Rule, bool) {
+	if applies, allowed := p.checkWebSocket(r, d); applies {
+		return RuleWebSocketOrigin, allowed
+	}
+
+	if d.Site == "" {
+		// Requests from browsers that don't support Fetch Metadata are allowed.
+		return RuleMissingMetadata, true
+	}
+	if p.trustedSite(r, d.Site) {
+		// Same-site requests and user-initiated ones are allowed.
+		return RuleTrustedSite, true
+	}
+
+	if p.allowedOrigin(r) {
+		return RuleAllowedOrigin, true
+	}
+	if p.allowedRPC(r, d) {
+		return RuleRPCOrigin, true
+	}
+
+	// https://github.com/w3c/webappsec-fetch-metadata/issues/35
+	// https://bugs.chromium.org/p/chromium/issues/detail?id=979946
+	if d.Mode == "" && r.Method == http.MethodOptions || p.preflights && isPreflight(r) {
+		return RuleCORSPreflight, true
+	}
+
+	return p.lookupCrossSite(r.Method, d)
+}
+
+// crossSiteRule decides on cross-site requests with d and method that were not allowed by any
+// of the options that depend on the rest of the request. It is only called to build the decision
+// table of the policy, see lookupCrossSite.
+func (p *Policy) crossSiteRule(method string, d *Decision) (Rule, bool) {
+	// Here site is "cross-site", so let's just allow non-state-changing requests.
+	if method != http.MethodGet && method != http.MethodHead {
+		return RuleCrossSiteMethod, false
+	}
+
+	if isNavigation(d.Mode) && p.requireUser && d.User != "?1" {
+		return RuleUserActivation, false
+	}
+
+	// Some browsers send Sec-Fetch-Mode but not Sec-Fetch-Dest, treat their navigations as
+	// document ones.
+	if isNavigation(d.Mode) && d.Dest == "" {
+		return RuleCrossSiteNavigation, true
+	}
+
+	if !p.crossSiteDests[d.Dest] {
+		return RuleCrossSiteDest, false
+	}
+
+	if isNavigation(d.Mode) {
+		return RuleCrossSiteNavigation, true
+	}
+	// Documents can only be fetched cross-site by navigating to them.
+	if isDocumentDest(d.Dest) {
+		return RuleCrossSiteDest, false
+	}
+	return RuleCrossSiteSubresource, true
+}
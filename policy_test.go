@@ -0,0 +1,607 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResourceIsolationPolicy(t *testing.T) {
+	p := ResourceIsolationPolicy()
+	for _, tt := range checkTests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			if got := p.Allowed(r); got != tt.want {
+				t.Errorf("(%q,%q,%q,%q): got %v, want %v", tt.method, tt.site, tt.mode, tt.dest, got, tt.want)
+			}
+			if got := Allowed(r); got != tt.want {
+				t.Errorf("Allowed(%q,%q,%q,%q): got %v, want %v", tt.method, tt.site, tt.mode, tt.dest, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrossSiteDestinations(t *testing.T) {
+	var tests = []struct {
+		name, mode, dest, method string
+		want                     bool
+	}{
+		{
+			name:   "allowed subresource",
+			mode:   "no-cors",
+			dest:   "image",
+			method: "GET",
+			want:   true,
+		},
+		{
+			name:   "allowed subresource head",
+			mode:   "no-cors",
+			dest:   "style",
+			method: "HEAD",
+			want:   true,
+		},
+		{
+			name:   "allowed subresource post",
+			mode:   "no-cors",
+			dest:   "image",
+			method: "POST",
+			want:   false,
+		},
+		{
+			name:   "not allowed subresource",
+			mode:   "no-cors",
+			dest:   "script",
+			method: "GET",
+			want:   false,
+		},
+		{
+			name:   "allowed document",
+			mode:   "navigate",
+			dest:   "document",
+			method: "GET",
+			want:   true,
+		},
+		{
+			name:   "default document",
+			mode:   "navigate",
+			dest:   "iframe",
+			method: "GET",
+			want:   true,
+		},
+		{
+			name:   "not allowed navigation",
+			mode:   "navigate",
+			dest:   "embed",
+			method: "GET",
+			want:   false,
+		},
+		{
+			name:   "document without navigation",
+			mode:   "no-cors",
+			dest:   "document",
+			method: "GET",
+			want:   false,
+		},
+		{
+			name:   "navigation without dest",
+			mode:   "navigate",
+			dest:   "",
+			method: "GET",
+			want:   true,
+		},
+	}
+	hf := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		CrossSiteDestinations("image", "style"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			w := httptest.NewRecorder()
+			hf.ServeHTTP(w, r)
+			if got := w.Code == 200; got != tt.want {
+				t.Errorf("(%q,%q,%q): got %v, want %v", tt.method, tt.mode, tt.dest, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireUserActivation(t *testing.T) {
+	var tests = []struct {
+		name, site, mode, dest, user, method string
+		want                                 bool
+	}{
+		{
+			name:   "user navigation",
+			site:   "cross-site",
+			mode:   "navigate",
+			dest:   "document",
+			user:   "?1",
+			method: "GET",
+			want:   true,
+		},
+		{
+			name:   "user navigation without dest",
+			site:   "cross-site",
+			mode:   "navigate",
+			user:   "?1",
+			method: "GET",
+			want:   true,
+		},
+		{
+			name:   "programmatic navigation",
+			site:   "cross-site",
+			mode:   "navigate",
+			dest:   "document",
+			method: "GET",
+			want:   false,
+		},
+		{
+			name:   "programmatic navigation without dest",
+			site:   "cross-site",
+			mode:   "navigate",
+			method: "GET",
+			want:   false,
+		},
+		{
+			name:   "user form submission",
+			site:   "cross-site",
+			mode:   "navigate",
+			dest:   "document",
+			user:   "?1",
+			method: "POST",
+			want:   false,
+		},
+		{
+			name:   "same site programmatic navigation",
+			site:   "same-site",
+			mode:   "navigate",
+			dest:   "document",
+			method: "GET",
+			want:   true,
+		},
+	}
+	hf := ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		RequireUserActivation())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			r.Header.Set("sec-fetch-user", tt.user)
+			w := httptest.NewRecorder()
+			hf.ServeHTTP(w, r)
+			if got := w.Code == 200; got != tt.want {
+				t.Errorf("(%q,%q,%q,%q,%q): got %v, want %v", tt.method, tt.site, tt.mode, tt.dest, tt.user, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFramingIsolation(t *testing.T) {
+	var tests = []struct {
+		name, site, mode, dest, method string
+		crossSite, sameSite            bool
+	}{
+		{
+			name:      "cross site iframe navigation",
+			site:      "cross-site",
+			mode:      "navigate",
+			dest:      "iframe",
+			method:    "GET",
+			crossSite: false,
+			sameSite:  false,
+		},
+		{
+			name:      "cross site frame navigation",
+			site:      "cross-site",
+			mode:      "nested-navigate",
+			dest:      "frame",
+			method:    "GET",
+			crossSite: false,
+			sameSite:  false,
+		},
+		{
+			name:      "cross site document navigation",
+			site:      "cross-site",
+			mode:      "navigate",
+			dest:      "document",
+			method:    "GET",
+			crossSite: true,
+			sameSite:  true,
+		},
+		{
+			name:      "same site iframe navigation",
+			site:      "same-site",
+			mode:      "navigate",
+			dest:      "iframe",
+			method:    "GET",
+			crossSite: true,
+			sameSite:  false,
+		},
+		{
+			name:      "same site embed",
+			site:      "same-site",
+			mode:      "no-cors",
+			dest:      "embed",
+			method:    "GET",
+			crossSite: true,
+			sameSite:  false,
+		},
+		{
+			name:      "same origin iframe navigation",
+			site:      "same-origin",
+			mode:      "navigate",
+			dest:      "iframe",
+			method:    "GET",
+			crossSite: true,
+			sameSite:  true,
+		},
+		{
+			name:      "user initiated iframe navigation",
+			site:      "none",
+			mode:      "navigate",
+			dest:      "iframe",
+			method:    "GET",
+			crossSite: true,
+			sameSite:  true,
+		},
+		{
+			name:      "cross site form submission",
+			site:      "cross-site",
+			mode:      "navigate",
+			dest:      "document",
+			method:    "POST",
+			crossSite: false,
+			sameSite:  false,
+		},
+	}
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	crossSite := ProtectHandler(noop, FramingIsolation())
+	sameSite := ProtectHandler(noop, SameSiteFramingIsolation())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			w := httptest.NewRecorder()
+			crossSite.ServeHTTP(w, r)
+			if got := w.Code == 200; got != tt.crossSite {
+				t.Errorf("FramingIsolation (%q,%q,%q,%q): got %v, want %v", tt.method, tt.site, tt.mode, tt.dest, got, tt.crossSite)
+			}
+			w = httptest.NewRecorder()
+			sameSite.ServeHTTP(w, r)
+			if got := w.Code == 200; got != tt.sameSite {
+				t.Errorf("SameSiteFramingIsolation (%q,%q,%q,%q): got %v, want %v", tt.method, tt.site, tt.mode, tt.dest, got, tt.sameSite)
+			}
+		})
+	}
+}
+
+func TestClickjackingProtection(t *testing.T) {
+	p := ResourceIsolationPolicy(ClickjackingProtection("/widgets/**"))
+	var tests = []struct {
+		name, path, site, dest string
+		want                   bool
+		wantRule               Rule
+	}{
+		{name: "same-origin iframe", path: "/", site: "same-origin", dest: "iframe", want: true, wantRule: RuleTrustedSite},
+		{name: "same-site iframe", path: "/", site: "same-site", dest: "iframe", wantRule: RuleFraming},
+		{name: "cross-site frame", path: "/", site: "cross-site", dest: "frame", wantRule: RuleFraming},
+		{name: "cross-site fenced frame", path: "/", site: "cross-site", dest: "fencedframe", wantRule: RuleFraming},
+		{name: "user-initiated iframe", path: "/", site: "none", dest: "iframe", want: true, wantRule: RuleTrustedSite},
+		{name: "embeddable widget", path: "/widgets/chat", site: "cross-site", dest: "iframe", want: true, wantRule: RuleCrossSiteNavigation},
+		{name: "embeddable same-site widget", path: "/widgets/a/b", site: "same-site", dest: "iframe", want: true, wantRule: RuleTrustedSite},
+		{name: "cross-site document", path: "/", site: "cross-site", dest: "document", want: true, wantRule: RuleCrossSiteNavigation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", "navigate")
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			d := p.Check(r)
+			if d.Allowed != tt.want || d.Rule != tt.wantRule {
+				t.Errorf("got %v, want allowed %v by %q", d, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestRejectMissingMetadata(t *testing.T) {
+	var tests = []struct {
+		name, site, path, ua string
+		want                 bool
+	}{
+		{
+			name: "missing metadata",
+			path: "/",
+			want: false,
+		},
+		{
+			name: "same origin",
+			site: "same-origin",
+			path: "/",
+			want: true,
+		},
+		{
+			name: "cross site",
+			site: "cross-site",
+			path: "/healthz",
+			want: false,
+		},
+		{
+			name: "exempt path",
+			path: "/healthz",
+			want: true,
+		},
+		{
+			name: "exempt path prefix",
+			path: "/api/v1/status",
+			want: true,
+		},
+		{
+			name: "non exempt path prefix",
+			path: "/healthz/details",
+			want: false,
+		},
+		{
+			name: "exempt user agent",
+			path: "/",
+			ua:   "kube-probe/1.27",
+			want: true,
+		},
+		{
+			name: "non exempt user agent",
+			path: "/",
+			ua:   "curl/8.0.1",
+			want: false,
+		},
+	}
+	p := ResourceIsolationPolicy(
+		RejectMissingMetadata(),
+		AllowMissingMetadataPaths("/healthz", "/api/"),
+		AllowMissingMetadataUserAgents("kube-probe/"),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", "cors")
+			r.Header.Set("user-agent", tt.ua)
+			if got := p.Allowed(r); got != tt.want {
+				t.Errorf("(%q,%q,%q): got %v, want %v", tt.site, tt.path, tt.ua, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowOrigins(t *testing.T) {
+	var tests = []struct {
+		name, site, mode, origin string
+		want                     bool
+	}{
+		{
+			name:   "allowed origin",
+			site:   "cross-site",
+			mode:   "cors",
+			origin: "https://partner.example",
+			want:   true,
+		},
+		{
+			name:   "allowed origin different case",
+			site:   "cross-site",
+			mode:   "cors",
+			origin: "https://Partner.example",
+			want:   true,
+		},
+		{
+			name:   "allowed origin form submission",
+			site:   "cross-site",
+			mode:   "navigate",
+			origin: "https://other.example",
+			want:   true,
+		},
+		{
+			name:   "allowed host different scheme",
+			site:   "cross-site",
+			mode:   "cors",
+			origin: "http://partner.example",
+			want:   false,
+		},
+		{
+			name:   "not allowed origin",
+			site:   "cross-site",
+			mode:   "cors",
+			origin: "https://evil.example",
+			want:   false,
+		},
+		{
+			name:   "opaque origin",
+			site:   "cross-site",
+			mode:   "cors",
+			origin: "null",
+			want:   false,
+		},
+		{
+			name: "missing origin",
+			site: "cross-site",
+			mode: "no-cors",
+			want: false,
+		},
+	}
+	p := ResourceIsolationPolicy(AllowOrigins("https://partner.example", "https://other.example/"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("origin", tt.origin)
+			if got := p.Allowed(r); got != tt.want {
+				t.Errorf("(%q,%q,%q): got %v, want %v", tt.site, tt.mode, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowCORSPreflights(t *testing.T) {
+	var tests = []struct {
+		name          string
+		method        string
+		requestMethod string
+		opts          []Option
+		want          Decision
+	}{
+		{
+			name:          "preflight",
+			method:        "OPTIONS",
+			requestMethod: "PUT",
+			opts:          []Option{AllowCORSPreflights()},
+			want:          Decision{Allowed: true, Rule: RuleCORSPreflight},
+		},
+		{
+			name:          "preflight not allowed",
+			method:        "OPTIONS",
+			requestMethod: "PUT",
+			want:          Decision{Rule: RuleCrossSiteMethod},
+		},
+		{
+			name:   "options without request method",
+			method: "OPTIONS",
+			opts:   []Option{AllowCORSPreflights()},
+			want:   Decision{Rule: RuleCrossSiteMethod},
+		},
+		{
+			name:   "preflighted request",
+			method: "PUT",
+			opts:   []Option{AllowCORSPreflights()},
+			want:   Decision{Rule: RuleCrossSiteMethod},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", "cors")
+			r.Header.Set("sec-fetch-dest", "empty")
+			r.Header.Set("origin", "https://other.example")
+			if tt.requestMethod != "" {
+				r.Header.Set("access-control-request-method", tt.requestMethod)
+			}
+			got := ResourceIsolationPolicy(tt.opts...).Check(r)
+			if got.Allowed != tt.want.Allowed || got.Rule != tt.want.Rule {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowOriginFunc(t *testing.T) {
+	p := ResourceIsolationPolicy(AllowOriginFunc(func(r *http.Request, origin string) bool {
+		return strings.HasSuffix(origin, ".partner.example")
+	}))
+	var tests = []struct {
+		origin string
+		want   Decision
+	}{
+		{origin: "https://a.partner.example", want: Decision{Allowed: true, Rule: RuleAllowedOrigin}},
+		{origin: "https://evil.example", want: Decision{Rule: RuleCrossSiteMethod}},
+		{origin: "null", want: Decision{Rule: RuleCrossSiteMethod}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("sec-fetch-site", "cross-site")
+		r.Header.Set("sec-fetch-mode", "cors")
+		r.Header.Set("origin", tt.origin)
+		if got := p.Check(r); got.Allowed != tt.want.Allowed || got.Rule != tt.want.Rule {
+			t.Errorf("%q: got %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestSameOriginOnly(t *testing.T) {
+	var tests = []struct {
+		name   string
+		opts   []Option
+		site   string
+		method string
+		path   string
+		want   Decision
+	}{
+		{name: "same-site default", site: "same-site", method: "POST", path: "/", want: Decision{Allowed: true, Rule: RuleTrustedSite}},
+		{name: "same-site post", opts: []Option{SameOriginOnly()}, site: "same-site", method: "POST", path: "/", want: Decision{Rule: RuleCrossSiteMethod}},
+		{name: "same-site navigation", opts: []Option{SameOriginOnly()}, site: "same-site", method: "GET", path: "/", want: Decision{Allowed: true, Rule: RuleCrossSiteNavigation}},
+		{name: "same-origin", opts: []Option{SameOriginOnly()}, site: "same-origin", method: "POST", path: "/", want: Decision{Allowed: true, Rule: RuleTrustedSite}},
+		{name: "user-initiated", opts: []Option{SameOriginOnly()}, site: "none", method: "GET", path: "/", want: Decision{Allowed: true, Rule: RuleTrustedSite}},
+		{name: "matching path", opts: []Option{SameOriginOnlyPaths("/admin/**")}, site: "same-site", method: "POST", path: "/admin/users", want: Decision{Rule: RuleCrossSiteMethod}},
+		{name: "other path", opts: []Option{SameOriginOnlyPaths("/admin/**")}, site: "same-site", method: "POST", path: "/api", want: Decision{Allowed: true, Rule: RuleTrustedSite}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", "navigate")
+			r.Header.Set("sec-fetch-dest", "document")
+			got := ResourceIsolationPolicy(tt.opts...).Check(r)
+			if got.Allowed != tt.want.Allowed || got.Rule != tt.want.Rule {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUntrustedSubdomains(t *testing.T) {
+	p := ResourceIsolationPolicy(UntrustedSubdomains("sandbox.example.com", "*.usercontent.example.com"))
+	var tests = []struct {
+		name    string
+		site    string
+		origin  string
+		referer string
+		want    Decision
+	}{
+		{name: "untrusted origin", site: "same-site", origin: "https://sandbox.example.com", want: Decision{Rule: RuleCrossSiteMethod}},
+		{name: "untrusted wildcard origin", site: "same-site", origin: "https://a.usercontent.example.com:8443", want: Decision{Rule: RuleCrossSiteMethod}},
+		{name: "untrusted referer", site: "same-site", referer: "https://SANDBOX.example.com/page", want: Decision{Rule: RuleCrossSiteMethod}},
+		{name: "trusted origin", site: "same-site", origin: "https://app.example.com", want: Decision{Allowed: true, Rule: RuleTrustedSite}},
+		{name: "wildcard parent", site: "same-site", origin: "https://usercontent.example.com", want: Decision{Allowed: true, Rule: RuleTrustedSite}},
+		{name: "unknown sender", site: "same-site", want: Decision{Allowed: true, Rule: RuleTrustedSite}},
+		{name: "same-origin", site: "same-origin", origin: "https://sandbox.example.com", want: Decision{Allowed: true, Rule: RuleTrustedSite}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", "cors")
+			if tt.origin != "" {
+				r.Header.Set("origin", tt.origin)
+			}
+			if tt.referer != "" {
+				r.Header.Set("referer", tt.referer)
+			}
+			if got := p.Check(r); got.Allowed != tt.want.Allowed || got.Rule != tt.want.Rule {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
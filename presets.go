@@ -0,0 +1,180 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"strings"
+)
+
+// OAuthCallback allows the requests that identity providers make to the OAuth and OpenID
+// Connect redirect URIs whose path matches any of patterns: top-level navigations with the GET
+// method, for the default response modes, and with the POST method, for the form_post response
+// mode. These are cross-site, and not initiated by users on the current page, so they may be
+// rejected by the default policy or by RequireUserActivation.
+//
+// Other requests for the redirect URIs, including navigations of frames, are evaluated as usual.
+// Allowed requests are reported with RuleOAuthCallback. OAuthCallback is a route rule, see
+// AllowCrossSite for the evaluation order and ExemptPaths for the syntax of patterns.
+// OAuthCallback panics if a pattern is malformed.
+func OAuthCallback(patterns ...string) Option {
+	return navigationRoute("oauth-callback", RuleOAuthCallback, []string{http.MethodGet, http.MethodPost}, documentDests, patterns)
+}
+
+// SAMLACS allows the requests that identity providers make to the SAML Assertion Consumer
+// Service endpoints whose path matches any of patterns with the HTTP-POST binding: top-level
+// navigations with the POST method. These are cross-site, and rejected by the default policy.
+//
+// Other requests for the endpoints are evaluated as usual. Allowed requests are reported with
+// RuleSAMLACS. SAMLACS is a route rule, see AllowCrossSite for the evaluation order and
+// ExemptPaths for the syntax of patterns. SAMLACS panics if a pattern is malformed.
+func SAMLACS(patterns ...string) Option {
+	return navigationRoute("saml-acs", RuleSAMLACS, []string{http.MethodPost}, documentDests, patterns)
+}
+
+// ThreeDSecureCallback allows the requests that 3-D Secure access control servers make to the
+// notification URLs whose path matches any of patterns, to post back the result of challenges:
+// navigations with the POST method, of the top-level document or of frames, since challenges
+// are usually displayed in an iframe. These are cross-site, and rejected by the default policy
+// and by FramingIsolation.
+//
+// Other requests for the notification URLs are evaluated as usual. Allowed requests are
+// reported with RuleThreeDSecure. ThreeDSecureCallback is a route rule, see AllowCrossSite for
+// the evaluation order and ExemptPaths for the syntax of patterns. ThreeDSecureCallback panics if
+// a pattern is malformed.
+func ThreeDSecureCallback(patterns ...string) Option {
+	return navigationRoute("3ds-callback", RuleThreeDSecure, []string{http.MethodPost}, frameDests, patterns)
+}
+
+// PaymentReturn allows the requests that payment service providers make to the return URLs
+// whose path matches any of patterns, to send users back after payments: top-level navigations
+// with the GET or the POST method. These are cross-site, and not initiated by users on the
+// current page, so they may be rejected by the default policy or by RequireUserActivation.
+//
+// Other requests for the return URLs are evaluated as usual. Allowed requests are reported with
+// RulePaymentReturn. PaymentReturn is a route rule, see AllowCrossSite for the evaluation order
+// and ExemptPaths for the syntax of patterns. PaymentReturn panics if a pattern is malformed.
+func PaymentReturn(patterns ...string) Option {
+	return navigationRoute("payment-return", RulePaymentReturn, []string{http.MethodGet, http.MethodPost}, documentDests, patterns)
+}
+
+// Destinations of the navigations allowed by presets. The empty destination is sent by browsers
+// that don't support Sec-Fetch-Dest.
+var (
+	documentDests = map[string]bool{"": true, "document": true}
+	frameDests    = map[string]bool{"": true, "document": true, "frame": true, "iframe": true}
+)
+
+// navigationRoute returns a route rule that allows navigations with the given methods and
+// destinations to the paths matching patterns.
+func navigationRoute(action string, rule Rule, methods []string, dests map[string]bool, patterns []string) Option {
+	rr := routeRule{
+		desc:   action + " " + strings.Join(methods, ","),
+		method: "*",
+		globs:  compileGlobs(patterns),
+		when: func(r *http.Request, d Decision) bool {
+			if d.Mode != "navigate" || !dests[d.Dest] {
+				return false
+			}
+			for _, m := range methods {
+				if r.Method == m {
+					return true
+				}
+			}
+			return false
+		},
+		rule:  rule,
+		allow: true,
+	}
+	for _, p := range patterns {
+		rr.desc += " " + p
+	}
+	return func(p *Policy) {
+		p.routes = append(p.routes, rr)
+	}
+}
+
+// AllowStaticAssets allows cross-site requests for static assets, like images and stylesheets,
+// which many sites intentionally serve to other origins: no-cors GET and HEAD requests for
+// subresources, whose path starts with any of the given prefixes, like "/static/", or ends with
+// any of the given extensions, like ".png". Arguments starting with "." are extensions, the
+// others are prefixes.
+//
+// Navigations, including the ones of embed and object elements, and CORS requests for the same
+// paths are evaluated as usual. Allowed requests are reported with RuleStaticAsset.
+// AllowStaticAssets is a route rule, see AllowCrossSite for the evaluation order.
+func AllowStaticAssets(prefixesOrExtensions ...string) Option {
+	var prefixes, exts []string
+	for _, s := range prefixesOrExtensions {
+		if strings.HasPrefix(s, ".") {
+			exts = append(exts, s)
+		} else {
+			prefixes = append(prefixes, s)
+		}
+	}
+	rr := routeRule{
+		desc:   "static-assets " + strings.Join(prefixesOrExtensions, " "),
+		method: "*",
+		globs:  [][]string{{"**"}},
+		when: func(r *http.Request, d Decision) bool {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				return false
+			}
+			if d.Mode != "no-cors" || navigableDests[d.Dest] {
+				return false
+			}
+			path := cleanPath(r.URL.Path)
+			if hasAnyPrefix(path, prefixes) {
+				return true
+			}
+			for _, e := range exts {
+				if strings.HasSuffix(path, e) {
+					return true
+				}
+			}
+			return false
+		},
+		rule:  RuleStaticAsset,
+		allow: true,
+	}
+	return func(p *Policy) {
+		p.routes = append(p.routes, rr)
+	}
+}
+
+// LoginEndpoints protects login and account recovery endpoints whose path matches any of
+// patterns against login CSRF more strictly than the rest of the policy: POST requests for them
+// are rejected unless they are same-origin navigations initiated by users, i.e. form submissions
+// with the Sec-Fetch-User header. Requests lacking Fetch Metadata are evaluated as usual, see
+// RejectMissingMetadata.
+//
+// Logins performed with fetch or XMLHttpRequest never carry Sec-Fetch-User, so they are rejected
+// too. Rejected requests are reported with RuleLoginEndpoint. LoginEndpoints is a route rule,
+// see AllowCrossSite for the evaluation order and ExemptPaths for the syntax of patterns.
+// LoginEndpoints panics if a pattern is malformed.
+func LoginEndpoints(patterns ...string) Option {
+	rr := routeRule{
+		desc:   "login-endpoints POST " + strings.Join(patterns, " "),
+		method: http.MethodPost,
+		globs:  compileGlobs(patterns),
+		when: func(r *http.Request, d Decision) bool {
+			return d.Site != "" && (d.Site != "same-origin" || d.User != "?1")
+		},
+		rule: RuleLoginEndpoint,
+	}
+	return func(p *Policy) {
+		p.routes = append(p.routes, rr)
+	}
+}
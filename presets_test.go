@@ -0,0 +1,176 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOAuthCallback(t *testing.T) {
+	p := ResourceIsolationPolicy(RequireUserActivation(), OAuthCallback("/oauth2/callback", "/oidc/*/callback"))
+	var tests = []struct {
+		name, method, path, site, mode, dest string
+		want                                 bool
+		wantRule                             Rule
+	}{
+		{name: "redirect", method: "GET", path: "/oauth2/callback", site: "cross-site", mode: "navigate", dest: "document", want: true, wantRule: RuleOAuthCallback},
+		{name: "form_post", method: "POST", path: "/oauth2/callback", site: "cross-site", mode: "navigate", dest: "document", want: true, wantRule: RuleOAuthCallback},
+		{name: "form_post without dest", method: "POST", path: "/oidc/google/callback", site: "cross-site", mode: "navigate", want: true, wantRule: RuleOAuthCallback},
+		{name: "iframe", method: "GET", path: "/oauth2/callback", site: "cross-site", mode: "navigate", dest: "iframe", wantRule: RuleUserActivation},
+		{name: "fetch", method: "POST", path: "/oauth2/callback", site: "cross-site", mode: "cors", dest: "empty", wantRule: RuleCrossSiteMethod},
+		{name: "put navigation", method: "PUT", path: "/oauth2/callback", site: "cross-site", mode: "navigate", dest: "document", wantRule: RuleCrossSiteMethod},
+		{name: "same-origin fetch", method: "POST", path: "/oauth2/callback", site: "same-origin", mode: "cors", dest: "empty", want: true, wantRule: RuleTrustedSite},
+		{name: "other path", method: "POST", path: "/login", site: "cross-site", mode: "navigate", dest: "document", wantRule: RuleCrossSiteMethod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			d := p.Check(r)
+			if d.Allowed != tt.want || d.Rule != tt.wantRule {
+				t.Errorf("got %v, want allowed %v by %q", d, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestSAMLACS(t *testing.T) {
+	p := ResourceIsolationPolicy(SAMLACS("/saml/acs"))
+	var tests = []struct {
+		name, method, path, site, mode, dest string
+		want                                 bool
+		wantRule                             Rule
+	}{
+		{name: "post binding", method: "POST", path: "/saml/acs", site: "cross-site", mode: "navigate", dest: "document", want: true, wantRule: RuleSAMLACS},
+		{name: "post binding without dest", method: "POST", path: "/saml/acs", site: "cross-site", mode: "navigate", want: true, wantRule: RuleSAMLACS},
+		{name: "framed post", method: "POST", path: "/saml/acs", site: "cross-site", mode: "navigate", dest: "iframe", wantRule: RuleCrossSiteMethod},
+		{name: "fetch", method: "POST", path: "/saml/acs", site: "cross-site", mode: "cors", dest: "empty", wantRule: RuleCrossSiteMethod},
+		{name: "other path", method: "POST", path: "/saml/acs/x", site: "cross-site", mode: "navigate", dest: "document", wantRule: RuleCrossSiteMethod},
+		{name: "get navigation", method: "GET", path: "/saml/acs", site: "cross-site", mode: "navigate", dest: "document", want: true, wantRule: RuleCrossSiteNavigation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			d := p.Check(r)
+			if d.Allowed != tt.want || d.Rule != tt.wantRule {
+				t.Errorf("got %v, want allowed %v by %q", d, tt.want, tt.wantRule)
+			}
+		})
+	}
+	if got, want := p.describe().Routes, []string{"saml-acs POST /saml/acs"}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("got description %q, want %q", got, want)
+	}
+}
+
+func TestPaymentPresets(t *testing.T) {
+	p := ResourceIsolationPolicy(
+		FramingIsolation(),
+		RequireUserActivation(),
+		ThreeDSecureCallback("/checkout/3ds"),
+		PaymentReturn("/checkout/return"),
+	)
+	var tests = []struct {
+		name, method, path, site, mode, dest string
+		want                                 bool
+		wantRule                             Rule
+	}{
+		{name: "3ds challenge post-back", method: "POST", path: "/checkout/3ds", site: "cross-site", mode: "navigate", dest: "iframe", want: true, wantRule: RuleThreeDSecure},
+		{name: "3ds redirect post-back", method: "POST", path: "/checkout/3ds", site: "cross-site", mode: "navigate", dest: "document", want: true, wantRule: RuleThreeDSecure},
+		{name: "3ds get", method: "GET", path: "/checkout/3ds", site: "cross-site", mode: "navigate", dest: "iframe", wantRule: RuleFraming},
+		{name: "3ds fetch", method: "POST", path: "/checkout/3ds", site: "cross-site", mode: "cors", dest: "empty", wantRule: RuleCrossSiteMethod},
+		{name: "return get", method: "GET", path: "/checkout/return", site: "cross-site", mode: "navigate", dest: "document", want: true, wantRule: RulePaymentReturn},
+		{name: "return post", method: "POST", path: "/checkout/return", site: "cross-site", mode: "navigate", dest: "document", want: true, wantRule: RulePaymentReturn},
+		{name: "return framed", method: "POST", path: "/checkout/return", site: "cross-site", mode: "navigate", dest: "iframe", wantRule: RuleFraming},
+		{name: "other path", method: "POST", path: "/checkout", site: "cross-site", mode: "navigate", dest: "document", wantRule: RuleCrossSiteMethod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			d := p.Check(r)
+			if d.Allowed != tt.want || d.Rule != tt.wantRule {
+				t.Errorf("got %v, want allowed %v by %q", d, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestAllowStaticAssets(t *testing.T) {
+	p := ResourceIsolationPolicy(AllowStaticAssets("/static/", ".png", ".css"))
+	var tests = []struct {
+		name, method, path, site, mode, dest string
+		want                                 bool
+		wantRule                             Rule
+	}{
+		{name: "prefix", method: "GET", path: "/static/app.js", site: "cross-site", mode: "no-cors", dest: "script", want: true, wantRule: RuleStaticAsset},
+		{name: "extension", method: "GET", path: "/img/logo.png", site: "cross-site", mode: "no-cors", dest: "image", want: true, wantRule: RuleStaticAsset},
+		{name: "head", method: "HEAD", path: "/theme.css", site: "cross-site", mode: "no-cors", dest: "style", want: true, wantRule: RuleStaticAsset},
+		{name: "unclean path", method: "GET", path: "/static/../api/data", site: "cross-site", mode: "no-cors", dest: "script", wantRule: RuleCrossSiteDest},
+		{name: "other path", method: "GET", path: "/img/logo.jpg", site: "cross-site", mode: "no-cors", dest: "image", wantRule: RuleCrossSiteDest},
+		{name: "cors", method: "GET", path: "/static/data.json", site: "cross-site", mode: "cors", dest: "empty", wantRule: RuleCrossSiteDest},
+		{name: "post", method: "POST", path: "/static/upload", site: "cross-site", mode: "no-cors", dest: "empty", wantRule: RuleCrossSiteMethod},
+		{name: "embed", method: "GET", path: "/static/doc.pdf", site: "cross-site", mode: "no-cors", dest: "embed", wantRule: RuleCrossSiteDest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
+			d := p.Check(r)
+			if d.Allowed != tt.want || d.Rule != tt.wantRule {
+				t.Errorf("got %v, want allowed %v by %q", d, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestLoginEndpoints(t *testing.T) {
+	p := ResourceIsolationPolicy(LoginEndpoints("/login", "/account/recover"))
+	var tests = []struct {
+		name, method, path, site, mode, user string
+		want                                 bool
+		wantRule                             Rule
+	}{
+		{name: "form submission", method: "POST", path: "/login", site: "same-origin", mode: "navigate", user: "?1", want: true, wantRule: RuleTrustedSite},
+		{name: "scripted submission", method: "POST", path: "/login", site: "same-origin", mode: "navigate", wantRule: RuleLoginEndpoint},
+		{name: "fetch", method: "POST", path: "/account/recover", site: "same-origin", mode: "cors", wantRule: RuleLoginEndpoint},
+		{name: "same-site form", method: "POST", path: "/login", site: "same-site", mode: "navigate", user: "?1", wantRule: RuleLoginEndpoint},
+		{name: "cross-site form", method: "POST", path: "/login", site: "cross-site", mode: "navigate", user: "?1", wantRule: RuleLoginEndpoint},
+		{name: "missing metadata", method: "POST", path: "/login", want: true, wantRule: RuleMissingMetadata},
+		{name: "login page", method: "GET", path: "/login", site: "same-site", mode: "navigate", want: true, wantRule: RuleTrustedSite},
+		{name: "other path", method: "POST", path: "/logout", site: "same-origin", mode: "cors", want: true, wantRule: RuleTrustedSite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-user", tt.user)
+			d := p.Check(r)
+			if d.Allowed != tt.want || d.Rule != tt.wantRule {
+				t.Errorf("got %v, want allowed %v by %q", d, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// defaultRedactedHeaders are the headers redacted by RedactHeaders in addition to the given ones.
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// redactedValue replaces the values of redacted headers.
+const redactedValue = "REDACTED"
+
+// RedactHeaders makes the policy redact the credentials in the requests passed to
+// RequestLoggers, so that they can be shipped to log pipelines: the values of the Authorization,
+// Proxy-Authorization and Cookie headers, and of the given headers, are replaced by "REDACTED",
+// or by their hash if HashRedactedHeaders is used.
+//
+// Loggers receive a copy of the request, the request served by the protected handler is left
+// untouched. Reports only hold the headers they document, so they are not affected.
+func RedactHeaders(headers ...string) Option {
+	return func(p *Policy) {
+		if p.redacted == nil {
+			p.redacted = append(p.redacted, defaultRedactedHeaders...)
+		}
+		for _, h := range headers {
+			p.redacted = append(p.redacted, http.CanonicalHeaderKey(h))
+		}
+	}
+}
+
+// HashRedactedHeaders makes RedactHeaders replace values with "hmac-sha256:" followed by their
+// hex-encoded HMAC-SHA256 keyed with key, so that requests carrying the same credentials can be
+// correlated without disclosing them. key must be kept secret, as otherwise low-entropy values
+// can be recovered by brute force. HashRedactedHeaders implies RedactHeaders.
+func HashRedactedHeaders(key []byte) Option {
+	return func(p *Policy) {
+		RedactHeaders()(p)
+		p.redactKey = key
+	}
+}
+
+// redact returns a copy of r with redacted headers, and anonymized if p uses AnonymizeReports,
+// or r if p doesn't redact headers.
+func (p *Policy) redact(r *http.Request) *http.Request {
+	if p.redacted == nil {
+		return r
+	}
+	r = r.Clone(r.Context())
+	if p.anonymize {
+		anonymizeRequest(r)
+	}
+	for _, h := range p.redacted {
+		vs := r.Header[h]
+		for i, v := range vs {
+			vs[i] = p.redactValue(v)
+		}
+	}
+	return r
+}
+
+func (p *Policy) redactValue(v string) string {
+	if p.redactKey == nil {
+		return redactedValue
+	}
+	mac := hmac.New(sha256.New, p.redactKey)
+	mac.Write([]byte(v))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
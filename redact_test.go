@@ -0,0 +1,82 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	var tests = []struct {
+		name string
+		opts []Option
+		want http.Header
+	}{
+		{
+			name: "off",
+			want: http.Header{"Authorization": {"Bearer t0k3n"}, "Cookie": {"sid=1"}, "X-Api-Key": {"k"}, "Accept": {"*/*"}},
+		},
+		{
+			name: "default",
+			opts: []Option{RedactHeaders()},
+			want: http.Header{"Authorization": {"REDACTED"}, "Cookie": {"REDACTED"}, "X-Api-Key": {"k"}, "Accept": {"*/*"}},
+		},
+		{
+			name: "custom",
+			opts: []Option{RedactHeaders("x-api-key")},
+			want: http.Header{"Authorization": {"REDACTED"}, "Cookie": {"REDACTED"}, "X-Api-Key": {"REDACTED"}, "Accept": {"*/*"}},
+		},
+		{
+			name: "hashed",
+			opts: []Option{HashRedactedHeaders([]byte("key"))},
+			want: http.Header{
+				"Authorization": {"hmac-sha256:da89991f5af13ae564644bf9adf3c6aec8c5904feab41a4ecaff6bb40becde98"},
+				"Cookie":        {"hmac-sha256:99a6e2724346db98d9566f41e1887815881de26603262a6f9732aca8fec3555e"},
+				"X-Api-Key":     {"k"},
+				"Accept":        {"*/*"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l testRequestLogger
+			var served http.Header
+			h := ProtectHandlerLogOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = r.Header
+			}), &l, tt.opts...)
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("Authorization", "Bearer t0k3n")
+			r.Header.Set("Cookie", "sid=1")
+			r.Header.Set("X-Api-Key", "k")
+			r.Header.Set("Accept", "*/*")
+			r.Header.Set("Sec-Fetch-Site", "cross-site")
+			orig := r.Header.Clone()
+			tt.want.Set("Sec-Fetch-Site", "cross-site")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if len(l.rs) != 1 {
+				t.Fatalf("got %d logged requests, want 1", len(l.rs))
+			}
+			if got := l.rs[0].Header; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("logged headers: got %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(served, orig) {
+				t.Errorf("served headers: got %v, want %v", served, orig)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// RefererFallback classifies requests that don't carry Fetch Metadata by comparing the
+// registrable domain of their Referer with the one of the requested host, and rejects the
+// state-changing ones that turn out to be cross-site.
+//
+// Requests without a Referer, or with one that cannot be parsed, are left to the rest of the
+// policy. Since the Referer header might be stripped or truncated by browsers and intermediaries,
+// this is a best-effort protection for browsers that predate Fetch Metadata.
+func RefererFallback() Option {
+	return func(p *Policy) {
+		p.referer = refererEnforce
+	}
+}
+
+// RefererFallbackLogOnly behaves like RefererFallback, but only logs requests that would have
+// been rejected by the fallback to rl. Requests are logged by the handlers returned by Protect
+// and by Evaluate, not by Check, Allowed or Simulate. RefererFallbackLogOnly panics if rl is nil.
+func RefererFallbackLogOnly(rl RequestLogger) Option {
+	if rl == nil {
+		panic("secfetch: RefererFallbackLogOnly requires a RequestLogger")
+	}
+	return func(p *Policy) {
+		p.referer = refererLogOnly
+		p.refererLogger = rl
+	}
+}
+
+type refererFallback int
+
+const (
+	refererOff refererFallback = iota
+	refererEnforce
+	refererLogOnly
+)
+
+func (p *Policy) checkReferer(r *http.Request, d *Decision) (Rule, bool) {
+	if p.referer == refererOff || d.Site != "" {
+		return "", true
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return "", true
+	}
+	if refererSite(r) != "cross-site" {
+		return "", true
+	}
+	if p.referer == refererLogOnly {
+		d.refererLogOnly = true
+		return "", true
+	}
+	return RuleRefererCrossSite, false
+}
+
+// refererSite returns the value Sec-Fetch-Site would have had for r, inferred from its Referer.
+// It returns an empty string if the Referer is missing or invalid.
+func refererSite(r *http.Request) string {
+	ref, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || ref.Host == "" {
+		return ""
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if ref.Scheme == scheme && strings.EqualFold(ref.Host, r.Host) {
+		return "same-origin"
+	}
+	refHost := strings.ToLower(ref.Hostname())
+	host := strings.ToLower(hostname(r.Host))
+	if refHost == host || registrableDomain(refHost) == registrableDomain(host) {
+		return "same-site"
+	}
+	return "cross-site"
+}
+
+func hostname(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport
+	}
+	return host
+}
+
+func registrableDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	d, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		// The host is a public suffix itself, e.g. "localhost".
+		return host
+	}
+	return d
+}
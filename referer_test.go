@@ -0,0 +1,125 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRefererSite(t *testing.T) {
+	var tests = []struct {
+		name, host, referer, want string
+	}{
+		{name: "missing", host: "example.com", referer: "", want: ""},
+		{name: "invalid", host: "example.com", referer: "://", want: ""},
+		{name: "same origin", host: "example.com", referer: "http://example.com/form", want: "same-origin"},
+		{name: "same origin with port", host: "example.com:8080", referer: "http://example.com:8080/", want: "same-origin"},
+		{name: "different scheme", host: "example.com", referer: "https://example.com/", want: "same-site"},
+		{name: "subdomain", host: "app.example.com", referer: "http://www.example.com/", want: "same-site"},
+		{name: "public suffix", host: "app.example.co.uk", referer: "http://evil.co.uk/", want: "cross-site"},
+		{name: "cross site", host: "example.com", referer: "http://evil.com/", want: "cross-site"},
+		{name: "ip", host: "127.0.0.1", referer: "http://127.0.0.2/", want: "cross-site"},
+		{name: "localhost", host: "localhost:8080", referer: "http://localhost:9090/", want: "same-site"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Host = tt.host
+			r.Header.Set("referer", tt.referer)
+			if got := refererSite(r); got != tt.want {
+				t.Errorf("refererSite(%q, %q): got %q, want %q", tt.host, tt.referer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefererFallback(t *testing.T) {
+	var tests = []struct {
+		name, site, referer, method string
+		want                        bool
+	}{
+		{
+			name:    "cross site post",
+			referer: "http://evil.com/",
+			method:  "POST",
+			want:    false,
+		},
+		{
+			name:    "cross site get",
+			referer: "http://evil.com/",
+			method:  "GET",
+			want:    true,
+		},
+		{
+			name:    "same site post",
+			referer: "http://www.example.com/",
+			method:  "POST",
+			want:    true,
+		},
+		{
+			name:   "no referer post",
+			method: "POST",
+			want:   true,
+		},
+		{
+			name:    "fetch metadata takes precedence",
+			site:    "same-origin",
+			referer: "http://evil.com/",
+			method:  "POST",
+			want:    true,
+		},
+	}
+	var tl testRequestLogger
+	enforce := ResourceIsolationPolicy(RefererFallback())
+	logOnly := ResourceIsolationPolicy(RefererFallbackLogOnly(&tl))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tl.reset()
+			r := httptest.NewRequest(tt.method, "http://example.com/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("referer", tt.referer)
+			if got := enforce.Allowed(r); got != tt.want {
+				t.Errorf("RefererFallback(%q,%q,%q): got %v, want %v", tt.method, tt.site, tt.referer, got, tt.want)
+			}
+			if !logOnly.Allowed(r) {
+				t.Errorf("RefererFallbackLogOnly(%q,%q,%q): request was rejected", tt.method, tt.site, tt.referer)
+			}
+			if len(tl.rs) != 0 {
+				t.Errorf("RefererFallbackLogOnly(%q,%q,%q): Allowed logged the request", tt.method, tt.site, tt.referer)
+			}
+			var served bool
+			logOnly.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			if !served {
+				t.Errorf("RefererFallbackLogOnly(%q,%q,%q): request was not served", tt.method, tt.site, tt.referer)
+			}
+			if got := len(tl.rs) == 0; got != tt.want {
+				t.Errorf("RefererFallbackLogOnly(%q,%q,%q): got %v, want %v", tt.method, tt.site, tt.referer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefererFallbackLogOnlyNil(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RefererFallbackLogOnly(nil) didn't panic")
+		}
+	}()
+	RefererFallbackLogOnly(nil)
+}
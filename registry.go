@@ -0,0 +1,162 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// An ExemptionRegistry holds path exemptions that can be added and removed while policies are
+// serving requests, e.g. to exempt an endpoint broken by a policy during an incident without
+// redeploying. See DynamicExemptions.
+//
+// Exemptions are stored copy-on-write: changes build a new set of exemptions and swap it
+// atomically, so requests are evaluated without locking, and always against a consistent set.
+// A zero ExemptionRegistry is empty and ready to use.
+type ExemptionRegistry struct {
+	mu    sync.Mutex // serializes changes
+	globs atomic.Pointer[map[string][]string]
+}
+
+// DynamicExemptions exempts requests whose path matches any of the patterns currently in er from
+// the policy. Patterns have the same syntax as the ones of ExemptPaths.
+//
+// er can be shared by several policies, and outlives the policies built by PolicyFile, so
+// exemptions are kept across reloads if er is passed as an option to NewPolicyFile.
+func DynamicExemptions(er *ExemptionRegistry) Option {
+	return func(p *Policy) {
+		p.exempt("dynamic", er.match)
+	}
+}
+
+// AddExemption exempts the paths matching pattern. It returns an error if pattern is malformed.
+func (er *ExemptionRegistry) AddExemption(pattern string) error {
+	if pattern == "" {
+		return errors.New("secfetch: empty path pattern")
+	}
+	g, err := compileGlob(pattern)
+	if err != nil {
+		return fmt.Errorf("secfetch: malformed path pattern %q: %v", pattern, err)
+	}
+	er.update(func(globs map[string][]string) {
+		globs[pattern] = g
+	})
+	return nil
+}
+
+// RemoveExemption removes the exemption added with pattern, and reports whether there was one.
+func (er *ExemptionRegistry) RemoveExemption(pattern string) bool {
+	var ok bool
+	er.update(func(globs map[string][]string) {
+		_, ok = globs[pattern]
+		delete(globs, pattern)
+	})
+	return ok
+}
+
+// Exemptions returns the patterns currently in er, sorted.
+func (er *ExemptionRegistry) Exemptions() []string {
+	ps := []string{}
+	if globs := er.globs.Load(); globs != nil {
+		for p := range *globs {
+			ps = append(ps, p)
+		}
+	}
+	sort.Strings(ps)
+	return ps
+}
+
+// update applies f to a copy of the exemptions of er, and makes the copy active.
+func (er *ExemptionRegistry) update(f func(globs map[string][]string)) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	globs := map[string][]string{}
+	if cur := er.globs.Load(); cur != nil {
+		for p, g := range *cur {
+			globs[p] = g
+		}
+	}
+	f(globs)
+	er.globs.Store(&globs)
+}
+
+// registryPolicy protects the handlers of ExemptionRegistry from cross-site requests.
+var registryPolicy = ResourceIsolationPolicy(SameOriginOnly())
+
+func (er *ExemptionRegistry) match(r *http.Request) bool {
+	globs := er.globs.Load()
+	if globs == nil || len(*globs) == 0 {
+		return false
+	}
+	p := cleanPath(r.URL.Path)
+	for _, g := range *globs {
+		if matchSegments(g, p, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler returns a handler to manage the exemptions of er:
+//   - GET serves the patterns in er as a JSON array;
+//   - POST adds the pattern in the "path" form value;
+//   - DELETE removes the pattern in the "path" query parameter, and responds with 404 if there
+//     was none.
+//
+// The handler can disable the protection of policies, so it must only be served to
+// administrators, e.g. on an internal port, and behind authentication. Since browsers attach
+// credentials to cross-site form submissions, POST and DELETE requests are also evaluated
+// against a SameOriginOnly policy, and rejected with 403 unless they are same-origin, initiated
+// by the user, or sent by clients without Fetch Metadata, like curl. The handler is not exempted
+// by Exempt or by the exemptions of enclosing policies.
+func (er *ExemptionRegistry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			// The context is dropped so that requests marked exempt by enclosing policies are
+			// still checked.
+			if !registryPolicy.Allowed(r.WithContext(context.Background())) {
+				http.Error(w, "cross-site request rejected", http.StatusForbidden)
+				return
+			}
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			if err := er.AddExemption(r.FormValue("path")); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			if !er.RemoveExemption(r.URL.Query().Get("path")) {
+				http.Error(w, "exemption not found", http.StatusNotFound)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(er.Exemptions())
+	})
+}
@@ -0,0 +1,202 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExemptionRegistry(t *testing.T) {
+	var er ExemptionRegistry
+	p := ResourceIsolationPolicy(DynamicExemptions(&er))
+	check := func(path string) Decision {
+		r := httptest.NewRequest("POST", path, nil)
+		r.Header.Set("Sec-Fetch-Site", "cross-site")
+		return p.Check(r)
+	}
+	if d := check("/broken/a"); d.Allowed {
+		t.Fatalf("empty registry: got %v, want rejected", d)
+	}
+
+	for _, pat := range []string{"/broken/*", "/webhooks/**"} {
+		if err := er.AddExemption(pat); err != nil {
+			t.Fatalf("AddExemption(%q): %v", pat, err)
+		}
+	}
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		{"/broken/a", true},
+		{"/broken/../broken/b", true},
+		{"/broken/a/b", false},
+		{"/webhooks", true},
+		{"/webhooks/a/b", true},
+		{"/other", false},
+	} {
+		if d := check(tt.path); d.Allowed != tt.want || tt.want && d.Rule != RuleExempt {
+			t.Errorf("%s: got %v, want allowed %v", tt.path, d, tt.want)
+		}
+	}
+	if got, want := strings.Join(er.Exemptions(), " "), "/broken/* /webhooks/**"; got != want {
+		t.Errorf("Exemptions: got %q, want %q", got, want)
+	}
+
+	if !er.RemoveExemption("/broken/*") {
+		t.Error("RemoveExemption: got false, want true")
+	}
+	if er.RemoveExemption("/broken/*") {
+		t.Error("RemoveExemption twice: got true, want false")
+	}
+	if d := check("/broken/a"); d.Allowed {
+		t.Errorf("removed exemption: got %v, want rejected", d)
+	}
+	for _, pat := range []string{"", "/a/["} {
+		if err := er.AddExemption(pat); err == nil {
+			t.Errorf("AddExemption(%q): got nil error", pat)
+		}
+	}
+}
+
+func TestExemptionRegistryConcurrent(t *testing.T) {
+	var er ExemptionRegistry
+	p := ResourceIsolationPolicy(DynamicExemptions(&er))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				er.AddExemption("/a/*")
+				er.RemoveExemption("/a/*")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				p.Check(httptest.NewRequest("POST", "/a/b", nil))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestExemptionRegistryHandler(t *testing.T) {
+	var er ExemptionRegistry
+	h := er.Handler()
+	var tests = []struct {
+		method, target, body string
+		wantCode             int
+		wantBody             string
+	}{
+		{method: "GET", target: "/", wantCode: 200, wantBody: "[]\n"},
+		{method: "POST", target: "/", body: "path=/a/*", wantCode: 200, wantBody: `["/a/*"]` + "\n"},
+		{method: "POST", target: "/", body: "path=" + url.QueryEscape("/b/["), wantCode: 400},
+		{method: "POST", target: "/", wantCode: 400},
+		{method: "GET", target: "/", wantCode: 200, wantBody: `["/a/*"]` + "\n"},
+		{method: "DELETE", target: "/?path=/c", wantCode: 404},
+		{method: "DELETE", target: "/?path=/a/*", wantCode: 200, wantBody: "[]\n"},
+		{method: "PUT", target: "/", wantCode: 405},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		if tt.body != "" {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s %s %q: got code %d, want %d", tt.method, tt.target, tt.body, w.Code, tt.wantCode)
+		}
+		if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+			t.Errorf("%s %s %q: got body %q, want %q", tt.method, tt.target, tt.body, w.Body, tt.wantBody)
+		}
+	}
+}
+
+func TestExemptionRegistryHandlerCrossSite(t *testing.T) {
+	var er ExemptionRegistry
+	var tests = []struct {
+		name    string
+		method  string
+		headers map[string]string
+		exempt  bool
+		want    int
+	}{
+		{
+			name:    "cross-site form",
+			method:  "POST",
+			headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "document", "Sec-Fetch-User": "?1"},
+			want:    403,
+		},
+		{
+			name:    "cross-site form in exempt handler",
+			method:  "POST",
+			headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "document"},
+			exempt:  true,
+			want:    403,
+		},
+		{
+			name:    "same-site form",
+			method:  "POST",
+			headers: map[string]string{"Sec-Fetch-Site": "same-site", "Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "document"},
+			want:    403,
+		},
+		{
+			name:    "same-origin form",
+			method:  "POST",
+			headers: map[string]string{"Sec-Fetch-Site": "same-origin", "Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "document"},
+			want:    200,
+		},
+		{name: "no metadata", method: "POST", want: 200},
+		{
+			name:    "cross-site delete",
+			method:  "DELETE",
+			headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "cors", "Sec-Fetch-Dest": "empty"},
+			want:    403,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			er.RemoveExemption("/a")
+			h := er.Handler()
+			if tt.exempt {
+				h = ProtectHandler(Exempt(h))
+			}
+			target := "/"
+			if tt.method == "DELETE" {
+				er.AddExemption("/a")
+				target = "/?path=/a"
+			}
+			r := httptest.NewRequest(tt.method, target, strings.NewReader("path=/a"))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got code %d, want %d", w.Code, tt.want)
+			}
+			if got, want := len(er.Exemptions()) > 0, tt.method == "DELETE" && tt.want == 403 || tt.method == "POST" && tt.want == 200; got != want {
+				t.Errorf("got exemptions %q", er.Exemptions())
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A PolicyFile is a Policy loaded from a configuration file that can be reloaded at runtime,
+// e.g. to add exemptions during an incident without restarting the server.
+//
+// Handlers returned by Protect always use the latest successfully loaded Policy: requests
+// already being evaluated finish with the Policy they started with. Since every reload builds
+// a new Policy, the counters served by StatsHandler are reset on reload, and the handler
+// must be obtained again from Policy after a reload.
+//
+// A mode set at runtime with SetMode on the active Policy, e.g. to switch to LogOnly during an
+// incident, takes precedence over the mode of the file: it is carried over to the reloaded
+// Policies until it is set back to the mode the active Policy was loaded with.
+type PolicyFile struct {
+	path string
+	opts []Option
+
+	p atomic.Pointer[Policy]
+
+	mu      sync.Mutex // serializes reloads
+	modTime time.Time
+	size    int64
+	// fileMode is the mode the active Policy was loaded with.
+	fileMode Mode
+}
+
+// NewPolicyFile loads the Policy at path with LoadPolicy. opts are applied on every reload.
+func NewPolicyFile(path string, opts ...Option) (*PolicyFile, error) {
+	f := &PolicyFile{path: path, opts: opts}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Policy returns the currently active Policy.
+func (f *PolicyFile) Policy() *Policy {
+	return f.p.Load()
+}
+
+// Reload loads the configuration file again and atomically replaces the active Policy.
+// If the file cannot be loaded, the active Policy is kept and the error is returned.
+func (f *PolicyFile) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	// Remember the attempt even if it fails, so Watch reports each broken version only once.
+	f.modTime, f.size = fi.ModTime(), fi.Size()
+	p, err := LoadPolicy(f.path, f.opts...)
+	if err != nil {
+		return err
+	}
+	fileMode := p.Mode()
+	if old := f.p.Load(); old != nil && old.Mode() != f.fileMode {
+		p.SetMode(old.Mode())
+	}
+	f.fileMode = fileMode
+	f.p.Store(p)
+	return nil
+}
+
+// Watch checks the configuration file for changes every interval and reloads it when its
+// modification time or size changes, until ctx is done. Errors are passed to onError, which
+// may be nil, and don't stop watching.
+func (f *PolicyFile) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := f.reloadIfChanged(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func (f *PolicyFile) reloadIfChanged() error {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	changed := !fi.ModTime().Equal(f.modTime) || fi.Size() != f.size
+	f.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return f.Reload()
+}
+
+// Protect isolates h with the active Policy, see Policy.Protect.
+func (f *PolicyFile) Protect(h http.Handler) http.Handler {
+	type protected struct {
+		p *Policy
+		h http.Handler
+	}
+	var cur atomic.Pointer[protected]
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := f.Policy()
+		c := cur.Load()
+		if c == nil || c.p != p {
+			c = &protected{p: p, h: p.Protect(h)}
+			cur.Store(c)
+		}
+		c.h.ServeHTTP(w, r)
+	})
+}
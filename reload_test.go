@@ -0,0 +1,134 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{}`)
+	f, err := NewPolicyFile(path, DenyStatus(http.StatusTeapot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := f.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	check := func(want int) {
+		t.Helper()
+		r := httptest.NewRequest("POST", "/hook", nil)
+		r.Header.Set("sec-fetch-site", "cross-site")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("got status %d, want %d", w.Code, want)
+		}
+	}
+	check(http.StatusTeapot)
+
+	write(`{"exempt_paths": ["/hook"]}`)
+	if err := f.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	check(http.StatusOK)
+
+	// Broken configurations keep the active policy.
+	write(`{"exempt_paths": [`)
+	if err := f.Reload(); err == nil {
+		t.Error("Reload: got no error for a broken file")
+	}
+	check(http.StatusOK)
+}
+
+func TestPolicyFileModeOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reload := func(f *PolicyFile, want Mode) {
+		t.Helper()
+		if err := f.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		if got := f.Policy().Mode(); got != want {
+			t.Errorf("after reload: got mode %v, want %v", got, want)
+		}
+	}
+	write(`{}`)
+	f, err := NewPolicyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Runtime overrides survive reloads, even if the file changes its mode.
+	f.Policy().SetMode(LogOnly)
+	write(`{"exempt_paths": ["/hook"]}`)
+	reload(f, LogOnly)
+	write(`{"mode": "disabled"}`)
+	reload(f, LogOnly)
+
+	// Setting the mode back to the one of the file ends the override.
+	f.Policy().SetMode(Disabled)
+	write(`{"mode": "off"}`)
+	reload(f, Off)
+	write(`{}`)
+	reload(f, Enforce)
+}
+
+func TestPolicyFileWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("mode: enforce\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewPolicyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := f.Policy()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Watch(ctx, time.Millisecond, nil)
+		close(done)
+	}()
+	if err := os.WriteFile(path, []byte("mode: log-only\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); f.Policy() == old; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("policy was not reloaded")
+		}
+	}
+	if got := f.Policy().Mode(); got != LogOnly {
+		t.Errorf("got mode %v, want %v", got, LogOnly)
+	}
+	cancel()
+	<-done
+}
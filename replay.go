@@ -0,0 +1,238 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ReadHAR reads the requests of a HAR file, as exported by browser developer tools, proxies or
+// HARRecorder, to replay them with Policy.Replay.
+func ReadHAR(r io.Reader) ([]RequestDescriptor, error) {
+	var f harFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("secfetch: invalid HAR file: %v", err)
+	}
+	rds := make([]RequestDescriptor, 0, len(f.Log.Entries))
+	for i, e := range f.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("secfetch: invalid HAR entry %d: %v", i, err)
+		}
+		rd := RequestDescriptor{Method: e.Request.Method, Host: u.Host, Path: u.Path, TLS: u.Scheme == "https"}
+		for _, h := range e.Request.Headers {
+			// HTTP/2 pseudo-headers are recorded by browsers along with the regular ones.
+			if strings.HasPrefix(h.Name, ":") {
+				continue
+			}
+			rd.setHeader(h.Name, h.Value)
+		}
+		rds = append(rds, rd)
+	}
+	return rds, nil
+}
+
+// setHeader sets the header k of rd to v.
+func (rd *RequestDescriptor) setHeader(k, v string) {
+	switch k = http.CanonicalHeaderKey(k); k {
+	case "Sec-Fetch-Site":
+		rd.Site = v
+	case "Sec-Fetch-Mode":
+		rd.Mode = v
+	case "Sec-Fetch-Dest":
+		rd.Dest = v
+	case "Sec-Fetch-User":
+		rd.User = v
+	case "Origin":
+		rd.Origin = v
+	case "Referer":
+		rd.Referer = v
+	case "User-Agent":
+		rd.UserAgent = v
+	case "Host":
+		rd.Host = v
+	default:
+		if rd.Header == nil {
+			rd.Header = make(map[string]string)
+		}
+		rd.Header[k] = v
+	}
+}
+
+// ReadAccessLog reads the requests of an access log to replay them with Policy.Replay. Each line
+// is either a JSON object in the format of Reports and RequestDescriptors, as written by
+// structured loggers, or an entry in the Combined Log Format used by Apache and nginx:
+//
+//	203.0.113.7 - - [10/Oct/2024:13:55:36 +0000] "POST /transfer HTTP/1.1" 403 0 "https://example.com/" "Mozilla/5.0 ..."
+//
+// Further quoted fields after the User-Agent are ignored. Since the Combined Log Format doesn't
+// record Fetch Metadata, its requests are replayed without it, which is still useful to evaluate
+// options like RejectMissingMetadata and RefererFallback. Empty lines are skipped.
+func ReadAccessLog(r io.Reader) ([]RequestDescriptor, error) {
+	var rds []RequestDescriptor
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rd RequestDescriptor
+		var err error
+		if line[0] == '{' {
+			err = json.Unmarshal(line, &rd)
+		} else {
+			rd, err = parseCombinedLog(string(line))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("secfetch: invalid access log line %d: %v", n, err)
+		}
+		rds = append(rds, rd)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("secfetch: reading access log: %v", err)
+	}
+	return rds, nil
+}
+
+// parseCombinedLog parses a line in the Combined Log Format.
+func parseCombinedLog(line string) (RequestDescriptor, error) {
+	// host ident user [time] "request" status size "referer" "user-agent"
+	_, rest, ok := strings.Cut(line, "]")
+	if !ok {
+		return RequestDescriptor{}, fmt.Errorf("missing time")
+	}
+	var fields []string
+	for {
+		_, quoted, ok := strings.Cut(rest, `"`)
+		if !ok {
+			break
+		}
+		v, after, ok := cutQuoted(quoted)
+		if !ok {
+			return RequestDescriptor{}, fmt.Errorf("unterminated quoted field")
+		}
+		fields = append(fields, v)
+		rest = after
+	}
+	if len(fields) < 3 {
+		return RequestDescriptor{}, fmt.Errorf("missing request, referer or user agent")
+	}
+	method, target, ok := strings.Cut(fields[0], " ")
+	if !ok {
+		return RequestDescriptor{}, fmt.Errorf("malformed request %q", fields[0])
+	}
+	target, _, _ = strings.Cut(target, " ")
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		return RequestDescriptor{}, err
+	}
+	rd := RequestDescriptor{Method: method, Host: u.Host, Path: u.Path, TLS: u.Scheme == "https"}
+	// Missing values are logged as "-".
+	if fields[1] != "-" {
+		rd.Referer = fields[1]
+	}
+	if fields[2] != "-" {
+		rd.UserAgent = fields[2]
+	}
+	return rd, nil
+}
+
+// cutQuoted returns the value of the quoted field s starts with, where quotes may be escaped
+// with backslashes, and the text after its closing quote.
+func cutQuoted(s string) (v, after string, ok bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case c == '"':
+			return b.String(), s[i+1:], true
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", false
+}
+
+// A ReplayReport describes the outcome of replaying recorded traffic against a Policy, see
+// Policy.Replay.
+type ReplayReport struct {
+	// Total is the number of replayed requests, and Rejected the number of the ones that the
+	// policy would have rejected.
+	Total    int `json:"total"`
+	Rejected int `json:"rejected"`
+	// Rules counts the replayed requests by the rule that decided them, most frequent first.
+	Rules []RuleCount `json:"rules"`
+	// Rejections are the requests the policy would have rejected, in replay order.
+	Rejections []Rejection `json:"rejections"`
+}
+
+// A RuleCount is the number of replayed requests decided by a Rule.
+type RuleCount struct {
+	Rule     Rule `json:"rule"`
+	Allowed  int  `json:"allowed"`
+	Rejected int  `json:"rejected"`
+}
+
+// A Rejection is a replayed request that a policy would have rejected.
+type Rejection struct {
+	// Index is the position of the request in the replayed traffic.
+	Index   int               `json:"index"`
+	Request RequestDescriptor `json:"request"`
+	Rule    Rule              `json:"rule"`
+}
+
+// Replay evaluates recorded traffic, e.g. read with ReadHAR or ReadAccessLog, against p, and
+// reports what p would have rejected, to gain confidence in a configuration before deploying it.
+// Like with Simulate, replayed requests have no side effects.
+func (p *Policy) Replay(requests []RequestDescriptor) *ReplayReport {
+	rr := &ReplayReport{Total: len(requests), Rules: []RuleCount{}, Rejections: []Rejection{}}
+	rules := make(map[Rule]*RuleCount)
+	for i, d := range p.Simulate(requests) {
+		rc, ok := rules[d.Rule]
+		if !ok {
+			rc = &RuleCount{Rule: d.Rule}
+			rules[d.Rule] = rc
+		}
+		if d.Allowed {
+			rc.Allowed++
+			continue
+		}
+		rc.Rejected++
+		rr.Rejected++
+		rr.Rejections = append(rr.Rejections, Rejection{Index: i, Request: requests[i], Rule: d.Rule})
+	}
+	for _, rc := range rules {
+		rr.Rules = append(rr.Rules, *rc)
+	}
+	sort.Slice(rr.Rules, func(i, j int) bool {
+		ti, tj := rr.Rules[i].Allowed+rr.Rules[i].Rejected, rr.Rules[j].Allowed+rr.Rules[j].Rejected
+		if ti != tj {
+			return ti > tj
+		}
+		return rr.Rules[i].Rule < rr.Rules[j].Rule
+	})
+	return rr
+}
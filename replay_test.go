@@ -0,0 +1,145 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testHAR = `{"log": {"version": "1.2", "creator": {"name": "browser", "version": "1"}, "entries": [
+	{"request": {"method": "POST", "url": "https://example.com/transfer?to=bob", "headers": [
+		{"name": ":authority", "value": "example.com"},
+		{"name": "sec-fetch-site", "value": "cross-site"},
+		{"name": "sec-fetch-mode", "value": "navigate"},
+		{"name": "origin", "value": "https://evil.example"},
+		{"name": "content-type", "value": "application/x-www-form-urlencoded"}
+	]}},
+	{"request": {"method": "GET", "url": "http://example.com/", "headers": []}}
+]}}`
+
+func TestReadHAR(t *testing.T) {
+	got, err := ReadHAR(strings.NewReader(testHAR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RequestDescriptor{
+		{
+			Method: "POST", Host: "example.com", Path: "/transfer", TLS: true,
+			Site: "cross-site", Mode: "navigate", Origin: "https://evil.example",
+			Header: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+		},
+		{Method: "GET", Host: "example.com", Path: "/"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if _, err := ReadHAR(strings.NewReader(`{"log": `)); err == nil {
+		t.Error("truncated HAR: got no error")
+	}
+}
+
+func TestReadHARRecorder(t *testing.T) {
+	// Requests exported by a HARRecorder are replayed like the originals.
+	har := NewHARRecorder(10)
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r := httptest.NewRequest("POST", "/hooks/github", nil)
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	ResourceIsolationPolicy().ProtectLogOnly(noop, har).ServeHTTP(httptest.NewRecorder(), r)
+	var buf bytes.Buffer
+	if _, err := har.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rds, err := ReadHAR(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := ResourceIsolationPolicy(ExemptPaths("/hooks/*")).Replay(rds)
+	if rr.Total != 1 || rr.Rejected != 0 {
+		t.Errorf("got %+v, want one allowed request", rr)
+	}
+}
+
+func TestReadAccessLog(t *testing.T) {
+	const log = `203.0.113.7 - - [10/Oct/2024:13:55:36 +0000] "POST /transfer HTTP/1.1" 403 0 "https://evil.example/" "Mozilla/5.0 \"quoted\""
+
+{"method": "POST", "path": "/api", "site": "cross-site", "mode": "cors", "rule": "cross-site-method"}
+203.0.113.8 - alice [10/Oct/2024:13:55:37 +0000] "GET / HTTP/2.0" 200 512 "-" "-" "extra"
+`
+	got, err := ReadAccessLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RequestDescriptor{
+		{Method: "POST", Path: "/transfer", Referer: "https://evil.example/", UserAgent: `Mozilla/5.0 "quoted"`},
+		{Method: "POST", Path: "/api", Site: "cross-site", Mode: "cors"},
+		{Method: "GET", Path: "/"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReadAccessLogErrors(t *testing.T) {
+	var tests = []struct {
+		name, log, wantErr string
+	}{
+		{name: "json", log: "{\"method\": 1}", wantErr: "line 1"},
+		{name: "no time", log: `203.0.113.7 - - "GET / HTTP/1.1" 200 0 "-" "-"`, wantErr: "missing time"},
+		{name: "unterminated", log: `h - - [t] "GET / HTTP/1.1" 200 0 "-" "curl`, wantErr: "unterminated"},
+		{name: "common log format", log: `h - - [t] "GET / HTTP/1.1" 200 0`, wantErr: "missing request"},
+		{name: "request", log: "\n" + `h - - [t] "-" 400 0 "-" "-"`, wantErr: "line 2: malformed request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadAccessLog(strings.NewReader(tt.log))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	p := ResourceIsolationPolicy(ExemptPaths("/hooks/*"))
+	rds := []RequestDescriptor{
+		{Method: "POST", Path: "/transfer", Site: "cross-site"},
+		{Method: "POST", Path: "/hooks/github", Site: "cross-site"},
+		{Method: "POST", Path: "/hooks/gitlab", Site: "cross-site"},
+		{Method: "POST", Path: "/profile", Site: "cross-site"},
+		{Path: "/", Site: "same-origin"},
+	}
+	got := p.Replay(rds)
+	want := &ReplayReport{
+		Total:    5,
+		Rejected: 2,
+		Rules: []RuleCount{
+			{Rule: RuleCrossSiteMethod, Rejected: 2},
+			{Rule: RuleExempt, Allowed: 2},
+			{Rule: RuleTrustedSite, Allowed: 1},
+		},
+		Rejections: []Rejection{
+			{Index: 0, Request: rds[0], Rule: RuleCrossSiteMethod},
+			{Index: 3, Request: rds[3], Rule: RuleCrossSiteMethod},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A Report describes a request that was rejected, or would have been rejected in log-only mode,
+// by a policy. Reports only hold copies of the request data, so they can outlive the request.
+type Report struct {
+	// Time is when the request was evaluated.
+	Time time.Time `json:"time"`
+	// Enforced reports whether the request was actually rejected, as opposed to only logged.
+	Enforced bool `json:"enforced"`
+	// Rule is the rule that rejected the request.
+	Rule Rule `json:"rule"`
+	// RequestID is the ID of the request, if any, see RequestID.
+	RequestID string `json:"request_id,omitempty"`
+
+	Method     string `json:"method"`
+	Host       string `json:"host"`
+	Path       string `json:"path"`
+	RemoteAddr string `json:"remote_addr"`
+
+	// Site, Mode, Dest and User are the values of the Fetch Metadata request headers.
+	Site string `json:"site"`
+	Mode string `json:"mode"`
+	Dest string `json:"dest"`
+	User string `json:"user"`
+	// Origin, Referer and UserAgent are the values of the corresponding request headers.
+	Origin    string `json:"origin"`
+	Referer   string `json:"referer"`
+	UserAgent string `json:"user_agent"`
+	// Body holds the first bytes of the request body, if the policy uses CaptureBody, and
+	// BodyTruncated reports whether the body was longer.
+	Body          string `json:"body,omitempty"`
+	BodyTruncated bool   `json:"body_truncated,omitempty"`
+}
+
+// NewReport returns a Report describing r, which was evaluated to d.
+func NewReport(r *http.Request, d Decision, enforced bool) *Report {
+	rep := new(Report)
+	rep.fill(r, d, enforced)
+	return rep
+}
+
+func (rep *Report) fill(r *http.Request, d Decision, enforced bool) {
+	*rep = Report{
+		Time:       time.Now(),
+		Enforced:   enforced,
+		Rule:       d.Rule,
+		RequestID:  RequestID(r),
+		Method:     r.Method,
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		Site:       d.Site,
+		Mode:       d.Mode,
+		Dest:       d.Dest,
+		User:       d.User,
+		Origin:     r.Header.Get("Origin"),
+		Referer:    r.Header.Get("Referer"),
+		UserAgent:  r.Header.Get("User-Agent"),
+	}
+	if b, ok := r.Body.(*capturedBody); ok {
+		rep.Body, rep.BodyTruncated = string(b.prefix), b.truncated
+	}
+}
+
+// reportPool holds the Reports passed to ReportLoggers, which must not retain them, so that
+// logging rejected requests doesn't allocate.
+var reportPool = sync.Pool{New: func() interface{} { return new(Report) }}
+
+// getReport returns a pooled Report describing r, which must be released with putReport.
+func getReport(r *http.Request, d Decision, enforced bool) *Report {
+	rep := reportPool.Get().(*Report)
+	rep.fill(r, d, enforced)
+	return rep
+}
+
+func putReport(rep *Report) {
+	// Drop the references to the request data before pooling the report.
+	*rep = Report{}
+	reportPool.Put(rep)
+}
+
+// logReport sends a Report describing r to each of rls, anonymized if anonymize is set.
+func logReport(rls []ReportLogger, r *http.Request, d Decision, enforced, anonymize bool) {
+	rep := getReport(r, d, enforced)
+	if anonymize {
+		rep.anonymize()
+	}
+	for _, rl := range rls {
+		rl.LogReport(rep)
+	}
+	putReport(rep)
+}
+
+// LogRequestReport logs r, which would have been rejected by a policy, as a Report to rl. It is
+// meant to implement RequestLogger.LogRequest for ReportLoggers, and reuses Reports across calls
+// to reduce allocations.
+func LogRequestReport(rl ReportLogger, r *http.Request) {
+	d, _ := FromContext(r.Context())
+	rep := getReport(r, d, false)
+	rl.LogReport(rep)
+	putReport(rep)
+}
+
+// A Field is a named value of a Report, see Report.Fields.
+type Field struct {
+	Key, Value string
+}
+
+// Fields returns the fields of rep emitted by the structured loggers of this module, like
+// SlogLogger, so that records have the same field names regardless of the logging library.
+func (rep *Report) Fields() []Field {
+	return []Field{
+		{"path", rep.Path},
+		{"method", rep.Method},
+		{"site", rep.Site},
+		{"mode", rep.Mode},
+		{"dest", rep.Dest},
+		{"remote_addr", rep.RemoteAddr},
+		{"rule", string(rep.Rule)},
+		{"request_id", rep.RequestID},
+	}
+}
+
+// Message returns the message structured loggers emit rep with.
+func (rep *Report) Message() string {
+	if rep.Enforced {
+		return "secfetch: request rejected by policy"
+	}
+	return "secfetch: request would be rejected by policy"
+}
+
+// SummaryMessage is the message structured loggers emit Summaries with.
+const SummaryMessage = "secfetch: requests rejected by policy"
+
+// ReportLogger is a type that can log Reports.
+type ReportLogger interface {
+	// LogReport is called with every report that needs to be logged.
+	// Implementations must not retain rep after returning, as policies reuse Reports.
+	LogReport(rep *Report)
+}
+
+// ReportTo makes the policy send a Report to each of rls for every request it rejects when used
+// with Protect, or would have rejected when used with ProtectLogOnly.
+func ReportTo(rls ...ReportLogger) Option {
+	return func(p *Policy) {
+		p.reporters = append(p.reporters, rls...)
+	}
+}
+
+func (p *Policy) report(r *http.Request, d Decision, enforced bool) {
+	if len(p.reporters) == 0 {
+		return
+	}
+	logReport(p.reporters, r, d, enforced, p.anonymize)
+}
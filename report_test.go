@@ -0,0 +1,136 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testReportLogger struct {
+	reps []Report
+}
+
+func (t *testReportLogger) LogReport(rep *Report) {
+	t.reps = append(t.reps, *rep)
+}
+
+func TestReportTo(t *testing.T) {
+	var tl testReportLogger
+	p := ResourceIsolationPolicy(ReportTo(&tl))
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range []struct {
+		name     string
+		h        http.Handler
+		enforced bool
+	}{
+		{name: "Protect", h: p.Protect(noop), enforced: true},
+		{name: "ProtectLogOnly", h: p.ProtectLogOnly(noop, nil), enforced: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tl.reps = nil
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("sec-fetch-site", "same-origin")
+			tt.h.ServeHTTP(httptest.NewRecorder(), r)
+			if len(tl.reps) != 0 {
+				t.Errorf("got %d reports for an allowed request", len(tl.reps))
+			}
+
+			r = httptest.NewRequest("POST", "http://example.com/account?id=1", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", "navigate")
+			r.Header.Set("sec-fetch-dest", "document")
+			r.Header.Set("sec-fetch-user", "?1")
+			r.Header.Set("origin", "https://evil.example")
+			r.Header.Set("referer", "https://evil.example/form")
+			r.Header.Set("user-agent", "test")
+			tt.h.ServeHTTP(httptest.NewRecorder(), r)
+			if len(tl.reps) != 1 {
+				t.Fatalf("got %d reports, want 1", len(tl.reps))
+			}
+			got := tl.reps[0]
+			if got.Time.IsZero() {
+				t.Errorf("report time was not set")
+			}
+			got.Time = time.Time{}
+			want := Report{
+				Enforced:   tt.enforced,
+				Rule:       RuleCrossSiteMethod,
+				Method:     "POST",
+				Host:       "example.com",
+				Path:       "/account",
+				RemoteAddr: "192.0.2.1:1234",
+				Site:       "cross-site",
+				Mode:       "navigate",
+				Dest:       "document",
+				User:       "?1",
+				Origin:     "https://evil.example",
+				Referer:    "https://evil.example/form",
+				UserAgent:  "test",
+			}
+			if got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// countingReportLogger counts reports without retaining them.
+type countingReportLogger struct {
+	n     int
+	paths map[string]int
+}
+
+func (c *countingReportLogger) LogReport(rep *Report) {
+	c.n++
+	c.paths[rep.Path]++
+}
+
+func TestReportsArePooled(t *testing.T) {
+	cl := &countingReportLogger{paths: map[string]int{}}
+	p := ResourceIsolationPolicy(ReportTo(cl))
+	r := newBenchRequest("POST", "cross-site", "navigate", "document")
+	d := p.Check(r)
+	if n := testing.AllocsPerRun(100, func() { p.report(r, d, true) }); n != 0 {
+		t.Errorf("reporting allocates %v times, want 0", n)
+	}
+	r = withDecision(r, d)
+	if n := testing.AllocsPerRun(100, func() { LogRequestReport(cl, r) }); n != 0 {
+		t.Errorf("LogRequestReport allocates %v times, want 0", n)
+	}
+
+	// Pooled reports must not leak the data of previous requests.
+	var tl testReportLogger
+	LogRequestReport(&tl, httptest.NewRequest("GET", "/other", nil))
+	if len(tl.reps) != 1 || tl.reps[0].Path != "/other" || tl.reps[0].Site != "" || tl.reps[0].Rule != "" {
+		t.Errorf("got reports %+v", tl.reps)
+	}
+}
+
+func BenchmarkReportTo(b *testing.B) {
+	cl := &countingReportLogger{paths: map[string]int{}}
+	p := ResourceIsolationPolicy(ReportTo(cl))
+	h := p.ProtectLogOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), nil)
+	r := newBenchRequest("POST", "cross-site", "navigate", "document")
+	w := discardWriter{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		clear(w)
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// requestIDHeader is the header rejected requests are correlated with.
+const requestIDHeader = "X-Request-Id"
+
+// CorrelateRequests makes the policy correlate rejected requests across load balancers, logs and
+// user complaints: rejected requests that lack a request ID are assigned a random one, and the
+// responses to rejected requests carry the ID in the X-Request-Id header and, for the default
+// plain text response, in the body.
+//
+// The ID of a request is taken from its X-Request-Id header, or from the trace ID of its W3C
+// traceparent or X-Cloud-Trace-Context headers. IDs are always included in Reports when
+// present; CorrelateRequests only makes sure they are. The ID of a request can be retrieved by
+// handlers with RequestID.
+func CorrelateRequests() Option {
+	return func(p *Policy) {
+		p.correlate = true
+	}
+}
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of r: the value of its X-Request-Id header, the trace ID of its
+// traceparent or X-Cloud-Trace-Context headers, or the ID assigned to it by a policy that uses
+// CorrelateRequests, if any.
+func RequestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); id != "" {
+		return id
+	}
+	if id := traceID(r.Header.Get("Traceparent")); id != "" {
+		return id
+	}
+	if id := cloudTraceID(r.Header.Get("X-Cloud-Trace-Context")); id != "" {
+		return id
+	}
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// traceID returns the trace ID of a W3C traceparent header value, or "" if v is malformed.
+func traceID(v string) string {
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	_, rest, ok := strings.Cut(v, "-")
+	if !ok {
+		return ""
+	}
+	id, rest, ok := strings.Cut(rest, "-")
+	if !ok || !strings.Contains(rest, "-") || !isTraceID(id) || id == zeroTraceID {
+		return ""
+	}
+	return id
+}
+
+const zeroTraceID = "00000000000000000000000000000000"
+
+// cloudTraceID returns the trace ID of a X-Cloud-Trace-Context header value, or "" if v is
+// malformed.
+func cloudTraceID(v string) string {
+	// TRACE_ID/SPAN_ID;o=OPTIONS
+	id, _, _ := strings.Cut(v, "/")
+	if !isTraceID(id) {
+		return ""
+	}
+	return id
+}
+
+// isTraceID reports whether id is made of 32 hex digits. It is used instead of hex.DecodeString
+// so that reporting requests doesn't allocate.
+func isTraceID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestID returns r with a new random ID if it lacks one.
+func withRequestID(r *http.Request) *http.Request {
+	if RequestID(r) != "" {
+		return r
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, hex.EncodeToString(b[:])))
+}
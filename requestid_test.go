@@ -0,0 +1,107 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var tests = []struct {
+		name, header, traceparent, cloudTrace, want string
+	}{
+		{name: "header", header: "abc-123", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", want: "abc-123"},
+		{name: "traceparent", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", want: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{name: "cloud trace", cloudTrace: "105445aa7843bc8bf206b12000100000/1;o=1", want: "105445aa7843bc8bf206b12000100000"},
+		{name: "invalid cloud trace", cloudTrace: "1054/1;o=1"},
+		{name: "invalid traceparent", traceparent: "00-4bf92f35-00f067aa0ba902b7-01"},
+		{name: "zero trace ID", traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-Id", tt.header)
+			}
+			if tt.traceparent != "" {
+				r.Header.Set("traceparent", tt.traceparent)
+			}
+			if tt.cloudTrace != "" {
+				r.Header.Set("X-Cloud-Trace-Context", tt.cloudTrace)
+			}
+			if got := RequestID(r); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCorrelateRequests(t *testing.T) {
+	var tr testReportLogger
+	var handlerID string
+	p := ResourceIsolationPolicy(CorrelateRequests(), ReportTo(&tr))
+	h := p.ProtectLogOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerID = RequestID(r)
+	}), nil)
+	enforce := p.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(h http.Handler, site, id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("sec-fetch-site", site)
+		if id != "" {
+			r.Header.Set("X-Request-Id", id)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := send(enforce, "cross-site", "lb-42")
+	if got := w.Header().Get("X-Request-Id"); got != "lb-42" {
+		t.Errorf("got response ID %q, want lb-42", got)
+	}
+	if !strings.Contains(w.Body.String(), "lb-42") {
+		t.Errorf("got body %q, want it to contain the request ID", w.Body)
+	}
+	if len(tr.reps) != 1 || tr.reps[0].RequestID != "lb-42" {
+		t.Fatalf("got reports %+v, want one with ID lb-42", tr.reps)
+	}
+
+	tr.reps = nil
+	w = send(enforce, "cross-site", "")
+	id := w.Header().Get("X-Request-Id")
+	if len(id) != 32 {
+		t.Errorf("got generated ID %q, want 32 hex digits", id)
+	}
+	if len(tr.reps) != 1 || tr.reps[0].RequestID != id {
+		t.Fatalf("got reports %+v, want one with ID %q", tr.reps, id)
+	}
+
+	tr.reps = nil
+	send(h, "cross-site", "")
+	if handlerID == "" || len(tr.reps) != 1 || tr.reps[0].RequestID != handlerID {
+		t.Errorf("log-only: got handler ID %q and reports %+v, want matching IDs", handlerID, tr.reps)
+	}
+
+	// Allowed requests are not assigned IDs.
+	w = send(enforce, "same-origin", "")
+	if got := w.Header().Get("X-Request-Id"); got != "" {
+		t.Errorf("allowed request: got ID %q", got)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"hash/fnv"
+	"net"
+	"net/http"
+)
+
+// A KeyFunc returns a stable key identifying the client that sent a request, used to
+// deterministically assign clients to enforcement cohorts.
+type KeyFunc func(*http.Request) string
+
+// RemoteIPKey is a KeyFunc that returns the IP address of the client, taken from
+// http.Request.RemoteAddr. If the server is behind a proxy, this is the address of the proxy.
+func RemoteIPKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// CookieKey returns a KeyFunc that returns the value of the cookie with the given name, e.g. a
+// session cookie, so that users are consistently assigned to the same cohort across requests
+// and networks. Requests without the cookie have an empty key.
+func CookieKey(name string) KeyFunc {
+	return func(r *http.Request) string {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+}
+
+// EnforceCohort makes the policy enforce its decisions only for the given percentage of clients,
+// and only log the requests of the others, like ProtectRollout does for a single handler. This
+// applies to all the handlers of the policy, e.g.:
+//
+//	h := secfetch.ProtectHandler(mux, secfetch.EnforceCohort(10, secfetch.CookieKey("session")))
+//
+// Clients are consistently assigned to a cohort by hashing the value returned by key, so that
+// regressions can be attributed to the enforced cohort. Clients for which key returns an empty
+// value, e.g. users without a session, are only enforced with a percentage of 100.
+// EnforceCohort panics if percent is not between 0 and 100.
+func EnforceCohort(percent int, key KeyFunc) Option {
+	if percent < 0 || percent > 100 {
+		panic("secfetch: cohort percentage out of range")
+	}
+	return func(p *Policy) {
+		p.cohortPercent = percent
+		p.cohortKey = key
+	}
+}
+
+// ProtectRollout enforces p for the given percentage of clients, and behaves like ProtectLogOnly
+// for the others, so that enforcement can be ramped up gradually.
+//
+// Clients are assigned to the enforced cohort by hashing the value returned by key, so the same
+// client is consistently either protected or not as long as percent doesn't change, and
+// increasing percent only adds clients to the enforced cohort. Clients for which key returns an
+// empty value are only enforced with a percentage of 100.
+// ProtectRollout panics if percent is not between 0 and 100.
+func (p *Policy) ProtectRollout(h http.Handler, rl RequestLogger, percent int, key KeyFunc) http.Handler {
+	if percent < 0 || percent > 100 {
+		panic("secfetch: rollout percentage out of range")
+	}
+	return p.protect(h, rl, func(r *http.Request) Mode {
+		if inCohort(key(r), percent) {
+			return Enforce
+		}
+		return LogOnly
+	})
+}
+
+// inCohort reports whether key belongs to the first percent buckets out of 100. Empty keys only
+// belong to the cohort of all clients.
+func inCohort(key string, percent int) bool {
+	if percent >= 100 {
+		return true
+	}
+	if key == "" {
+		return false
+	}
+	f := fnv.New32a()
+	f.Write([]byte(key))
+	return int(f.Sum32()%100) < percent
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtectRollout(t *testing.T) {
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	p := ResourceIsolationPolicy()
+	send := func(h http.Handler, ip string) int {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.RemoteAddr = ip + ":1234"
+		r.Header.Set("sec-fetch-site", "cross-site")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	const clients = 1000
+	enforced := map[int]map[string]bool{}
+	for _, percent := range []int{0, 25, 50, 100} {
+		var tl testRequestLogger
+		h := p.ProtectRollout(noop, &tl, percent, RemoteIPKey)
+		enforced[percent] = map[string]bool{}
+		for i := 0; i < clients; i++ {
+			ip := fmt.Sprintf("192.0.%d.%d", i/256, i%256)
+			code := send(h, ip)
+			if code == http.StatusForbidden {
+				enforced[percent][ip] = true
+			}
+			// Assignment is stable.
+			if send(h, ip) != code {
+				t.Errorf("%d%%: client %s got different outcomes", percent, ip)
+			}
+		}
+		if got := len(enforced[percent]) + len(tl.rs)/2; got != clients {
+			t.Errorf("%d%%: got %d enforced and logged clients, want %d", percent, got, clients)
+		}
+		want := clients * percent / 100
+		if got := len(enforced[percent]); got < want-clients/20 || got > want+clients/20 {
+			t.Errorf("%d%%: got %d enforced clients, want about %d", percent, got, want)
+		}
+	}
+	// Increasing the percentage only adds clients to the enforced cohort.
+	for ip := range enforced[25] {
+		if !enforced[50][ip] {
+			t.Errorf("client %s enforced at 25%% but not at 50%%", ip)
+		}
+	}
+}
+
+func TestRemoteIPKey(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "[2001:db8::1]:443"
+	if got, want := RemoteIPKey(r), "2001:db8::1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	r.RemoteAddr = "@"
+	if got, want := RemoteIPKey(r), "@"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEnforceCohort(t *testing.T) {
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	send := func(h http.Handler, session string) int {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("Sec-Fetch-Site", "cross-site")
+		if session != "" {
+			r.AddCookie(&http.Cookie{Name: "session", Value: session})
+		}
+		// The cohort doesn't depend on the address of the client.
+		r.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", len(session))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	const users = 1000
+	for _, percent := range []int{0, 30, 100} {
+		var tl testReportLogger
+		h := ProtectHandler(noop, EnforceCohort(percent, CookieKey("session")), ReportTo(&tl))
+		enforced := 0
+		for i := 0; i < users; i++ {
+			session := fmt.Sprintf("session-%d", i)
+			code := send(h, session)
+			if code == http.StatusForbidden {
+				enforced++
+			}
+			if send(h, session) != code {
+				t.Errorf("%d%%: user %s got different outcomes", percent, session)
+			}
+		}
+		want := users * percent / 100
+		if enforced < want-users/20 || enforced > want+users/20 {
+			t.Errorf("%d%%: got %d enforced users, want about %d", percent, enforced, want)
+		}
+		// Every rejection is reported, whether enforced or not.
+		if len(tl.reps) != 2*users {
+			t.Errorf("%d%%: got %d reports, want %d", percent, len(tl.reps), 2*users)
+		}
+		wantAnonymous := http.StatusOK
+		if percent == 100 {
+			wantAnonymous = http.StatusForbidden
+		}
+		if got := send(h, ""); got != wantAnonymous {
+			t.Errorf("%d%%: request without session got status %d, want %d", percent, got, wantAnonymous)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("EnforceCohort(101): got no panic")
+		}
+	}()
+	EnforceCohort(101, RemoteIPKey)
+}
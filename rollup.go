@@ -0,0 +1,327 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A Count is the number of reports that shared a value over a period of time.
+type Count struct {
+	Value      string `json:"value"`
+	Blocked    uint64 `json:"blocked"`
+	WouldBlock uint64 `json:"would_block"`
+}
+
+// A Rollup summarizes the reports collected by an Aggregator over a window of time. The counts
+// of each dimension are sorted by decreasing total, then by value.
+type Rollup struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Total counts all the reports in the window, and has an empty Value.
+	Total Count `json:"total"`
+
+	Paths []Count `json:"paths"`
+	// Sites, Modes and Dests use the canonical Fetch Metadata values, see Decision.Canonical.
+	Sites []Count `json:"sites"`
+	Modes []Count `json:"modes"`
+	Dests []Count `json:"dests"`
+	// Origins are the values of the Origin header.
+	Origins []Count `json:"origins"`
+	// Referrers are the values of the Referer header, without query and fragment.
+	Referrers []Count `json:"referrers"`
+}
+
+// Dimensions of a Rollup, used to index aggBucket.counts.
+const (
+	dimPath = iota
+	dimSite
+	dimMode
+	dimDest
+	dimOrigin
+	dimReferrer
+	numDims
+)
+
+// maxRollupValues bounds the number of distinct values an Aggregator keeps for each dimension in
+// each bucket, as most of them are chosen by clients.
+const maxRollupValues = 1000
+
+type aggBucket struct {
+	start  time.Time
+	total  [2]uint64
+	counts [numDims]map[string]*[2]uint64
+}
+
+func (b *aggBucket) add(dim int, v string, i int) {
+	c, ok := b.counts[dim][v]
+	if !ok {
+		if len(b.counts[dim]) >= maxRollupValues {
+			v = "other"
+			if c, ok = b.counts[dim][v]; !ok {
+				c = new([2]uint64)
+				b.counts[dim][v] = c
+			}
+		} else {
+			c = new([2]uint64)
+			b.counts[dim][v] = c
+		}
+	}
+	c[i]++
+}
+
+// Aggregator is a ReportLogger and a RequestLogger that keeps rollups of recent reports in
+// memory, by path, site, mode, destination, origin and referrer, so that the effects of a policy
+// can be evaluated without an external analytics system, e.g. during a log-only rollout.
+//
+// Reports are counted in buckets of a fixed resolution, and Snapshot sums the buckets that fall
+// in a sliding window. To bound memory usage, once 1000 distinct values of a dimension have been
+// collected in a bucket, further new values are counted as "other".
+//
+// Rollups can be served to dashboards and administrators with Handler.
+type Aggregator struct {
+	resolution time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	buckets []aggBucket
+}
+
+// NewAggregator returns an Aggregator that keeps reports for retention, in buckets of
+// resolution. NewAggregator panics if resolution is not positive or is greater than retention.
+func NewAggregator(retention, resolution time.Duration) *Aggregator {
+	if resolution <= 0 || resolution > retention {
+		panic("secfetch: invalid Aggregator resolution")
+	}
+	n := int((retention + resolution - 1) / resolution)
+	return &Aggregator{resolution: resolution, now: time.Now, buckets: make([]aggBucket, n)}
+}
+
+// Retention returns the longest window that can be passed to Snapshot.
+func (a *Aggregator) Retention() time.Duration {
+	return time.Duration(len(a.buckets)) * a.resolution
+}
+
+// bucket returns the index of the bucket holding t, and the start of that bucket.
+func (a *Aggregator) bucket(t time.Time) (int, time.Time) {
+	start := t.Truncate(a.resolution)
+	n := start.UnixNano() / int64(a.resolution)
+	i := int(n % int64(len(a.buckets)))
+	if i < 0 {
+		i += len(a.buckets)
+	}
+	return i, start
+}
+
+// LogReport implements ReportLogger.
+func (a *Aggregator) LogReport(rep *Report) {
+	t := rep.Time
+	if t.IsZero() {
+		t = a.now()
+	}
+	idx, start := a.bucket(t)
+	if start.Add(a.Retention()).Before(a.now()) {
+		// Too old to ever show in a snapshot.
+		return
+	}
+	i := 1
+	if rep.Enforced {
+		i = 0
+	}
+	d := Decision{Site: rep.Site, Mode: rep.Mode, Dest: rep.Dest}.Canonical()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := &a.buckets[idx]
+	if !b.start.Equal(start) {
+		if b.start.After(start) {
+			// The slot already holds a newer bucket.
+			return
+		}
+		*b = aggBucket{start: start}
+		for j := range b.counts {
+			b.counts[j] = make(map[string]*[2]uint64)
+		}
+	}
+	b.total[i]++
+	b.add(dimPath, rep.Path, i)
+	b.add(dimSite, d.Site, i)
+	b.add(dimMode, d.Mode, i)
+	b.add(dimDest, d.Dest, i)
+	b.add(dimOrigin, rep.Origin, i)
+	b.add(dimReferrer, stripReferrer(rep.Referer), i)
+}
+
+// stripReferrer removes the query and the fragment from ref, which may hold secrets and make
+// every value distinct.
+func stripReferrer(ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "other"
+	}
+	u.RawQuery, u.ForceQuery, u.Fragment, u.RawFragment = "", false, "", ""
+	return u.String()
+}
+
+// LogRequest implements RequestLogger by converting r to a Report.
+func (a *Aggregator) LogRequest(r *http.Request) {
+	LogRequestReport(a, r)
+}
+
+// Snapshot returns the rollup of the reports collected in the last window, rounded up to the
+// resolution of a. Windows longer than the retention of a are shortened to it.
+func (a *Aggregator) Snapshot(window time.Duration) *Rollup {
+	if window > a.Retention() {
+		window = a.Retention()
+	}
+	_, end := a.bucket(a.now())
+	end = end.Add(a.resolution)
+	start := end.Add(-window).Truncate(a.resolution)
+	if !start.Before(end) {
+		start = end.Add(-a.resolution)
+	}
+
+	var sums [numDims]map[string]*[2]uint64
+	for j := range sums {
+		sums[j] = make(map[string]*[2]uint64)
+	}
+	rl := &Rollup{Start: start, End: end}
+	a.mu.Lock()
+	for _, b := range a.buckets {
+		if b.start.Before(start) || !b.start.Before(end) {
+			continue
+		}
+		rl.Total.Blocked += b.total[0]
+		rl.Total.WouldBlock += b.total[1]
+		for j, counts := range b.counts {
+			for v, c := range counts {
+				s, ok := sums[j][v]
+				if !ok {
+					s = new([2]uint64)
+					sums[j][v] = s
+				}
+				s[0] += c[0]
+				s[1] += c[1]
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	rl.Paths = sortCounts(sums[dimPath])
+	rl.Sites = sortCounts(sums[dimSite])
+	rl.Modes = sortCounts(sums[dimMode])
+	rl.Dests = sortCounts(sums[dimDest])
+	rl.Origins = sortCounts(sums[dimOrigin])
+	rl.Referrers = sortCounts(sums[dimReferrer])
+	return rl
+}
+
+func sortCounts(m map[string]*[2]uint64) []Count {
+	cs := make([]Count, 0, len(m))
+	for v, c := range m {
+		cs = append(cs, Count{Value: v, Blocked: c[0], WouldBlock: c[1]})
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		ti, tj := cs[i].Blocked+cs[i].WouldBlock, cs[j].Blocked+cs[j].WouldBlock
+		if ti != tj {
+			return ti > tj
+		}
+		return cs[i].Value < cs[j].Value
+	})
+	return cs
+}
+
+// defaultRollupLimit is the number of values per dimension served by Aggregator.Handler by default.
+const defaultRollupLimit = 20
+
+// Handler returns a handler that serves the rollup of the reports collected by a, as JSON, or as
+// CSV with the "format=csv" query parameter. The rows of the CSV are the dimension (e.g. "path",
+// "origin"), the value, and the number of blocked and would-block reports.
+//
+// The "window" query parameter sets the window of the rollup as a duration, e.g. "15m", and
+// defaults to the retention of a. The "limit" query parameter sets the number of top values
+// served for each dimension, and defaults to 20.
+//
+// The response discloses details of the rejected requests, so the handler must only be served to
+// administrators, e.g. on an internal port.
+func (a *Aggregator) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		window := a.Retention()
+		if v := q.Get("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				http.Error(w, "invalid window", http.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+		limit := defaultRollupLimit
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		rl := a.Snapshot(window).top(limit)
+
+		w.Header().Set("Cache-Control", "no-store")
+		switch q.Get("format") {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			enc.Encode(rl)
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"dimension", "value", "blocked", "would_block"})
+			write := func(dim string, cs []Count) {
+				for _, c := range cs {
+					cw.Write([]string{dim, c.Value, strconv.FormatUint(c.Blocked, 10), strconv.FormatUint(c.WouldBlock, 10)})
+				}
+			}
+			write("total", []Count{rl.Total})
+			write("path", rl.Paths)
+			write("site", rl.Sites)
+			write("mode", rl.Modes)
+			write("dest", rl.Dests)
+			write("origin", rl.Origins)
+			write("referrer", rl.Referrers)
+			cw.Flush()
+		default:
+			http.Error(w, "invalid format", http.StatusBadRequest)
+		}
+	})
+}
+
+// top truncates the counts of each dimension of rl to the first n.
+func (rl *Rollup) top(n int) *Rollup {
+	for _, cs := range []*[]Count{&rl.Paths, &rl.Sites, &rl.Modes, &rl.Dests, &rl.Origins, &rl.Referrers} {
+		if len(*cs) > n {
+			*cs = (*cs)[:n]
+		}
+	}
+	return rl
+}
@@ -0,0 +1,193 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAggregator(t *testing.T) {
+	t0 := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	a := NewAggregator(time.Hour, time.Minute)
+	a.now = func() time.Time { return t0.Add(30*time.Minute + 30*time.Second) }
+	reps := []Report{
+		{Time: t0, Enforced: true, Path: "/old", Site: "cross-site", Mode: "cors", Dest: "empty"},
+		{Time: t0.Add(25 * time.Minute), Enforced: true, Path: "/a", Site: "cross-site", Mode: "no-cors", Dest: "image", Origin: "https://evil.example"},
+		{Time: t0.Add(29 * time.Minute), Path: "/a", Site: "cross-site", Mode: "navigate", Dest: "iframe", Referer: "https://evil.example/x?secret=1#f"},
+		{Time: t0.Add(30 * time.Minute), Enforced: true, Path: "/b", Site: "same-site", Mode: "cors", Dest: "empty", Origin: "https://sub.example"},
+		{Time: t0.Add(30 * time.Minute), Path: "/a", Site: "weird", Mode: "cors", Dest: "empty", Referer: "https://evil.example/x?other=2"},
+		// Older than the retention.
+		{Time: t0.Add(-time.Hour), Enforced: true, Path: "/ancient"},
+	}
+	for i := range reps {
+		a.LogReport(&reps[i])
+	}
+
+	got := a.Snapshot(10 * time.Minute)
+	want := &Rollup{
+		Start: t0.Add(21 * time.Minute),
+		End:   t0.Add(31 * time.Minute),
+		Total: Count{Blocked: 2, WouldBlock: 2},
+		Paths: []Count{{Value: "/a", Blocked: 1, WouldBlock: 2}, {Value: "/b", Blocked: 1}},
+		Sites: []Count{{Value: "cross-site", Blocked: 1, WouldBlock: 1}, {Value: "other", WouldBlock: 1}, {Value: "same-site", Blocked: 1}},
+		Modes: []Count{{Value: "cors", Blocked: 1, WouldBlock: 1}, {Value: "navigate", WouldBlock: 1}, {Value: "no-cors", Blocked: 1}},
+		Dests: []Count{{Value: "empty", Blocked: 1, WouldBlock: 1}, {Value: "iframe", WouldBlock: 1}, {Value: "image", Blocked: 1}},
+		Origins: []Count{
+			{Value: "", WouldBlock: 2},
+			{Value: "https://evil.example", Blocked: 1},
+			{Value: "https://sub.example", Blocked: 1},
+		},
+		Referrers: []Count{{Value: "", Blocked: 2}, {Value: "https://evil.example/x", WouldBlock: 2}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Snapshot(10m):\ngot  %+v\nwant %+v", got, want)
+	}
+
+	got = a.Snapshot(time.Minute)
+	if want := (Count{Blocked: 1, WouldBlock: 1}); got.Total != want {
+		t.Errorf("Snapshot(1m): got total %+v, want %+v", got.Total, want)
+	}
+	got = a.Snapshot(24 * time.Hour)
+	if want := (Count{Blocked: 3, WouldBlock: 2}); got.Total != want {
+		t.Errorf("Snapshot(24h): got total %+v, want %+v", got.Total, want)
+	}
+	if want := t0.Add(-29 * time.Minute); !got.Start.Equal(want) {
+		t.Errorf("Snapshot(24h): got start %v, want %v", got.Start, want)
+	}
+
+	// Buckets are reused once they slide out of the retention.
+	a.now = func() time.Time { return t0.Add(time.Hour + 30*time.Minute) }
+	a.LogReport(&Report{Time: t0.Add(time.Hour + 30*time.Minute), Path: "/new"})
+	got = a.Snapshot(time.Hour)
+	if len(got.Paths) != 1 || got.Paths[0].Value != "/new" {
+		t.Errorf("after an hour: got paths %+v, want only /new", got.Paths)
+	}
+}
+
+func TestAggregatorMaxValues(t *testing.T) {
+	a := NewAggregator(time.Minute, time.Minute)
+	for i := 0; i < maxRollupValues+10; i++ {
+		a.LogReport(&Report{Path: fmt.Sprintf("/%d", i)})
+	}
+	got := a.Snapshot(time.Minute)
+	if len(got.Paths) != maxRollupValues+1 {
+		t.Fatalf("got %d paths, want %d", len(got.Paths), maxRollupValues+1)
+	}
+	if want := (Count{Value: "other", WouldBlock: 10}); got.Paths[0] != want {
+		t.Errorf("got first path %+v, want %+v", got.Paths[0], want)
+	}
+}
+
+func TestAggregatorLogOnly(t *testing.T) {
+	a := NewAggregator(time.Minute, time.Second)
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := ProtectHandlerLogOnly(noop, nil, ReportTo(a))
+	r := httptest.NewRequest("POST", "/submit", nil)
+	r.Header.Set("sec-fetch-site", "cross-site")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	got := a.Snapshot(time.Minute)
+	if want := (Count{WouldBlock: 1}); got.Total != want {
+		t.Errorf("got total %+v, want %+v", got.Total, want)
+	}
+}
+
+func TestAggregatorHandler(t *testing.T) {
+	t0 := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	a := NewAggregator(time.Hour, time.Minute)
+	a.now = func() time.Time { return t0 }
+	for i, path := range []string{"/a", "/a", "/b", "/c"} {
+		a.LogReport(&Report{Time: t0, Enforced: i%2 == 0, Path: path, Site: "cross-site", Origin: "https://evil.example"})
+	}
+	a.LogReport(&Report{Time: t0.Add(-30 * time.Minute), Enforced: true, Path: "/old"})
+
+	var tests = []struct {
+		name, query string
+		wantStatus  int
+		wantType    string
+		wantBody    string
+	}{
+		{
+			name:       "json",
+			query:      "?window=5m&limit=1",
+			wantStatus: http.StatusOK,
+			wantType:   "application/json",
+		},
+		{
+			name:       "csv",
+			query:      "?format=csv&window=5m&limit=2",
+			wantStatus: http.StatusOK,
+			wantType:   "text/csv; charset=utf-8",
+			wantBody: `dimension,value,blocked,would_block
+total,,2,2
+path,/a,1,1
+path,/b,1,0
+site,cross-site,2,2
+mode,,2,2
+dest,,2,2
+origin,https://evil.example,2,2
+referrer,,2,2
+`,
+		},
+		{name: "bad window", query: "?window=soon", wantStatus: http.StatusBadRequest},
+		{name: "bad limit", query: "?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "bad format", query: "?format=xml", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			a.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/rollup"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("got Content-Type %q, want %q", got, tt.wantType)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("got body:\n%s\nwant:\n%s", w.Body, tt.wantBody)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	a.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/rollup?limit=1", nil))
+	var got Rollup
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("cannot decode %q: %v", w.Body.String(), err)
+	}
+	if want := (Count{Blocked: 3, WouldBlock: 2}); got.Total != want {
+		t.Errorf("got total %+v, want %+v", got.Total, want)
+	}
+	if want := []Count{{Value: "/a", Blocked: 1, WouldBlock: 1}}; !reflect.DeepEqual(got.Paths, want) {
+		t.Errorf("got paths %+v, want %+v", got.Paths, want)
+	}
+}
+
+func TestNewAggregatorPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewAggregator did not panic")
+		}
+	}()
+	NewAggregator(time.Second, time.Minute)
+}
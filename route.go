@@ -0,0 +1,101 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import "net/http"
+
+// A route rule applies an action to the requests with a method and a path.
+type routeRule struct {
+	// desc describes the rule in the policy configuration.
+	desc   string
+	method string
+	globs  [][]string
+	// when, if not nil, restricts the rule to the requests it returns true for. It takes the
+	// Decision by value, so that calling it doesn't move the Decision being built to the heap.
+	when func(*http.Request, Decision) bool
+	// rule and allow are the decision of the rule.
+	rule  Rule
+	allow bool
+	// verify, if not nil, decides instead of allow, see Webhook.
+	verify func(*http.Request, []byte) bool
+}
+
+func (rr *routeRule) match(r *http.Request, d *Decision) bool {
+	if rr.method != "*" && rr.method != r.Method {
+		return false
+	}
+	return matchGlobs(rr.globs, r.URL.Path) && (rr.when == nil || rr.when(r, *d))
+}
+
+// AllowCrossSite allows requests with the given method whose path matches pattern, regardless
+// of their Fetch Metadata, e.g. for incoming webhooks and third-party callbacks:
+//
+//	secfetch.AllowCrossSite("POST", "/webhooks/*")
+//
+// The method "" or "*" matches any method. Patterns have the syntax of ExemptPaths.
+//
+// Route rules are evaluated after exemptions and before any other check, in the order they
+// are passed to ResourceIsolationPolicy, and the first matching rule applies. Allowed requests
+// are reported with RuleRouteAllowed. AllowCrossSite panics if pattern is malformed.
+func AllowCrossSite(method, pattern string) Option {
+	return routeOption("allow-cross-site", method, pattern, RuleRouteAllowed, true)
+}
+
+// DenyAll rejects all the requests with the given method whose path matches pattern, even
+// same-origin ones, e.g. to keep browsers away from administrative APIs meant for other
+// clients:
+//
+//	secfetch.DenyAll("PUT", "/admin/*")
+//
+// Rejected requests are reported with RuleRouteDenied. See AllowCrossSite for the syntax and
+// the evaluation order of route rules. DenyAll panics if pattern is malformed.
+func DenyAll(method, pattern string) Option {
+	return routeOption("deny-all", method, pattern, RuleRouteDenied, false)
+}
+
+func routeOption(action, method, pattern string, rule Rule, allow bool) Option {
+	if method == "" {
+		method = "*"
+	}
+	rr := routeRule{
+		desc:   action + " " + method + " " + pattern,
+		method: method,
+		globs:  compileGlobs([]string{pattern}),
+		rule:   rule,
+		allow:  allow,
+	}
+	return func(p *Policy) {
+		p.routes = append(p.routes, rr)
+	}
+}
+
+// checkRoutes applies the first route rule matching r, if any. The returned matched reports
+// whether a rule matched.
+func (p *Policy) checkRoutes(r *http.Request, d *Decision) (rule Rule, allowed, matched bool) {
+	for i := range p.routes {
+		rr := &p.routes[i]
+		if !rr.match(r, d) {
+			continue
+		}
+		if rr.verify != nil {
+			if verifyWebhook(r, rr.verify) {
+				return RuleWebhook, true, true
+			}
+			return RuleWebhookSignature, false, true
+		}
+		return rr.rule, rr.allow, true
+	}
+	return "", false, false
+}
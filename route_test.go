@@ -0,0 +1,72 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouteRules(t *testing.T) {
+	p := ResourceIsolationPolicy(
+		ExemptPaths("/admin/public"),
+		AllowCrossSite("POST", "/webhooks/*"),
+		DenyAll("PUT", "/admin/*"),
+		DenyAll("", "/webhooks/internal"),
+		AllowCrossSite("*", "/callbacks/**"),
+	)
+	var tests = []struct {
+		name, method, path, site string
+		want                     bool
+		wantRule                 Rule
+	}{
+		{name: "allowed webhook", method: "POST", path: "/webhooks/github", site: "cross-site", want: true, wantRule: RuleRouteAllowed},
+		{name: "webhook method mismatch", method: "PUT", path: "/webhooks/github", site: "cross-site", wantRule: RuleCrossSiteMethod},
+		{name: "first rule wins", method: "POST", path: "/webhooks/internal", site: "cross-site", want: true, wantRule: RuleRouteAllowed},
+		{name: "any method denied", method: "GET", path: "/webhooks/internal", site: "same-origin", wantRule: RuleRouteDenied},
+		{name: "denied same-origin", method: "PUT", path: "/admin/users", site: "same-origin", wantRule: RuleRouteDenied},
+		{name: "denied without metadata", method: "PUT", path: "/admin/users", wantRule: RuleRouteDenied},
+		{name: "exemptions first", method: "PUT", path: "/admin/public", site: "cross-site", want: true, wantRule: RuleExempt},
+		{name: "denied method mismatch", method: "GET", path: "/admin/users", site: "same-origin", want: true, wantRule: RuleTrustedSite},
+		{name: "any method allowed", method: "DELETE", path: "/callbacks/a/b", site: "cross-site", want: true, wantRule: RuleRouteAllowed},
+		{name: "no rule", method: "POST", path: "/", site: "cross-site", wantRule: RuleCrossSiteMethod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.site != "" {
+				r.Header.Set("sec-fetch-site", tt.site)
+			}
+			d := p.Check(r)
+			if d.Allowed != tt.want || d.Rule != tt.wantRule {
+				t.Errorf("got %v, want allowed %v by %q", d, tt.want, tt.wantRule)
+			}
+		})
+	}
+	want := []string{"allow-cross-site POST /webhooks/*", "deny-all PUT /admin/*", "deny-all * /webhooks/internal", "allow-cross-site * /callbacks/**"}
+	if got := p.describe().Routes; !reflect.DeepEqual(got, want) {
+		t.Errorf("got description %q, want %q", got, want)
+	}
+}
+
+func TestRouteRulesMalformed(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("AllowCrossSite did not panic")
+		}
+	}()
+	AllowCrossSite("POST", "/[a")
+}
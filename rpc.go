@@ -0,0 +1,68 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// AllowRPCOrigins allows browsers on the given origins, for example "https://app.example", to
+// make cross-site gRPC-Web and Connect calls to the protected handlers.
+//
+// Unlike AllowOrigins, which allows any request from the origins, only CORS calls that were
+// preflighted are allowed: calls must have Sec-Fetch-Mode "cors", and a gRPC-Web or Connect
+// content type or the Connect-Protocol-Version header, which browsers never send cross-site
+// without a successful CORS preflight. The preflights themselves are also allowed. Calls from
+// other origins, and other requests from the given ones, are subject to the rest of the policy.
+//
+// The CORS configuration of the server must allow the same origins for the calls to succeed.
+func AllowRPCOrigins(origins ...string) Option {
+	return func(p *Policy) {
+		if p.rpcOrigins == nil {
+			p.rpcOrigins = make(map[string]bool, len(origins))
+		}
+		for _, o := range origins {
+			p.rpcOrigins[normalizeOrigin(o)] = true
+		}
+	}
+}
+
+func (p *Policy) allowedRPC(r *http.Request, d *Decision) bool {
+	if len(p.rpcOrigins) == 0 || d.Mode != "cors" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" || !p.rpcOrigins[normalizeOrigin(origin)] {
+		return false
+	}
+	if r.Method == http.MethodOptions {
+		return isPreflight(r)
+	}
+	return r.Method == http.MethodPost && isRPC(r)
+}
+
+// isRPC reports whether r is a gRPC-Web or Connect call that requires a CORS preflight.
+func isRPC(r *http.Request) bool {
+	if r.Header.Get("Connect-Protocol-Version") != "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mt, "application/grpc-web") || strings.HasPrefix(mt, "application/connect+")
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowRPCOrigins(t *testing.T) {
+	p := ResourceIsolationPolicy(AllowRPCOrigins("https://app.example/"))
+	var tests = []struct {
+		name    string
+		method  string
+		mode    string
+		origin  string
+		headers map[string]string
+		want    Decision
+	}{
+		{
+			name:    "grpc-web",
+			method:  "POST",
+			mode:    "cors",
+			origin:  "https://app.example",
+			headers: map[string]string{"content-type": "application/grpc-web+proto"},
+			want:    Decision{Allowed: true, Rule: RuleRPCOrigin},
+		},
+		{
+			name:    "grpc-web-text",
+			method:  "POST",
+			mode:    "cors",
+			origin:  "https://APP.example",
+			headers: map[string]string{"content-type": "application/grpc-web-text"},
+			want:    Decision{Allowed: true, Rule: RuleRPCOrigin},
+		},
+		{
+			name:    "connect unary",
+			method:  "POST",
+			mode:    "cors",
+			origin:  "https://app.example",
+			headers: map[string]string{"content-type": "application/json", "connect-protocol-version": "1"},
+			want:    Decision{Allowed: true, Rule: RuleRPCOrigin},
+		},
+		{
+			name:    "connect streaming",
+			method:  "POST",
+			mode:    "cors",
+			origin:  "https://app.example",
+			headers: map[string]string{"content-type": "application/connect+proto"},
+			want:    Decision{Allowed: true, Rule: RuleRPCOrigin},
+		},
+		{
+			name:    "preflight",
+			method:  "OPTIONS",
+			mode:    "cors",
+			origin:  "https://app.example",
+			headers: map[string]string{"access-control-request-method": "POST"},
+			want:    Decision{Allowed: true, Rule: RuleRPCOrigin},
+		},
+		{
+			name:    "not preflighted",
+			method:  "POST",
+			mode:    "cors",
+			origin:  "https://app.example",
+			headers: map[string]string{"content-type": "text/plain"},
+			want:    Decision{Rule: RuleCrossSiteMethod},
+		},
+		{
+			name:    "no-cors",
+			method:  "POST",
+			mode:    "no-cors",
+			origin:  "https://app.example",
+			headers: map[string]string{"content-type": "application/grpc-web"},
+			want:    Decision{Rule: RuleCrossSiteMethod},
+		},
+		{
+			name:    "other origin",
+			method:  "POST",
+			mode:    "cors",
+			origin:  "https://evil.example",
+			headers: map[string]string{"content-type": "application/grpc-web"},
+			want:    Decision{Rule: RuleCrossSiteMethod},
+		},
+		{
+			name:    "null origin",
+			method:  "POST",
+			mode:    "cors",
+			origin:  "null",
+			headers: map[string]string{"content-type": "application/grpc-web"},
+			want:    Decision{Rule: RuleCrossSiteMethod},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/pkg.Service/Method", nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", "empty")
+			r.Header.Set("origin", tt.origin)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			got := p.Check(r)
+			if got.Allowed != tt.want.Allowed || got.Rule != tt.want.Rule {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SampledLogger is a ReportLogger and a RequestLogger that only forwards one report out of every
+// N to another ReportLogger.
+type SampledLogger struct {
+	rl    ReportLogger
+	n     uint64
+	count atomic.Uint64
+}
+
+// NewSampledLogger returns a SampledLogger that forwards the first report out of every n to rl.
+// NewSampledLogger panics if n is less than one.
+func NewSampledLogger(rl ReportLogger, n int) *SampledLogger {
+	if n < 1 {
+		panic("secfetch: invalid SampledLogger rate")
+	}
+	return &SampledLogger{rl: rl, n: uint64(n)}
+}
+
+// LogReport implements ReportLogger.
+func (l *SampledLogger) LogReport(rep *Report) {
+	if (l.count.Add(1)-1)%l.n == 0 {
+		l.rl.LogReport(rep)
+	}
+}
+
+// LogRequest implements RequestLogger by converting r to a Report.
+func (l *SampledLogger) LogRequest(r *http.Request) {
+	LogRequestReport(l, r)
+}
+
+// RateLimitedLogger is a ReportLogger and a RequestLogger that forwards at most a fixed number of
+// reports per second to another ReportLogger, and drops the others.
+type RateLimitedLogger struct {
+	rl      ReportLogger
+	limit   int
+	dropped atomic.Uint64
+	now     func() time.Time
+
+	mu     sync.Mutex
+	window time.Time
+	count  int
+}
+
+// NewRateLimitedLogger returns a RateLimitedLogger that forwards at most perSecond reports
+// every second to rl. NewRateLimitedLogger panics if perSecond is less than one.
+func NewRateLimitedLogger(rl ReportLogger, perSecond int) *RateLimitedLogger {
+	if perSecond < 1 {
+		panic("secfetch: invalid RateLimitedLogger rate")
+	}
+	return &RateLimitedLogger{rl: rl, limit: perSecond, now: time.Now}
+}
+
+// LogReport implements ReportLogger.
+func (l *RateLimitedLogger) LogReport(rep *Report) {
+	if !l.allow() {
+		l.dropped.Add(1)
+		return
+	}
+	l.rl.LogReport(rep)
+}
+
+func (l *RateLimitedLogger) allow() bool {
+	now := l.now().Truncate(time.Second)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !now.Equal(l.window) {
+		l.window, l.count = now, 0
+	}
+	if l.count >= l.limit {
+		return false
+	}
+	l.count++
+	return true
+}
+
+// LogRequest implements RequestLogger by converting r to a Report.
+func (l *RateLimitedLogger) LogRequest(r *http.Request) {
+	LogRequestReport(l, r)
+}
+
+// Dropped returns the number of reports that were dropped because of the rate limit.
+func (l *RateLimitedLogger) Dropped() uint64 {
+	return l.dropped.Load()
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSampledLogger(t *testing.T) {
+	var tl testReportLogger
+	l := NewSampledLogger(&tl, 3)
+	for i := 0; i < 9; i++ {
+		l.LogReport(&Report{Path: string(rune('a' + i))})
+	}
+	var got string
+	for _, rep := range tl.reps {
+		got += rep.Path
+	}
+	if want := "adg"; got != want {
+		t.Errorf("got reports %q, want %q", got, want)
+	}
+
+	l.LogRequest(httptest.NewRequest("POST", "/sampled", nil))
+	l.LogRequest(httptest.NewRequest("POST", "/dropped", nil))
+	if last := tl.reps[len(tl.reps)-1]; len(tl.reps) != 4 || last.Path != "/sampled" || last.Enforced {
+		t.Errorf("LogRequest: got reports %+v", tl.reps)
+	}
+}
+
+func TestRateLimitedLogger(t *testing.T) {
+	var tl testReportLogger
+	l := NewRateLimitedLogger(&tl, 2)
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	steps := []struct {
+		advance    time.Duration
+		wantLogged int
+	}{
+		{advance: 0, wantLogged: 1},
+		{advance: 100 * time.Millisecond, wantLogged: 2},
+		{advance: 100 * time.Millisecond, wantLogged: 2},
+		{advance: 700 * time.Millisecond, wantLogged: 2},
+		{advance: 100 * time.Millisecond, wantLogged: 3},
+		{advance: 0, wantLogged: 4},
+		{advance: 0, wantLogged: 4},
+		{advance: 5 * time.Second, wantLogged: 5},
+	}
+	for i, s := range steps {
+		now = now.Add(s.advance)
+		l.LogReport(&Report{})
+		if got := len(tl.reps); got != s.wantLogged {
+			t.Errorf("step %d: got %d logged reports, want %d", i, got, s.wantLogged)
+		}
+	}
+	if got, want := l.Dropped(), uint64(len(steps)-len(tl.reps)); got != want {
+		t.Errorf("got %d dropped reports, want %d", got, want)
+	}
+}
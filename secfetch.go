@@ -17,81 +17,222 @@
 //
 // Suggested usage is to protect the entire http.Server.Handler and not single handlers.
 // Example usage:
-// 	srv := http.Server{
-// 		Handler: secfetch.ProtectHandler(myServeMux),
-// 		// Rest of configuration here.
-// 	}
 //
-// This package supports a log-only mode to ease deployment and test the configuration before enforcing it.
+//	srv := http.Server{
+//		Handler: secfetch.ProtectHandler(myServeMux),
+//		// Rest of configuration here.
+//	}
+//
+// ProtectHandler uses the ResourceIsolationPolicy, which can be adjusted by passing Options.
+// Policies can also be built explicitly, to be shared between handlers or to switch presets:
+//
+//	p := secfetch.ResourceIsolationPolicy(secfetch.FramingIsolation())
+//	srv := http.Server{
+//		Handler: p.Protect(myServeMux),
+//	}
+//
+// This package supports a log-only mode to ease deployment and test the configuration before enforcing it,
+// and a disabled mode that only records decisions in metrics, see ProtectHandlerMode.
 //
 // It is possible to exempt some handlers by registering them on a http.ServeMux after a previous
 // one has been protected. A use case for this is CORS APIs that need to reply to cross-site
 // requests.
 // Example:
-// 	var pmux http.ServeMux
-// 	pmux.Handle("/protected1", protHandler1)
-// 	pmux.Handle("/protected2", protHandler2)
-// 	var mux http.ServeMux
-// 	mux.Handle("/", secfetch.ProtectHandler(&pmux))
-// 	mux.Handle("/unprotected", publicHandler)
+//
+//	var pmux http.ServeMux
+//	pmux.Handle("/protected1", protHandler1)
+//	pmux.Handle("/protected2", protHandler2)
+//	var mux http.ServeMux
+//	mux.Handle("/", secfetch.ProtectHandler(&pmux))
+//	mux.Handle("/unprotected", publicHandler)
+//
+// Exemptions can also be declared alongside the policy, or alongside the routes with Exempt:
+//
+//	secfetch.ProtectHandler(mux, secfetch.ExemptPaths("/unprotected"))
+//	mux.Handle("/unprotected", secfetch.Exempt(publicHandler))
+//
+// For routers and libraries that chain middlewares, Middleware returns the protection in the
+// func(http.Handler) http.Handler form.
 package secfetch
 
 import (
 	"fmt"
 	"net/http"
+	"time"
 )
 
-func allowed(r *http.Request) bool {
-	site := r.Header.Get("sec-fetch-site")
-	mode := r.Header.Get("sec-fetch-mode")
-
-	// This allows same-site requests.
-	// To harden this protection uncomment the second condition.
-	if site != "cross-site" /*&& site != "same-site"*/ {
-		return true
-	}
-
-	// https://github.com/w3c/webappsec-fetch-metadata/issues/35
-	// https://bugs.chromium.org/p/chromium/issues/detail?id=979946
-	if mode == "" && r.Method == http.MethodOptions {
-		return true
-	}
+// ProtectHandler isolates h from potentially malicious requests using the
+// ResourceIsolationPolicy configured with opts.
+func ProtectHandler(h http.Handler, opts ...Option) http.Handler {
+	return ResourceIsolationPolicy(opts...).Protect(h)
+}
 
-	// Here site is "cross-site", so let's just allow non-state-changing navigations
-	if (mode == "navigate" || mode == "nested-navigate") &&
-		(r.Method == http.MethodGet || r.Method == http.MethodHead) {
-		return true
-	}
+// Middleware returns a middleware that isolates handlers using the ResourceIsolationPolicy
+// configured with opts, to be used with routers and chaining libraries:
+//
+//	r.Use(secfetch.Middleware(secfetch.FramingIsolation()))
+//
+// All the handlers wrapped by the returned middleware share the same Policy. For an existing
+// Policy, the method value p.Protect can be used instead.
+func Middleware(opts ...Option) func(http.Handler) http.Handler {
+	return ResourceIsolationPolicy(opts...).Protect
+}
 
-	// Cross-site potentially dangerous request, reject.
-	return false
+// Protect isolates h from the requests rejected by p.
+//
+// If p is in LogOnly mode, see Policy.SetMode, rejected requests are only reported and still
+// reach h.
+func (p *Policy) Protect(h http.Handler) http.Handler {
+	return p.protect(h, nil, func(*http.Request) Mode { return Enforce })
 }
 
-// ProtectHandler isolates h from potentially malicious requests.
-func ProtectHandler(h http.Handler) http.Handler {
+// protect returns a handler that evaluates requests against p in the mode returned by mode.
+func (p *Policy) protect(h http.Handler, rl RequestLogger, mode func(*http.Request) Mode) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !allowed(r) {
-			w.WriteHeader(http.StatusForbidden)
-			fmt.Fprintln(w, "Invalid resource access")
+		if exemptRoute(h, r) {
+			r = withExemption(r)
+		}
+		r, reject := p.handle(w, r, mode(r), rl, nil)
+		if reject {
+			p.ServeDenied(w, r)
 			return
 		}
 		h.ServeHTTP(w, r)
 	})
 }
 
+// handle evaluates r in mode m, capped by the mode of p, and reports whether r must be rejected.
+// If cd is not nil, it is used instead of checking r.
+func (p *Policy) handle(w http.ResponseWriter, r *http.Request, m Mode, rl RequestLogger, cd *Decision) (*http.Request, bool) {
+	if pm := p.Mode(); pm > m {
+		m = pm
+	}
+	if m == Enforce && p.cohortKey != nil && !inCohort(p.cohortKey(r), p.cohortPercent) {
+		m = LogOnly
+	}
+	if p.speculation == SpeculationLogOnly && m < LogOnly && isSpeculative(r) {
+		m = LogOnly
+	}
+	if m == Off {
+		return r, false
+	}
+	if m == Enforce && p.varyHeader != nil {
+		addVary(w.Header(), p.varyHeader)
+	}
+	d, r := p.evaluate(w, r, m, cd)
+	if d.Allowed {
+		return p.markSpeculative(r), false
+	}
+	if m == Enforce {
+		return r, true
+	}
+	if rl != nil && m == LogOnly {
+		rl.LogRequest(p.redact(r))
+	}
+	return p.markSpeculative(r), false
+}
+
+// evaluate checks r against p in mode m, unless cd is not nil, and performs all the side effects
+// of the decision except serving the response. It returns r with the decision stored in its
+// context.
+func (p *Policy) evaluate(w http.ResponseWriter, r *http.Request, m Mode, cd *Decision) (Decision, *http.Request) {
+	var start time.Time
+	if len(p.metrics) > 0 {
+		start = time.Now()
+	}
+	var d Decision
+	if cd != nil {
+		d = *cd
+	} else {
+		d = p.Check(r)
+	}
+	if !d.Allowed && p.correlate && m != Disabled {
+		r = withRequestID(r)
+	}
+	if !d.Allowed && p.captureBody > 0 && m != Disabled {
+		p.captureRequestBody(r)
+	}
+	p.stats.record(r, d, m)
+	for _, br := range p.blockRates {
+		br.record(!d.Allowed)
+	}
+	if len(p.metrics) > 0 {
+		ms := &Measurement{Decision: d, Mode: m, Outcome: outcome(d, m), Elapsed: time.Since(start)}
+		for _, mr := range p.metrics {
+			mr.RecordDecision(r.Context(), ms)
+		}
+	}
+	if !d.Allowed || !p.noDecisionContext {
+		r = withDecision(r, d)
+	}
+	if m == Disabled {
+		// Decisions are only measured, requests are not affected.
+		return d, r
+	}
+	p.setDebugHeader(w, d, m)
+	if d.refererLogOnly {
+		p.refererLogger.LogRequest(p.redact(r))
+	}
+	if !d.Allowed {
+		p.report(r, d, m == Enforce)
+	}
+	p.runHooks(r, d, m)
+	return d, r
+}
+
+// Evaluate applies p to r like the handlers returned by Protect do, for frameworks that cannot
+// use net/http middlewares: it sets the Vary and debug headers on w, records and reports the
+// decision, and returns r with the Decision attached to its context, see FromContext.
+//
+// The returned bool reports whether r must be rejected, in which case the caller must not serve
+// r, and should reply with ServeDenied or the equivalent error of its framework.
+func (p *Policy) Evaluate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	return p.handle(w, r, Enforce, nil, nil)
+}
+
+// EvaluateDecision is like Evaluate, but applies d instead of checking r, for frameworks that
+// decide on requests in several steps. d should be the result of p.Check(r), possibly changed
+// to allow r, e.g. because the framework allows some of the requests p rejects depending on
+// their content, so that the reports, metrics, statistics and hooks of p only account for the
+// final outcome.
+func (p *Policy) EvaluateDecision(w http.ResponseWriter, r *http.Request, d Decision) (*http.Request, bool) {
+	return p.handle(w, r, Enforce, nil, &d)
+}
+
 // RequestLogger is a type that can log http requests.
 type RequestLogger interface {
 	// LogRequest is called with every request that needs to be logged.
 	LogRequest(*http.Request)
 }
 
+// ProtectHandlerMode isolates h using the ResourceIsolationPolicy configured with opts, in mode
+// m. It is equivalent to ProtectHandler with Enforce and to ProtectHandlerLogOnly with LogOnly.
+// See Policy.ProtectMode.
+func ProtectHandlerMode(h http.Handler, m Mode, rl RequestLogger, opts ...Option) http.Handler {
+	return ResourceIsolationPolicy(opts...).ProtectMode(h, m, rl)
+}
+
+// ProtectMode isolates h from the requests rejected by p in mode m: Enforce behaves like
+// Protect, LogOnly like ProtectLogOnly, Disabled only records decisions and Off lets requests
+// through untouched. rl is only used in LogOnly mode, and can be nil.
+//
+// As with the other handlers, the mode of p caps m, see Policy.SetMode. ProtectMode panics if m
+// is not a known Mode.
+func (p *Policy) ProtectMode(h http.Handler, m Mode, rl RequestLogger) http.Handler {
+	if m < Enforce || m > Off {
+		panic(fmt.Sprintf("secfetch: unknown mode %d", m))
+	}
+	return p.protect(h, rl, func(*http.Request) Mode { return m })
+}
+
 // ProtectHandlerLogOnly behaves like ProtectHandler, but only logs requests that would have been
 // blocked.
-func ProtectHandlerLogOnly(h http.Handler, rl RequestLogger) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !allowed(r) {
-			rl.LogRequest(r)
-		}
-		h.ServeHTTP(w, r)
-	})
+func ProtectHandlerLogOnly(h http.Handler, rl RequestLogger, opts ...Option) http.Handler {
+	return ResourceIsolationPolicy(opts...).ProtectLogOnly(h, rl)
+}
+
+// ProtectLogOnly behaves like Protect, but only logs requests that would have been blocked.
+// rl can be nil if p sends Reports to ReportLoggers, see ReportTo.
+func (p *Policy) ProtectLogOnly(h http.Handler, rl RequestLogger) http.Handler {
+	return p.protect(h, rl, func(*http.Request) Mode { return LogOnly })
 }
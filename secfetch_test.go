@@ -19,13 +19,14 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 )
 
 var checkTests = []struct {
-	name, site, mode, method string
-	want                     bool
+	name, site, mode, dest, method string
+	want                           bool
 }{
 	{
 		name:   "no headers",
@@ -62,6 +63,13 @@ var checkTests = []struct {
 		method: "POST",
 		want:   true,
 	},
+	{
+		name:   "unrecognized site",
+		site:   "cross-origin",
+		mode:   "cors",
+		method: "POST",
+		want:   false,
+	},
 	{
 		name:   "cross origin nested navigate",
 		site:   "cross-site",
@@ -83,6 +91,46 @@ var checkTests = []struct {
 		method: "GET",
 		want:   true,
 	},
+	{
+		name:   "cross origin document navigate",
+		site:   "cross-site",
+		mode:   "navigate",
+		dest:   "document",
+		method: "GET",
+		want:   true,
+	},
+	{
+		name:   "cross origin iframe navigate",
+		site:   "cross-site",
+		mode:   "navigate",
+		dest:   "iframe",
+		method: "GET",
+		want:   true,
+	},
+	{
+		name:   "cross origin embed navigate",
+		site:   "cross-site",
+		mode:   "navigate",
+		dest:   "embed",
+		method: "GET",
+		want:   false,
+	},
+	{
+		name:   "cross origin object navigate",
+		site:   "cross-site",
+		mode:   "navigate",
+		dest:   "object",
+		method: "GET",
+		want:   false,
+	},
+	{
+		name:   "cross origin image",
+		site:   "cross-site",
+		mode:   "no-cors",
+		dest:   "image",
+		method: "GET",
+		want:   false,
+	},
 	{
 		name:   "cross origin form submission",
 		site:   "cross-site",
@@ -121,6 +169,7 @@ func TestProtectHandler(t *testing.T) {
 			}
 			r.Header.Set("sec-fetch-site", tt.site)
 			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
 			w := httptest.NewRecorder()
 			hf.ServeHTTP(w, r)
 			if w.Code != 200 && bytes.Contains(w.Body.Bytes(), []byte(data)) {
@@ -133,6 +182,106 @@ func TestProtectHandler(t *testing.T) {
 	}
 }
 
+func TestMiddleware(t *testing.T) {
+	var rl testReportLogger
+	mw := Middleware(ReportTo(&rl), ExemptPaths("/public"))
+	var hs []http.Handler
+	for i := 0; i < 2; i++ {
+		hs = append(hs, mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	}
+	var tests = []struct {
+		path string
+		want int
+	}{
+		{path: "/", want: http.StatusForbidden},
+		{path: "/public", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		for i, h := range hs {
+			r := httptest.NewRequest("POST", tt.path, nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("handler %d, %s: got status %d, want %d", i, tt.path, w.Code, tt.want)
+			}
+		}
+	}
+	if len(rl.reps) != 2 {
+		t.Errorf("got %d reports, want 2", len(rl.reps))
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p := ResourceIsolationPolicy(DenyStatus(http.StatusTeapot))
+	var tests = []struct {
+		site       string
+		mode       Mode
+		wantReject bool
+		wantVary   bool
+		wantRule   Rule
+	}{
+		{site: "same-origin", mode: Enforce, wantVary: true, wantRule: RuleTrustedSite},
+		{site: "cross-site", mode: Enforce, wantReject: true, wantVary: true, wantRule: RuleCrossSiteMethod},
+		{site: "cross-site", mode: LogOnly, wantRule: RuleCrossSiteMethod},
+		{site: "cross-site", mode: Off},
+	}
+	for _, tt := range tests {
+		t.Run(tt.site+" "+tt.mode.String(), func(t *testing.T) {
+			p.SetMode(tt.mode)
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			w := httptest.NewRecorder()
+			r, reject := p.Evaluate(w, r)
+			if reject != tt.wantReject {
+				t.Errorf("got reject %v, want %v", reject, tt.wantReject)
+			}
+			if got := w.Header().Get("Vary") != ""; got != tt.wantVary {
+				t.Errorf("got Vary %q, want set: %v", w.Header().Get("Vary"), tt.wantVary)
+			}
+			if d, _ := FromContext(r.Context()); d.Rule != tt.wantRule {
+				t.Errorf("got rule %q, want %q", d.Rule, tt.wantRule)
+			}
+			if reject {
+				p.ServeDenied(w, r)
+				if w.Code != http.StatusTeapot {
+					t.Errorf("ServeDenied: got status %d, want %d", w.Code, http.StatusTeapot)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateDecision(t *testing.T) {
+	var allowed, blocked []Decision
+	p := ResourceIsolationPolicy(
+		OnAllow(func(r *http.Request, d Decision) { allowed = append(allowed, d) }),
+		OnBlock(func(r *http.Request, d Decision, _ bool) { blocked = append(blocked, d) }),
+	)
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("sec-fetch-site", "cross-site")
+	d := p.Check(r)
+	if len(allowed)+len(blocked) != 0 {
+		t.Fatalf("Check ran hooks")
+	}
+
+	// The caller allows the request rejected by the policy.
+	ad := d
+	ad.Allowed, ad.Rule = true, RuleExempt
+	r2, reject := p.EvaluateDecision(httptest.NewRecorder(), r, ad)
+	if reject || len(blocked) != 0 || len(allowed) != 1 || allowed[0] != ad {
+		t.Errorf("got reject %v, allowed %v, blocked %v, want only %v allowed", reject, allowed, blocked, ad)
+	}
+	if got, _ := FromContext(r2.Context()); got != ad {
+		t.Errorf("got decision %v in context, want %v", got, ad)
+	}
+
+	_, reject = p.EvaluateDecision(httptest.NewRecorder(), r, d)
+	if !reject || len(blocked) != 1 || blocked[0] != d {
+		t.Errorf("got reject %v, blocked %v, want %v blocked", reject, blocked, d)
+	}
+}
+
 type testRequestLogger struct {
 	rs []*http.Request
 }
@@ -163,6 +312,7 @@ func TestProtectHandlerLogOnly(t *testing.T) {
 			}
 			r.Header.Set("sec-fetch-site", tt.site)
 			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
 			w := httptest.NewRecorder()
 			hf.ServeHTTP(w, r)
 			if w.Code != 200 {
@@ -192,8 +342,8 @@ func TestExempt(t *testing.T) {
 	}))
 
 	type pathTest struct {
-		name, site, mode, method, path string
-		want                           bool
+		name, site, mode, dest, method, path string
+		want                                 bool
 	}
 	var tests []pathTest
 	for _, tt := range checkTests {
@@ -201,6 +351,7 @@ func TestExempt(t *testing.T) {
 			name:   "protected " + tt.name,
 			site:   tt.site,
 			mode:   tt.mode,
+			dest:   tt.dest,
 			method: tt.method,
 			path:   "/protected",
 			want:   tt.want,
@@ -211,6 +362,7 @@ func TestExempt(t *testing.T) {
 			name:   "unprotected " + tt.name,
 			site:   tt.site,
 			mode:   tt.mode,
+			dest:   tt.dest,
 			method: tt.method,
 			path:   "/unprotected",
 			want:   true,
@@ -227,6 +379,7 @@ func TestExempt(t *testing.T) {
 			}
 			r.Header.Set("sec-fetch-site", tt.site)
 			r.Header.Set("sec-fetch-mode", tt.mode)
+			r.Header.Set("sec-fetch-dest", tt.dest)
 			w := httptest.NewRecorder()
 			mux.ServeHTTP(w, r)
 			if w.Code != 200 && bytes.Contains(w.Body.Bytes(), []byte(private)) {
@@ -238,3 +391,102 @@ func TestExempt(t *testing.T) {
 		})
 	}
 }
+
+// discardWriter is a ResponseWriter that reuses its header map, like net/http servers do across
+// the requests of a connection.
+type discardWriter http.Header
+
+func (w discardWriter) Header() http.Header         { return http.Header(w) }
+func (w discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardWriter) WriteHeader(int)             {}
+
+func TestProtectAllocs(t *testing.T) {
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r := newBenchRequest("GET", "same-origin", "cors", "empty")
+	w := discardWriter{}
+	// Allowed requests are only copied to store the Decision in their context, which takes two
+	// allocations, unless DisableDecisionContext is used.
+	p := ResourceIsolationPolicy(DisableDecisionContext())
+	for _, tt := range []struct {
+		name string
+		h    http.Handler
+		want float64
+	}{
+		{"enforce", p.Protect(noop), 0},
+		{"log-only", p.ProtectLogOnly(noop, nil), 0},
+		{"decision context", benchPolicy.Protect(noop), 2},
+	} {
+		n := testing.AllocsPerRun(100, func() {
+			clear(w)
+			tt.h.ServeHTTP(w, r)
+		})
+		if n > tt.want {
+			t.Errorf("%s: allowed request allocates %v times, want at most %v", tt.name, n, tt.want)
+		}
+	}
+}
+
+func TestProtectVary(t *testing.T) {
+	p := ResourceIsolationPolicy()
+	h := p.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}))
+	want := []string{"Sec-Fetch-Site, Sec-Fetch-Mode, Sec-Fetch-Dest", "Accept-Encoding"}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if got := w.Header()["Vary"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("got Vary %q, want %q", got, want)
+		}
+	}
+	w := httptest.NewRecorder()
+	w.Header().Set("Vary", "Cookie")
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if got := w.Header()["Vary"]; !reflect.DeepEqual(got, append([]string{"Cookie"}, want...)) {
+		t.Errorf("got Vary %q", got)
+	}
+}
+
+func TestDisableDecisionContext(t *testing.T) {
+	p := ResourceIsolationPolicy(DisableDecisionContext())
+	var found bool
+	h := p.ProtectLogOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, found = FromContext(r.Context())
+	}), nil)
+	for _, tt := range []struct {
+		site string
+		want bool
+	}{
+		{site: "same-origin", want: false},
+		{site: "cross-site", want: true},
+	} {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("Sec-Fetch-Site", tt.site)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if found != tt.want {
+			t.Errorf("%s: got decision in context %v, want %v", tt.site, found, tt.want)
+		}
+	}
+}
+
+func BenchmarkProtect(b *testing.B) {
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, bb := range []struct {
+		name string
+		h    http.Handler
+		r    *http.Request
+	}{
+		{"allowed", benchPolicy.Protect(noop), newBenchRequest("GET", "same-origin", "cors", "empty")},
+		{"allowed-log-only", benchPolicy.ProtectLogOnly(noop, nil), newBenchRequest("GET", "same-origin", "cors", "empty")},
+		{"rejected", benchPolicy.Protect(noop), newBenchRequest("POST", "cross-site", "navigate", "document")},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			w := discardWriter{}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				clear(w)
+				bb.h.ServeHTTP(w, bb.r)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+module github.com/empijei/go-sec-fetch/secfetchchi
+
+go 1.23
+
+require (
+	github.com/empijei/go-sec-fetch v0.1.0
+	github.com/go-chi/chi/v5 v5.3.2
+)
+
+require (
+	go.yaml.in/yaml/v3 v3.0.5 // indirect
+	golang.org/x/net v0.35.0 // indirect
+)
@@ -0,0 +1,58 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchchi integrates secfetch policies with chi routers.
+//
+// Example usage:
+//
+//	r := chi.NewRouter()
+//	r.Use(secfetch.Middleware(secfetchchi.ExemptRoutes(r, "/users/{id}/avatar")))
+//	r.Get("/users/{id}/avatar", avatarHandler)
+package secfetchchi
+
+import (
+	"net/http"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/go-chi/chi/v5"
+)
+
+// ExemptRoutes exempts requests that router routes to one of the given route patterns from the
+// policy. Patterns are the ones the routes were declared with, e.g. "/users/{id}/avatar";
+// routes of mounted sub-routers are matched by their full pattern, e.g. "/api/users/{id}".
+//
+// The route is resolved with router.Find before the request is routed, so the exemption works
+// for middlewares installed with router.Use. Routes can be registered after the option is
+// created.
+func ExemptRoutes(router chi.Routes, patterns ...string) secfetch.Option {
+	exempt := make(map[string]bool, len(patterns))
+	for _, p := range patterns {
+		exempt[p] = true
+	}
+	return secfetch.ExemptIf(func(r *http.Request) bool {
+		return exempt[RoutePattern(router, r)]
+	})
+}
+
+// RoutePattern returns the pattern of the route router routes r to, or "" if there is none.
+func RoutePattern(router chi.Routes, r *http.Request) string {
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	if path == "" {
+		path = "/"
+	}
+	return router.Find(chi.NewRouteContext(), r.Method, path)
+}
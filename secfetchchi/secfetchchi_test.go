@@ -0,0 +1,56 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchchi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestExemptRoutes(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(secfetch.Middleware(ExemptRoutes(r, "/users/{id}/avatar", "/api/hooks/{name}")))
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	r.Post("/users/{id}/avatar", noop)
+	r.Post("/users/{id}", noop)
+	r.Route("/api", func(r chi.Router) {
+		r.Post("/hooks/{name}", noop)
+	})
+	var tests = []struct {
+		path string
+		want int
+	}{
+		{path: "/users/42/avatar", want: http.StatusOK},
+		{path: "/users/42", want: http.StatusForbidden},
+		{path: "/api/hooks/github", want: http.StatusOK},
+		{path: "/hooks/github", want: http.StatusForbidden},
+		{path: "/missing", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, nil)
+			req.Header.Set("sec-fetch-site", "cross-site")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
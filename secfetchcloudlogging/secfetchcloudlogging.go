@@ -0,0 +1,142 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchcloudlogging logs the requests rejected by secfetch policies as structured
+// entries for Google Cloud Logging.
+//
+// On Cloud Run, GKE, App Engine and the other environments that collect JSON lines written to
+// the standard output, entries are parsed into LogEntry fields, with their httpRequest,
+// severity and trace populated, so they can be used in log-based metrics:
+//
+//	l := secfetchcloudlogging.New(os.Stdout, "my-project")
+//	h := secfetch.ProtectHandlerLogOnly(mux, l)
+//
+// Entries also have the same message and field names as the records of secfetch.SlogLogger, see
+// secfetch.Report.Fields.
+package secfetchcloudlogging
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+)
+
+// Logger is a secfetch.RequestLogger, a secfetch.ReportLogger and a secfetch.SummaryLogger that
+// writes Cloud Logging structured entries as JSON lines.
+type Logger struct {
+	// Severity is the severity of entries. The default is "WARNING".
+	Severity string
+
+	project string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New returns a Logger that writes entries to w. If project is not empty, entries are
+// correlated with the traces of the Google Cloud project with that ID, using the trace ID of
+// the request, see secfetch.RequestID.
+func New(w io.Writer, project string) *Logger {
+	return &Logger{project: project, w: w}
+}
+
+type httpRequest struct {
+	RequestMethod string `json:"requestMethod"`
+	RequestURL    string `json:"requestUrl"`
+	RemoteIP      string `json:"remoteIp,omitempty"`
+	UserAgent     string `json:"userAgent,omitempty"`
+	Referer       string `json:"referer,omitempty"`
+}
+
+// LogRequest implements secfetch.RequestLogger.
+func (l *Logger) LogRequest(r *http.Request) {
+	secfetch.LogRequestReport(l, r)
+}
+
+// LogReport implements secfetch.ReportLogger.
+func (l *Logger) LogReport(rep *secfetch.Report) {
+	e := l.entry(rep.Message(), rep.Time)
+	for _, f := range rep.Fields() {
+		e[f.Key] = f.Value
+	}
+	e["httpRequest"] = &httpRequest{
+		RequestMethod: rep.Method,
+		RequestURL:    rep.Path,
+		RemoteIP:      remoteIP(rep.RemoteAddr),
+		UserAgent:     rep.UserAgent,
+		Referer:       rep.Referer,
+	}
+	if l.project != "" && isTraceID(rep.RequestID) {
+		e["logging.googleapis.com/trace"] = "projects/" + l.project + "/traces/" + rep.RequestID
+	}
+	l.write(e)
+}
+
+// LogSummary implements secfetch.SummaryLogger.
+func (l *Logger) LogSummary(s *secfetch.Summary) {
+	e := l.entry(secfetch.SummaryMessage, s.Last)
+	e["path"] = s.Path
+	e["method"] = s.Method
+	e["site"] = s.Site
+	e["mode"] = s.Mode
+	e["count"] = s.Count
+	e["first"] = s.First
+	e["last"] = s.Last
+	l.write(e)
+}
+
+func (l *Logger) entry(msg string, t time.Time) map[string]interface{} {
+	sev := l.Severity
+	if sev == "" {
+		sev = "WARNING"
+	}
+	e := map[string]interface{}{"severity": sev, "message": msg}
+	if !t.IsZero() {
+		e["time"] = t
+	}
+	return e
+}
+
+func (l *Logger) write(e map[string]interface{}) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(b, '\n'))
+}
+
+// remoteIP strips the port from addr, if any.
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// isTraceID reports whether id looks like a trace ID rather than an arbitrary request ID.
+func isTraceID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchcloudlogging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "my-project")
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := secfetch.ProtectHandlerLogOnly(noop, l)
+
+	r := httptest.NewRequest("POST", "/transfer", nil)
+	r.Header.Set("sec-fetch-site", "cross-site")
+	r.Header.Set("sec-fetch-mode", "cors")
+	r.Header.Set("user-agent", "Mozilla/5.0")
+	r.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	r.RemoteAddr = "192.0.2.1:1234"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("cannot decode %q: %v", buf.String(), err)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, got["time"].(string)); err != nil {
+		t.Errorf("got time %v: %v", got["time"], err)
+	}
+	delete(got, "time")
+	want := map[string]interface{}{
+		"severity": "WARNING",
+		"message":  "secfetch: request would be rejected by policy",
+		"httpRequest": map[string]interface{}{
+			"requestMethod": "POST",
+			"requestUrl":    "/transfer",
+			"remoteIp":      "192.0.2.1",
+			"userAgent":     "Mozilla/5.0",
+		},
+		"logging.googleapis.com/trace": "projects/my-project/traces/105445aa7843bc8bf206b12000100000",
+		"path":                         "/transfer",
+		"method":                       "POST",
+		"site":                         "cross-site",
+		"mode":                         "cors",
+		"dest":                         "",
+		"remote_addr":                  "192.0.2.1:1234",
+		"rule":                         "cross-site-method",
+		"request_id":                   "105445aa7843bc8bf206b12000100000",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got entry:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestLoggerNoTrace(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "my-project")
+	l.Severity = "NOTICE"
+	l.LogReport(&secfetch.Report{Enforced: true, Path: "/", RequestID: "lb-42"})
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["severity"] != "NOTICE" || got["message"] != "secfetch: request rejected by policy" {
+		t.Errorf("got severity %v and message %v", got["severity"], got["message"])
+	}
+	if tr, ok := got["logging.googleapis.com/trace"]; ok {
+		t.Errorf("got trace %v for a request ID that is not a trace ID", tr)
+	}
+}
+
+func TestLogSummary(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "")
+	t0 := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	l.LogSummary(&secfetch.Summary{Path: "/a", Method: "POST", Site: "cross-site", Mode: "cors", Count: 3, First: t0, Last: t0})
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"severity": "WARNING",
+		"message":  secfetch.SummaryMessage,
+		"time":     "2019-07-01T10:00:00Z",
+		"path":     "/a",
+		"method":   "POST",
+		"site":     "cross-site",
+		"mode":     "cors",
+		"count":    float64(3),
+		"first":    "2019-07-01T10:00:00Z",
+		"last":     "2019-07-01T10:00:00Z",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got entry %v, want %v", got, want)
+	}
+}
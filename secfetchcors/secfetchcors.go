@@ -0,0 +1,73 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchcors ties secfetch policies to rs/cors configurations, so that the origins
+// allowed to make cross-site requests are declared once.
+//
+// Example usage, for the CORS-enabled routes of a server:
+//
+//	c := cors.New(cors.Options{AllowedOrigins: []string{"https://app.example"}})
+//	mux.Handle("/api/", secfetchcors.New(c)(apiHandler))
+//
+// The origins must be listed explicitly: configurations that allow any origin, like
+// cors.Default() or AllowedOrigins: []string{"*"}, would let any site make credentialed requests,
+// and are rejected.
+//
+// Routes that are not CORS-enabled should be protected by a regular policy.
+package secfetchcors
+
+import (
+	"net/http"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/rs/cors"
+)
+
+// probeOrigin is an origin that no CORS configuration should allow: the .invalid top-level
+// domain is reserved by RFC 2606.
+const probeOrigin = "https://secfetch-probe.invalid"
+
+// AllowOrigins allows cross-site requests whose Origin is allowed by c, see
+// secfetch.AllowOriginFunc.
+//
+// Policies trust the origins allowed by c with credentialed cross-site requests, so c must list
+// them explicitly. AllowOrigins panics if c allows any origin, which is the case when its
+// AllowedOrigins contain "*" or are empty, and is detected for AllowOriginFunc and
+// AllowOriginVaryRequestFunc by checking whether they allow an origin under the reserved
+// .invalid domain: such configurations would disable the protection of the policy. Functions
+// that allow all origins but that one are not detected.
+func AllowOrigins(c *cors.Cors) secfetch.Option {
+	r, _ := http.NewRequest(http.MethodGet, probeOrigin+"/", http.NoBody)
+	r.Header.Set("Origin", probeOrigin)
+	if c.OriginAllowed(r) {
+		panic("secfetchcors: the CORS configuration allows any origin")
+	}
+	return secfetch.AllowOriginFunc(func(r *http.Request, origin string) bool {
+		return c.OriginAllowed(r)
+	})
+}
+
+// New returns a middleware for CORS-enabled routes: c handles the CORS protocol, and handlers
+// are isolated by the ResourceIsolationPolicy configured with opts that only allows cross-site
+// requests from the origins allowed by c.
+//
+// CORS preflights are answered by c, or passed to the handlers if c was created with
+// OptionsPassthrough. New panics if c allows any origin, see AllowOrigins.
+func New(c *cors.Cors, opts ...secfetch.Option) func(http.Handler) http.Handler {
+	opts = append([]secfetch.Option{AllowOrigins(c), secfetch.AllowCORSPreflights()}, opts...)
+	p := secfetch.ResourceIsolationPolicy(opts...)
+	return func(h http.Handler) http.Handler {
+		return c.Handler(p.Protect(h))
+	}
+}
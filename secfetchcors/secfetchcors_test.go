@@ -0,0 +1,88 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchcors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/cors"
+)
+
+func TestNew(t *testing.T) {
+	c := cors.New(cors.Options{
+		AllowedOrigins: []string{"https://app.example", "https://*.partner.example"},
+		AllowedMethods: []string{"GET", "POST"},
+	})
+	h := New(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	var tests = []struct {
+		name           string
+		method         string
+		origin         string
+		preflight      bool
+		want           int
+		wantAllowedHdr bool
+	}{
+		{name: "allowed origin", method: "POST", origin: "https://app.example", want: http.StatusOK, wantAllowedHdr: true},
+		{name: "allowed wildcard origin", method: "POST", origin: "https://a.partner.example", want: http.StatusOK, wantAllowedHdr: true},
+		{name: "other origin", method: "POST", origin: "https://evil.example", want: http.StatusForbidden},
+		{name: "preflight", method: "OPTIONS", origin: "https://app.example", preflight: true, want: http.StatusNoContent, wantAllowedHdr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api", nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", "cors")
+			r.Header.Set("sec-fetch-dest", "empty")
+			r.Header.Set("origin", tt.origin)
+			if tt.preflight {
+				r.Header.Set("access-control-request-method", "POST")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin") != ""; got != tt.wantAllowedHdr {
+				t.Errorf("got Access-Control-Allow-Origin %q", w.Header().Get("Access-Control-Allow-Origin"))
+			}
+		})
+	}
+}
+
+func TestAllowOriginsAny(t *testing.T) {
+	var tests = []struct {
+		name string
+		opts cors.Options
+	}{
+		{name: "wildcard", opts: cors.Options{AllowedOrigins: []string{"*"}}},
+		{name: "wildcard among others", opts: cors.Options{AllowedOrigins: []string{"https://app.example", "*"}}},
+		{name: "default", opts: cors.Options{}},
+		{name: "scheme wildcard", opts: cors.Options{AllowedOrigins: []string{"https://*"}}},
+		{name: "func", opts: cors.Options{AllowOriginFunc: func(origin string) bool { return true }}},
+		{name: "request func", opts: cors.Options{AllowOriginVaryRequestFunc: func(r *http.Request, origin string) (bool, []string) { return true, nil }}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("New did not panic")
+				}
+			}()
+			New(cors.New(tt.opts))
+		})
+	}
+}
@@ -0,0 +1,14 @@
+module github.com/empijei/go-sec-fetch/secfetchecho
+
+go 1.25.0
+
+require (
+	github.com/empijei/go-sec-fetch v0.1.0
+	github.com/labstack/echo/v5 v5.3.1
+)
+
+require (
+	go.yaml.in/yaml/v3 v3.0.5 // indirect
+	golang.org/x/net v0.57.0 // indirect
+	golang.org/x/time v0.15.0 // indirect
+)
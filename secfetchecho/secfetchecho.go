@@ -0,0 +1,95 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchecho isolates Echo handlers with secfetch policies.
+//
+// Example usage:
+//
+//	e := echo.New()
+//	e.Use(secfetchecho.Middleware(secfetch.ResourceIsolationPolicy()))
+package secfetchecho
+
+import (
+	"net/http"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/labstack/echo/v5"
+	"github.com/labstack/echo/v5/middleware"
+)
+
+// DecisionKey is the key the secfetch.Decision taken for a request is stored with in the
+// echo.Context, see Decision.
+const DecisionKey = "secfetch.decision"
+
+// Config configures the middleware returned by MiddlewareWithConfig.
+type Config struct {
+	// Skipper skips the evaluation of the requests it returns true for, which are always
+	// allowed. The default is middleware.DefaultSkipper.
+	Skipper middleware.Skipper
+
+	// Policy is the policy requests are evaluated against. The default is the
+	// secfetch.ResourceIsolationPolicy.
+	Policy *secfetch.Policy
+
+	// Status is the status code of the echo.HTTPError returned for rejected requests.
+	// The default is http.StatusForbidden.
+	Status int
+}
+
+// Middleware returns an Echo middleware that evaluates requests against p, see
+// MiddlewareWithConfig.
+func Middleware(p *secfetch.Policy) echo.MiddlewareFunc {
+	return MiddlewareWithConfig(Config{Policy: p})
+}
+
+// MiddlewareWithConfig returns an Echo middleware that evaluates requests like
+// secfetch.Policy.Protect does. Instead of sending the deny response of the policy, rejected
+// requests make the middleware return an *echo.HTTPError, which is rendered by the
+// HTTPErrorHandler of the Echo instance.
+func MiddlewareWithConfig(cfg Config) echo.MiddlewareFunc {
+	if cfg.Skipper == nil {
+		cfg.Skipper = middleware.DefaultSkipper
+	}
+	if cfg.Policy == nil {
+		cfg.Policy = secfetch.ResourceIsolationPolicy()
+	}
+	if cfg.Status == 0 {
+		cfg.Status = http.StatusForbidden
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			if cfg.Skipper(c) {
+				return next(c)
+			}
+			r, reject := cfg.Policy.Evaluate(c.Response(), c.Request())
+			c.SetRequest(r)
+			if d, ok := secfetch.FromContext(r.Context()); ok {
+				c.Set(DecisionKey, d)
+			}
+			if reject {
+				// Rejections depend on the context the request was sent from, so they must
+				// never be served from caches.
+				c.Response().Header().Set("Cache-Control", "no-store")
+				return echo.NewHTTPError(cfg.Status, "Invalid resource access")
+			}
+			return next(c)
+		}
+	}
+}
+
+// Decision returns the secfetch.Decision taken by the middleware for the request of c, if any.
+func Decision(c *echo.Context) (secfetch.Decision, bool) {
+	d, ok := c.Get(DecisionKey).(secfetch.Decision)
+	return d, ok
+}
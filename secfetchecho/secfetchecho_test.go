@@ -0,0 +1,65 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchecho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/labstack/echo/v5"
+)
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(MiddlewareWithConfig(Config{
+		Skipper: func(c *echo.Context) bool { return strings.HasPrefix(c.Request().URL.Path, "/public") },
+		Status:  http.StatusNotFound,
+	}))
+	var got secfetch.Decision
+	handler := func(c *echo.Context) error {
+		got, _ = Decision(c)
+		return c.NoContent(http.StatusNoContent)
+	}
+	e.POST("/", handler)
+	e.POST("/public", handler)
+	var tests = []struct {
+		path     string
+		site     string
+		want     int
+		wantRule secfetch.Rule
+	}{
+		{path: "/", site: "same-origin", want: http.StatusNoContent, wantRule: secfetch.RuleTrustedSite},
+		{path: "/", site: "cross-site", want: http.StatusNotFound},
+		{path: "/public", site: "cross-site", want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.site, func(t *testing.T) {
+			got = secfetch.Decision{}
+			r := httptest.NewRequest("POST", tt.path, nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if got.Rule != tt.wantRule {
+				t.Errorf("got rule %q in handler, want %q", got.Rule, tt.wantRule)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/empijei/go-sec-fetch/secfetchfasthttp
+
+go 1.25.0
+
+require (
+	github.com/empijei/go-sec-fetch v0.1.0
+	github.com/valyala/fasthttp v1.74.0
+)
+
+require (
+	github.com/klauspost/compress v1.20.0 // indirect
+	github.com/molecule-man/go-brrr v1.0.1 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	go.yaml.in/yaml/v3 v3.0.5 // indirect
+	golang.org/x/net v0.58.0 // indirect
+)
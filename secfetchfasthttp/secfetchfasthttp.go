@@ -0,0 +1,134 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchfasthttp isolates fasthttp handlers, and handlers of frameworks built on
+// fasthttp, with secfetch policies.
+//
+// Example usage:
+//
+//	p := secfetch.ResourceIsolationPolicy()
+//	fasthttp.ListenAndServe(":8080", secfetchfasthttp.Protect(p, handler))
+package secfetchfasthttp
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/valyala/fasthttp"
+)
+
+// DecisionKey is the user value key the secfetch.Decision taken for a request is stored with
+// in the fasthttp.RequestCtx, see Decision.
+const DecisionKey = "secfetch.decision"
+
+// Protect returns a handler that isolates h from the requests rejected by p, like p.Protect
+// does for net/http handlers.
+func Protect(p *secfetch.Policy, h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if Handle(p, ctx) {
+			h(ctx)
+		}
+	}
+}
+
+// Handle evaluates the request of ctx against p, see secfetch.Policy.Evaluate, and reports
+// whether it should be served. If it shouldn't, Handle has already written the deny response
+// of p to ctx.
+func Handle(p *secfetch.Policy, ctx *fasthttp.RequestCtx) bool {
+	r, err := NewRequest(ctx)
+	if err != nil {
+		ctx.Error("Bad Request", fasthttp.StatusBadRequest)
+		return false
+	}
+	w := &responseWriter{ctx: ctx, header: make(http.Header)}
+	r, reject := p.Evaluate(w, r)
+	if d, ok := secfetch.FromContext(r.Context()); ok {
+		ctx.SetUserValue(DecisionKey, d)
+	}
+	if reject {
+		p.ServeDenied(w, r)
+	}
+	w.flush()
+	return !reject
+}
+
+// Decision returns the secfetch.Decision taken for the request of ctx, if any.
+func Decision(ctx *fasthttp.RequestCtx) (secfetch.Decision, bool) {
+	d, ok := ctx.UserValue(DecisionKey).(secfetch.Decision)
+	return d, ok
+}
+
+// NewRequest returns an http.Request with the method, URL, host, remote address, TLS state
+// and headers of the request of ctx, which policies can evaluate.
+//
+// The path of the request is the normalized one fasthttp routes requests with, so that policies
+// match the same handlers: parsing the raw request URI would e.g. turn "//admin/webhook" into
+// the host "admin" and the path "/webhook".
+//
+// Unlike fasthttpadaptor.ConvertRequest, all values are copied, so they stay valid after ctx
+// is released, e.g. in Reports logged asynchronously. For the same reason, the context of the
+// request is context.Background() rather than ctx: it carries none of the user values of ctx.
+// The request has no body.
+func NewRequest(ctx *fasthttp.RequestCtx) (*http.Request, error) {
+	r, err := http.NewRequestWithContext(context.Background(), string(ctx.Method()), "/", http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	r.URL = &url.URL{Path: string(ctx.Path()), RawQuery: string(ctx.URI().QueryString())}
+	r.RequestURI = r.URL.RequestURI()
+	r.Host = string(ctx.Host())
+	r.RemoteAddr = ctx.RemoteAddr().String()
+	r.TLS = ctx.TLSConnectionState()
+	for k, v := range ctx.Request.Header.All() {
+		r.Header.Add(string(k), string(v))
+	}
+	return r, nil
+}
+
+// responseWriter buffers the headers set by policies and writes them to a fasthttp response.
+type responseWriter struct {
+	ctx         *fasthttp.RequestCtx
+	header      http.Header
+	wroteHeader bool
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.flush()
+	w.ctx.SetStatusCode(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.ctx.Write(b)
+}
+
+// flush copies the buffered headers to the response.
+func (w *responseWriter) flush() {
+	for k, vs := range w.header {
+		for _, v := range vs {
+			w.ctx.Response.Header.Add(k, v)
+		}
+	}
+	clear(w.header)
+}
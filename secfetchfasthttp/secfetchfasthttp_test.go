@@ -0,0 +1,135 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchfasthttp
+
+import (
+	"net/http"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/valyala/fasthttp"
+)
+
+func TestProtect(t *testing.T) {
+	var got secfetch.Decision
+	h := Protect(secfetch.ResourceIsolationPolicy(secfetch.DebugHeader()), func(ctx *fasthttp.RequestCtx) {
+		got, _ = Decision(ctx)
+		ctx.SetStatusCode(http.StatusNoContent)
+	})
+	var tests = []struct {
+		site       string
+		want       int
+		wantRule   secfetch.Rule
+		wantHeader string
+	}{
+		{site: "same-origin", want: http.StatusNoContent, wantRule: secfetch.RuleTrustedSite, wantHeader: "allowed; rule=trusted-site"},
+		{site: "cross-site", want: http.StatusForbidden, wantHeader: "blocked; rule=cross-site-method"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.site, func(t *testing.T) {
+			got = secfetch.Decision{}
+			var ctx fasthttp.RequestCtx
+			ctx.Request.Header.SetMethod("POST")
+			ctx.Request.SetRequestURI("/path?q=1")
+			ctx.Request.Header.Set("Sec-Fetch-Site", tt.site)
+			ctx.Request.Header.Set("Accept", "application/json")
+			h(&ctx)
+			if code := ctx.Response.StatusCode(); code != tt.want {
+				t.Errorf("got status %d, want %d", code, tt.want)
+			}
+			if got.Rule != tt.wantRule {
+				t.Errorf("got rule %q in handler, want %q", got.Rule, tt.wantRule)
+			}
+			if h := string(ctx.Response.Header.Peek("X-SecFetch-Decision")); h != tt.wantHeader {
+				t.Errorf("got decision header %q, want %q", h, tt.wantHeader)
+			}
+			if vary := string(ctx.Response.Header.Peek("Vary")); vary == "" {
+				t.Error("Vary header not set")
+			}
+		})
+	}
+}
+
+func TestNewRequestPath(t *testing.T) {
+	var tests = []struct {
+		uri, wantPath, wantQuery string
+	}{
+		{uri: "/a/b?q=1", wantPath: "/a/b", wantQuery: "q=1"},
+		{uri: "//admin/webhook", wantPath: "/admin/webhook"},
+		{uri: "/public/../admin", wantPath: "/admin"},
+	}
+	for _, tt := range tests {
+		var ctx fasthttp.RequestCtx
+		// Set the URI like the server does when parsing the request line.
+		ctx.Request.Header.SetRequestURI(tt.uri)
+		ctx.Request.Header.SetHost("example.com")
+		r, err := NewRequest(&ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.uri, err)
+		}
+		if r.URL.Path != tt.wantPath || r.URL.RawQuery != tt.wantQuery || r.Host != "example.com" {
+			t.Errorf("%s: got URL %#v, want path %q and query %q", tt.uri, r.URL, tt.wantPath, tt.wantQuery)
+		}
+	}
+}
+
+func TestNewRequestContext(t *testing.T) {
+	var ctx fasthttp.RequestCtx
+	ctx.SetUserValue("k", "v")
+	r, err := NewRequest(&ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Context().Value("k") != nil {
+		t.Error("the request context refers to the fasthttp.RequestCtx")
+	}
+}
+
+func TestProtectDoubleSlash(t *testing.T) {
+	// A request for "//admin/webhook" is routed to "/admin/webhook", so it must not match an
+	// exemption for "/webhook".
+	var served bool
+	h := Protect(secfetch.ResourceIsolationPolicy(secfetch.ExemptPaths("/webhook")), func(ctx *fasthttp.RequestCtx) {
+		served = true
+	})
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.Header.SetRequestURI("//admin/webhook")
+	ctx.Request.Header.SetHost("example.com")
+	ctx.Request.Header.Set("Sec-Fetch-Site", "cross-site")
+	h(&ctx)
+	if served || ctx.Response.StatusCode() != http.StatusForbidden {
+		t.Errorf("got status %d, served %v, want the request to be rejected", ctx.Response.StatusCode(), served)
+	}
+}
+
+func TestDeniedResponse(t *testing.T) {
+	h := Protect(secfetch.ResourceIsolationPolicy(), func(ctx *fasthttp.RequestCtx) {})
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.SetRequestURI("/")
+	ctx.Request.Header.Set("Sec-Fetch-Site", "cross-site")
+	ctx.Request.Header.Set("Sec-Fetch-Dest", "empty")
+	h(&ctx)
+	if ct := string(ctx.Response.Header.ContentType()); ct != "application/json" {
+		t.Errorf("got Content-Type %q, want application/json", ct)
+	}
+	if cc := string(ctx.Response.Header.Peek("Cache-Control")); cc != "no-store" {
+		t.Errorf("got Cache-Control %q, want no-store", cc)
+	}
+	if body := string(ctx.Response.Body()); body != `{"error":"Invalid resource access"}`+"\n" {
+		t.Errorf("got body %q", body)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchfiber isolates Fiber handlers with secfetch policies.
+//
+// Example usage:
+//
+//	app := fiber.New()
+//	app.Use(secfetchfiber.Middleware(secfetch.ResourceIsolationPolicy()))
+package secfetchfiber
+
+import (
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/empijei/go-sec-fetch/secfetchfasthttp"
+	"github.com/gofiber/fiber/v3"
+)
+
+// Middleware returns a Fiber middleware that evaluates requests against p, see
+// secfetchfasthttp.Handle. Rejected requests are answered with the deny response of p and
+// don't reach the next handlers.
+func Middleware(p *secfetch.Policy) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if !secfetchfasthttp.Handle(p, c.RequestCtx()) {
+			return nil
+		}
+		return c.Next()
+	}
+}
+
+// Decision returns the secfetch.Decision taken by Middleware for the request of c, if any.
+func Decision(c fiber.Ctx) (secfetch.Decision, bool) {
+	return secfetchfasthttp.Decision(c.RequestCtx())
+}
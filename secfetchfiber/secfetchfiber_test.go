@@ -0,0 +1,83 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchfiber
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(Middleware(secfetch.ResourceIsolationPolicy(secfetch.DenyStatus(http.StatusTeapot))))
+	var got secfetch.Decision
+	app.Post("/", func(c fiber.Ctx) error {
+		got, _ = Decision(c)
+		return c.SendStatus(http.StatusNoContent)
+	})
+	var tests = []struct {
+		site     string
+		want     int
+		wantRule secfetch.Rule
+	}{
+		{site: "same-origin", want: http.StatusNoContent, wantRule: secfetch.RuleTrustedSite},
+		{site: "cross-site", want: http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.site, func(t *testing.T) {
+			got = secfetch.Decision{}
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			resp, err := app.Test(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.want)
+			}
+			if got.Rule != tt.wantRule {
+				t.Errorf("got rule %q in handler, want %q", got.Rule, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestMiddlewareDoubleSlash(t *testing.T) {
+	// A request for "//admin/webhook" is routed to "/admin/webhook", so it must not match an
+	// exemption for "/webhook".
+	app := fiber.New()
+	app.Use(Middleware(secfetch.ResourceIsolationPolicy(secfetch.ExemptPaths("/webhook"))))
+	var served bool
+	app.Post("/admin/webhook", func(c fiber.Ctx) error {
+		served = true
+		return c.SendStatus(http.StatusNoContent)
+	})
+	r := httptest.NewRequest("POST", "/", nil)
+	r.URL.Path = "//admin/webhook"
+	r.Header.Set("sec-fetch-site", "cross-site")
+	resp, err := app.Test(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if served || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("got status %d, served %v, want the request to be rejected", resp.StatusCode, served)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchgin isolates Gin handlers with secfetch policies.
+//
+// Example usage:
+//
+//	r := gin.New()
+//	r.Use(secfetchgin.Middleware(secfetch.ResourceIsolationPolicy()))
+package secfetchgin
+
+import (
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/gin-gonic/gin"
+)
+
+// DecisionKey is the key the secfetch.Decision taken for a request is stored with in the
+// gin.Context, see Decision.
+const DecisionKey = "secfetch.decision"
+
+// Middleware returns a Gin middleware that evaluates requests against p like p.Protect does.
+// Rejected requests are answered with the deny response of p, and the rest of the chain is
+// aborted.
+func Middleware(p *secfetch.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, reject := p.Evaluate(c.Writer, c.Request)
+		c.Request = r
+		if d, ok := secfetch.FromContext(r.Context()); ok {
+			c.Set(DecisionKey, d)
+		}
+		if reject {
+			p.ServeDenied(c.Writer, r)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Decision returns the secfetch.Decision taken by Middleware for the request of c, if any.
+func Decision(c *gin.Context) (secfetch.Decision, bool) {
+	v, ok := c.Get(DecisionKey)
+	if !ok {
+		return secfetch.Decision{}, false
+	}
+	d, ok := v.(secfetch.Decision)
+	return d, ok
+}
@@ -0,0 +1,13 @@
+module github.com/empijei/go-sec-fetch/secfetchgorilla
+
+go 1.22
+
+require (
+	github.com/empijei/go-sec-fetch v0.1.0
+	github.com/gorilla/mux v1.8.1
+)
+
+require (
+	go.yaml.in/yaml/v3 v3.0.5 // indirect
+	golang.org/x/net v0.35.0 // indirect
+)
@@ -0,0 +1,64 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchgorilla integrates secfetch policies with gorilla/mux routers, so that
+// exemptions can be declared on the routes themselves.
+//
+// Example usage:
+//
+//	r := mux.NewRouter()
+//	r.Use(secfetch.Middleware(secfetchgorilla.ExemptRouteNames(r, "public:")))
+//	r.Handle("/avatars/{id}", avatarHandler).Name("public:avatar")
+package secfetchgorilla
+
+import (
+	"net/http"
+	"strings"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/gorilla/mux"
+)
+
+// ExemptRouteNames exempts requests routed to routes whose name starts with prefix, e.g.
+// "public:", from the policy. See ExemptRoutesIf.
+func ExemptRouteNames(router *mux.Router, prefix string) secfetch.Option {
+	return ExemptRoutesIf(router, func(rt *mux.Route) bool {
+		return strings.HasPrefix(rt.GetName(), prefix)
+	})
+}
+
+// ExemptRoutesIf exempts requests routed to routes for which f returns true from the policy.
+//
+// When the policy is installed with router.Use, the route is the one the request was matched
+// to. Otherwise, e.g. when the policy wraps router, the route is looked up with router.Match,
+// and requests that don't match any route are not exempt.
+func ExemptRoutesIf(router *mux.Router, f func(*mux.Route) bool) secfetch.Option {
+	return secfetch.ExemptIf(func(r *http.Request) bool {
+		rt := Route(router, r)
+		return rt != nil && f(rt)
+	})
+}
+
+// Route returns the route r was matched to, or the route router matches r to if r was not
+// routed yet, or nil.
+func Route(router *mux.Router, r *http.Request) *mux.Route {
+	if rt := mux.CurrentRoute(r); rt != nil {
+		return rt
+	}
+	var m mux.RouteMatch
+	if router == nil || !router.Match(r, &m) {
+		return nil
+	}
+	return m.Route
+}
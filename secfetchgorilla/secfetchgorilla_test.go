@@ -0,0 +1,63 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchgorilla
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/gorilla/mux"
+)
+
+func TestExemptRouteNames(t *testing.T) {
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	newRouter := func() *mux.Router {
+		r := mux.NewRouter()
+		r.Handle("/avatars/{id}", noop).Name("public:avatar")
+		r.Handle("/users/{id}", noop).Name("user")
+		r.Handle("/settings", noop)
+		return r
+	}
+	used := newRouter()
+	used.Use(secfetch.Middleware(ExemptRouteNames(used, "public:")))
+	wrapped := newRouter()
+	handlers := map[string]http.Handler{
+		"use":     used,
+		"wrapped": secfetch.ProtectHandler(wrapped, ExemptRouteNames(wrapped, "public:")),
+	}
+	var tests = []struct {
+		path string
+		want int
+	}{
+		{path: "/avatars/42", want: http.StatusOK},
+		{path: "/users/42", want: http.StatusForbidden},
+		{path: "/settings", want: http.StatusForbidden},
+	}
+	for name, h := range handlers {
+		for _, tt := range tests {
+			t.Run(name+tt.path, func(t *testing.T) {
+				r := httptest.NewRequest("POST", tt.path, nil)
+				r.Header.Set("sec-fetch-site", "cross-site")
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				if w.Code != tt.want {
+					t.Errorf("got status %d, want %d", w.Code, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/empijei/go-sec-fetch/secfetchgqlgen
+
+go 1.26.0
+
+require (
+	github.com/99designs/gqlgen v0.17.94
+	github.com/empijei/go-sec-fetch v0.1.0
+	github.com/vektah/gqlparser/v2 v2.5.36
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/sosodev/duration v1.4.0 // indirect
+	go.yaml.in/yaml/v3 v3.0.5 // indirect
+	golang.org/x/net v0.57.0 // indirect
+	golang.org/x/sync v0.23.0 // indirect
+)
@@ -0,0 +1,173 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchgqlgen isolates gqlgen GraphQL servers with secfetch policies, deciding
+// per operation rather than per request.
+//
+// GraphQL servers expose a single endpoint, so requests are checked against the policy by
+// Handler, which must wrap the server, and the decision is taken and enforced by the Extension,
+// which knows the operation type:
+//
+//	srv := handler.New(schema)
+//	srv.Use(secfetchgqlgen.New(secfetchgqlgen.AllowPersistedQueryGETs()))
+//	mux.Handle("/query", secfetchgqlgen.Handler(secfetch.ResourceIsolationPolicy(), srv))
+package secfetchgqlgen
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/99designs/gqlgen/graphql"
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// ErrorCode is the "code" extension of the GraphQL errors returned for rejected operations.
+const ErrorCode = "SECFETCH_REJECTED"
+
+// evaluation is the check of a request by Handler, applied by the Extension.
+type evaluation struct {
+	p *secfetch.Policy
+	w http.ResponseWriter
+	r *http.Request
+	d secfetch.Decision
+	// applied is set once the Extension applied the decision for an operation.
+	applied atomic.Bool
+}
+
+type evaluationKey struct{}
+
+// Handler checks requests against p and passes all of them to h, which must be a gqlgen server
+// using the Extension to reject the operations p rejected.
+//
+// The decision is applied, like p.Protect does, by the Extension once it knows whether the
+// operation is allowed anyway by its Options, so that the reports, metrics and hooks of p only
+// account for the operations that are actually rejected. Requests that don't reach the Extension,
+// e.g. because they are malformed, are evaluated by Handler after h returns.
+func Handler(p *secfetch.Policy, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ev := &evaluation{p: p, w: w, r: r, d: p.Check(r)}
+		ctx := context.WithValue(secfetch.NewContext(r.Context(), ev.d), evaluationKey{}, ev)
+		h.ServeHTTP(w, r.WithContext(ctx))
+		if !ev.applied.Load() {
+			p.EvaluateDecision(w, r, ev.d)
+		}
+	})
+}
+
+// Extension is a gqlgen extension that rejects the operations whose request was rejected by
+// the policy of Handler, unless they are queries allowed by its Options.
+// Operations that didn't go through Handler are always rejected.
+type Extension struct {
+	persistedGETs bool
+	introspection bool
+}
+
+var (
+	_ graphql.HandlerExtension        = (*Extension)(nil)
+	_ graphql.OperationContextMutator = (*Extension)(nil)
+)
+
+// An Option configures an Extension.
+type Option func(*Extension)
+
+// AllowPersistedQueryGETs allows queries sent as GET requests referencing a persisted query,
+// e.g. with Automatic Persisted Queries, regardless of the policy. Since such queries can't
+// be modified by the sender and can be cached, they can be served to other sites like other
+// static resources.
+func AllowPersistedQueryGETs() Option {
+	return func(e *Extension) {
+		e.persistedGETs = true
+	}
+}
+
+// AllowIntrospection allows introspection queries regardless of the policy, e.g. to let
+// development tools hosted on other sites inspect the schema. It should not be used in
+// production.
+func AllowIntrospection() Option {
+	return func(e *Extension) {
+		e.introspection = true
+	}
+}
+
+// New returns an Extension configured with opts.
+func New(opts ...Option) *Extension {
+	e := &Extension{}
+	for _, o := range opts {
+		o(e)
+	}
+	return e
+}
+
+// ExtensionName implements graphql.HandlerExtension.
+func (e *Extension) ExtensionName() string {
+	return "SecFetch"
+}
+
+// Validate implements graphql.HandlerExtension.
+func (e *Extension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationContext rejects the operation of oc if its request was rejected by the policy
+// and it is not allowed by the options of e. Operations allowed by the options are reported with
+// secfetch.RuleExempt.
+func (e *Extension) MutateOperationContext(ctx context.Context, oc *graphql.OperationContext) *gqlerror.Error {
+	ev, ok := ctx.Value(evaluationKey{}).(*evaluation)
+	if !ok {
+		return gqlerror.Errorf("secfetch: request was not evaluated by secfetchgqlgen.Handler")
+	}
+	d := ev.d
+	if !d.Allowed && e.allowedQuery(ev.r.Method, oc) {
+		d.Allowed, d.Rule = true, secfetch.RuleExempt
+	}
+	ev.applied.Store(true)
+	if _, reject := ev.p.EvaluateDecision(ev.w, ev.r, d); !reject {
+		return nil
+	}
+	err := gqlerror.Errorf("Invalid resource access")
+	err.Extensions = map[string]interface{}{"code": ErrorCode, "rule": string(d.Rule)}
+	return err
+}
+
+func (e *Extension) allowedQuery(method string, oc *graphql.OperationContext) bool {
+	if oc.Operation == nil || oc.Operation.Operation != ast.Query {
+		return false
+	}
+	if e.persistedGETs && method == http.MethodGet && oc.Extensions["persistedQuery"] != nil {
+		return true
+	}
+	return e.introspection && isIntrospection(oc.Operation)
+}
+
+// isIntrospection reports whether op only selects introspection fields.
+func isIntrospection(op *ast.OperationDefinition) bool {
+	if len(op.SelectionSet) == 0 {
+		return false
+	}
+	for _, s := range op.SelectionSet {
+		f, ok := s.(*ast.Field)
+		if !ok {
+			return false
+		}
+		switch f.Name {
+		case "__schema", "__type", "__typename":
+		default:
+			return false
+		}
+	}
+	return true
+}
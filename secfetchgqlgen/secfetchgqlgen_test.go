@@ -0,0 +1,130 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchgqlgen
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+func TestExtension(t *testing.T) {
+	persisted := map[string]interface{}{"persistedQuery": map[string]interface{}{"version": 1}}
+	var tests = []struct {
+		name       string
+		opts       []Option
+		method     string
+		site       string
+		query      string
+		extensions map[string]interface{}
+		wantRule   string
+	}{
+		{name: "same-origin mutation", method: "POST", site: "same-origin", query: "mutation { a }"},
+		{name: "cross-site mutation", method: "POST", site: "cross-site", query: "mutation { a }", wantRule: "cross-site-method"},
+		{name: "cross-site query", method: "POST", site: "cross-site", query: "{ a }", wantRule: "cross-site-method"},
+		{name: "persisted get", opts: []Option{AllowPersistedQueryGETs()}, method: "GET", site: "cross-site", query: "{ a }", extensions: persisted},
+		{name: "persisted get disabled", method: "GET", site: "cross-site", query: "{ a }", extensions: persisted, wantRule: "cross-site-destination"},
+		{name: "persisted post", opts: []Option{AllowPersistedQueryGETs()}, method: "POST", site: "cross-site", query: "{ a }", extensions: persisted, wantRule: "cross-site-method"},
+		{name: "introspection", opts: []Option{AllowIntrospection()}, method: "POST", site: "cross-site", query: "{ __schema { types { name } } }"},
+		{name: "mixed introspection", opts: []Option{AllowIntrospection()}, method: "POST", site: "cross-site", query: "{ __schema { types { name } } a }", wantRule: "cross-site-method"},
+		{name: "introspection disabled", method: "POST", site: "cross-site", query: "{ __type(name: \"A\") { name } }", wantRule: "cross-site-method"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.ParseQuery(&ast.Source{Input: tt.query})
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := New(tt.opts...)
+			var gotRule string
+			var gotErr bool
+			srv := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				oc := &graphql.OperationContext{Doc: doc, Operation: doc.Operations[0], Extensions: tt.extensions}
+				if err := e.MutateOperationContext(r.Context(), oc); err != nil {
+					gotErr = true
+					if err.Extensions["code"] != ErrorCode {
+						t.Errorf("got error code %v, want %s", err.Extensions["code"], ErrorCode)
+					}
+					gotRule, _ = err.Extensions["rule"].(string)
+				}
+			})
+			r := httptest.NewRequest(tt.method, "/query", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", "cors")
+			r.Header.Set("sec-fetch-dest", "empty")
+			Handler(secfetch.ResourceIsolationPolicy(), srv).ServeHTTP(httptest.NewRecorder(), r)
+			if gotErr != (tt.wantRule != "") || gotRule != tt.wantRule {
+				t.Errorf("got rejected %v with rule %q, want rule %q", gotErr, gotRule, tt.wantRule)
+			}
+		})
+	}
+
+	// Operations that bypassed Handler fail closed.
+	doc, _ := parser.ParseQuery(&ast.Source{Input: "{ a }"})
+	oc := &graphql.OperationContext{Doc: doc, Operation: doc.Operations[0]}
+	if err := New().MutateOperationContext(context.Background(), oc); err == nil {
+		t.Error("got no error for an operation that was not evaluated")
+	}
+}
+
+func TestHandlerReportsFinalOutcome(t *testing.T) {
+	var blocked, allowed []secfetch.Rule
+	p := secfetch.ResourceIsolationPolicy(
+		secfetch.OnAllow(func(r *http.Request, d secfetch.Decision) { allowed = append(allowed, d.Rule) }),
+		secfetch.OnBlock(func(r *http.Request, d secfetch.Decision, _ bool) { blocked = append(blocked, d.Rule) }),
+	)
+	e := New(AllowIntrospection())
+	var tests = []struct {
+		name        string
+		query       string
+		wantAllowed []secfetch.Rule
+		wantBlocked []secfetch.Rule
+	}{
+		{name: "allowed introspection", query: "{ __schema { types { name } } }", wantAllowed: []secfetch.Rule{secfetch.RuleExempt}},
+		{name: "rejected query", query: "{ a }", wantBlocked: []secfetch.Rule{secfetch.RuleCrossSiteMethod}},
+		{name: "no operation", wantBlocked: []secfetch.Rule{secfetch.RuleCrossSiteMethod}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocked, allowed = nil, nil
+			srv := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.query == "" {
+					return
+				}
+				doc, err := parser.ParseQuery(&ast.Source{Input: tt.query})
+				if err != nil {
+					t.Fatal(err)
+				}
+				oc := &graphql.OperationContext{Doc: doc, Operation: doc.Operations[0]}
+				e.MutateOperationContext(r.Context(), oc)
+			})
+			r := httptest.NewRequest("POST", "/query", nil)
+			r.Header.Set("sec-fetch-site", "cross-site")
+			r.Header.Set("sec-fetch-mode", "cors")
+			r.Header.Set("sec-fetch-dest", "empty")
+			Handler(p, srv).ServeHTTP(httptest.NewRecorder(), r)
+			if !reflect.DeepEqual(allowed, tt.wantAllowed) || !reflect.DeepEqual(blocked, tt.wantBlocked) {
+				t.Errorf("got allowed %v, blocked %v, want %v, %v", allowed, blocked, tt.wantAllowed, tt.wantBlocked)
+			}
+		})
+	}
+}
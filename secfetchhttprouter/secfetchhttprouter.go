@@ -0,0 +1,45 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchhttprouter isolates julienschmidt/httprouter handles with secfetch policies.
+//
+// Example usage:
+//
+//	p := secfetch.ResourceIsolationPolicy()
+//	router := httprouter.New()
+//	router.POST("/users/:id", secfetchhttprouter.Protect(p, updateUser))
+//
+// Whole routers are http.Handlers, and can be protected with secfetch.Policy.Protect instead.
+package secfetchhttprouter
+
+import (
+	"net/http"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Protect isolates h from the requests rejected by p, like p.Protect does for http.Handlers.
+// The secfetch.Decision taken for requests that reach h can be retrieved with
+// secfetch.FromContext.
+func Protect(p *secfetch.Policy, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		r, reject := p.Evaluate(w, r)
+		if reject {
+			p.ServeDenied(w, r)
+			return
+		}
+		h(w, r, ps)
+	}
+}
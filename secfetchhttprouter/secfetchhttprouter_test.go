@@ -0,0 +1,59 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchhttprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestProtect(t *testing.T) {
+	router := httprouter.New()
+	var gotID string
+	var gotRule secfetch.Rule
+	router.POST("/users/:id", Protect(secfetch.ResourceIsolationPolicy(), func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		gotID = ps.ByName("id")
+		d, _ := secfetch.FromContext(r.Context())
+		gotRule = d.Rule
+	}))
+	var tests = []struct {
+		site     string
+		want     int
+		wantID   string
+		wantRule secfetch.Rule
+	}{
+		{site: "same-origin", want: http.StatusOK, wantID: "42", wantRule: secfetch.RuleTrustedSite},
+		{site: "cross-site", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.site, func(t *testing.T) {
+			gotID, gotRule = "", ""
+			r := httptest.NewRequest("POST", "/users/42", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if gotID != tt.wantID || gotRule != tt.wantRule {
+				t.Errorf("handle got id %q and rule %q, want %q and %q", gotID, gotRule, tt.wantID, tt.wantRule)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+module github.com/empijei/go-sec-fetch/secfetchlogrus
+
+go 1.26.0
+
+require (
+	github.com/empijei/go-sec-fetch v0.1.0
+	github.com/sirupsen/logrus v1.10.2
+)
+
+require (
+	go.yaml.in/yaml/v3 v3.0.5 // indirect
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/sys v0.48.0 // indirect
+)
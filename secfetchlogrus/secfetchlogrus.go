@@ -0,0 +1,97 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchlogrus logs the requests rejected by secfetch policies with logrus.
+//
+// Example usage:
+//
+//	l := secfetchlogrus.New(logrus.StandardLogger(), logrus.WarnLevel)
+//	h := secfetch.ProtectHandlerLogOnly(mux, l, secfetch.FramingIsolation())
+//
+// Records have the same message and field names as the ones of secfetch.SlogLogger, see
+// secfetch.Report.Fields, unless they are renamed with Logger.FieldNames.
+package secfetchlogrus
+
+import (
+	"net/http"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger is a secfetch.RequestLogger, a secfetch.ReportLogger and a secfetch.SummaryLogger that
+// emits records to a logrus.Logger.
+type Logger struct {
+	// FieldNames maps the default field names to the ones records are emitted with, e.g. to
+	// match the schema of existing dashboards. Fields mapped to "" are omitted, fields that are
+	// not mapped keep their default name. FieldNames must not be modified once the Logger is in
+	// use.
+	FieldNames map[string]string
+
+	l     *logrus.Logger
+	level logrus.Level
+}
+
+// New returns a Logger that emits records to l at level.
+func New(l *logrus.Logger, level logrus.Level) *Logger {
+	return &Logger{l: l, level: level}
+}
+
+// LogRequest implements secfetch.RequestLogger.
+func (l *Logger) LogRequest(r *http.Request) {
+	if !l.l.IsLevelEnabled(l.level) {
+		return
+	}
+	secfetch.LogRequestReport(l, r)
+}
+
+// LogReport implements secfetch.ReportLogger.
+func (l *Logger) LogReport(rep *secfetch.Report) {
+	if !l.l.IsLevelEnabled(l.level) {
+		return
+	}
+	fs := rep.Fields()
+	fields := make(logrus.Fields, len(fs))
+	for _, f := range fs {
+		l.set(fields, f.Key, f.Value)
+	}
+	l.l.WithFields(fields).Log(l.level, rep.Message())
+}
+
+// LogSummary implements secfetch.SummaryLogger.
+func (l *Logger) LogSummary(s *secfetch.Summary) {
+	if !l.l.IsLevelEnabled(l.level) {
+		return
+	}
+	fields := make(logrus.Fields, 7)
+	l.set(fields, "path", s.Path)
+	l.set(fields, "method", s.Method)
+	l.set(fields, "site", s.Site)
+	l.set(fields, "mode", s.Mode)
+	l.set(fields, "count", s.Count)
+	l.set(fields, "first", s.First)
+	l.set(fields, "last", s.Last)
+	l.l.WithFields(fields).Log(l.level, secfetch.SummaryMessage)
+}
+
+// set sets the field named key in fields, renamed according to l.FieldNames.
+func (l *Logger) set(fields logrus.Fields, key string, v interface{}) {
+	if name, ok := l.FieldNames[key]; ok {
+		if name == "" {
+			return
+		}
+		key = name
+	}
+	fields[key] = v
+}
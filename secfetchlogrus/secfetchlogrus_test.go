@@ -0,0 +1,91 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchlogrus
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func newTestLogger() (*logrus.Logger, *test.Hook) {
+	ll := logrus.New()
+	ll.SetOutput(io.Discard)
+	return ll, test.NewLocal(ll)
+}
+
+func TestLogger(t *testing.T) {
+	ll, hook := newTestLogger()
+	l := New(ll, logrus.WarnLevel)
+	l.FieldNames = map[string]string{"path": "http.path", "remote_addr": ""}
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r := httptest.NewRequest("POST", "/transfer", nil)
+	r.Header.Set("sec-fetch-site", "cross-site")
+	r.Header.Set("sec-fetch-mode", "cors")
+	secfetch.ProtectHandlerLogOnly(noop, l).ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(hook.Entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(hook.Entries))
+	}
+	e := hook.LastEntry()
+	if e.Level != logrus.WarnLevel || e.Message != "secfetch: request would be rejected by policy" {
+		t.Errorf("got entry %q at %v", e.Message, e.Level)
+	}
+	want := logrus.Fields{
+		"http.path":  "/transfer",
+		"method":     "POST",
+		"site":       "cross-site",
+		"mode":       "cors",
+		"dest":       "",
+		"rule":       "cross-site-method",
+		"request_id": "",
+	}
+	if !reflect.DeepEqual(e.Data, want) {
+		t.Errorf("got fields %v, want %v", e.Data, want)
+	}
+}
+
+func TestLogSummary(t *testing.T) {
+	ll, hook := newTestLogger()
+	l := New(ll, logrus.InfoLevel)
+	t0 := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	l.LogSummary(&secfetch.Summary{Path: "/a", Method: "POST", Site: "cross-site", Mode: "cors", Count: 3, First: t0, Last: t0})
+	if len(hook.Entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(hook.Entries))
+	}
+	want := logrus.Fields{"path": "/a", "method": "POST", "site": "cross-site", "mode": "cors", "count": 3, "first": t0, "last": t0}
+	if e := hook.LastEntry(); e.Message != secfetch.SummaryMessage || !reflect.DeepEqual(e.Data, want) {
+		t.Errorf("got entry %q with fields %v, want fields %v", e.Message, e.Data, want)
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	ll, hook := newTestLogger()
+	ll.SetLevel(logrus.ErrorLevel)
+	l := New(ll, logrus.InfoLevel)
+	l.LogReport(&secfetch.Report{Path: "/"})
+	l.LogRequest(httptest.NewRequest("GET", "/", nil))
+	l.LogSummary(&secfetch.Summary{Path: "/"})
+	if len(hook.Entries) != 0 {
+		t.Errorf("got %d entries below the logger level", len(hook.Entries))
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchnegroni isolates negroni stacks with secfetch policies.
+//
+// Example usage:
+//
+//	n := negroni.New()
+//	n.Use(secfetchnegroni.New(secfetch.ResourceIsolationPolicy()))
+//	n.UseHandler(mux)
+package secfetchnegroni
+
+import (
+	"net/http"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/urfave/negroni/v3"
+)
+
+// Handler is a negroni.Handler that evaluates requests against a policy.
+type Handler struct {
+	p *secfetch.Policy
+}
+
+var _ negroni.Handler = (*Handler)(nil)
+
+// New returns a Handler that isolates the rest of the stack from the requests rejected by p,
+// like p.Protect does for http.Handlers.
+func New(p *secfetch.Policy) *Handler {
+	return &Handler{p: p}
+}
+
+// ServeHTTP calls next with the requests allowed by the policy, and serves the deny response
+// of the policy to the others.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	r, reject := h.p.Evaluate(w, r)
+	if reject {
+		h.p.ServeDenied(w, r)
+		return
+	}
+	next(w, r)
+}
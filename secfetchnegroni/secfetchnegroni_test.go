@@ -0,0 +1,57 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchnegroni
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/urfave/negroni/v3"
+)
+
+func TestHandler(t *testing.T) {
+	n := negroni.New()
+	n.Use(New(secfetch.ResourceIsolationPolicy(secfetch.DenyStatus(http.StatusTeapot))))
+	var gotRule secfetch.Rule
+	n.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, _ := secfetch.FromContext(r.Context())
+		gotRule = d.Rule
+	})
+	var tests = []struct {
+		site     string
+		want     int
+		wantRule secfetch.Rule
+	}{
+		{site: "same-origin", want: http.StatusOK, wantRule: secfetch.RuleTrustedSite},
+		{site: "cross-site", want: http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.site, func(t *testing.T) {
+			gotRule = ""
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			w := httptest.NewRecorder()
+			n.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if gotRule != tt.wantRule {
+				t.Errorf("got rule %q in handler, want %q", gotRule, tt.wantRule)
+			}
+		})
+	}
+}
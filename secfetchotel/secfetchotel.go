@@ -0,0 +1,78 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchotel integrates secfetch policies with OpenTelemetry.
+//
+// Example usage:
+//
+//	m, err := secfetchotel.NewMetrics(otel.GetMeterProvider())
+//	if err != nil {
+//		// Handle error.
+//	}
+//	h := secfetch.ProtectHandler(mux, secfetch.RecordMetrics(m))
+package secfetchotel
+
+import (
+	"context"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const scope = "github.com/empijei/go-sec-fetch/secfetchotel"
+
+// Metrics is a secfetch.MetricsRecorder that records decisions with the OpenTelemetry metrics
+// API, as the secfetch.requests counter and the secfetch.evaluation.duration histogram.
+//
+// Measurements are attributed with the outcome ("allowed", "blocked" or "would-block"),
+// enforcement mode, rule, and the Fetch Metadata site, mode and dest. Fetch Metadata values not
+// defined by the specification are reported as "other", see secfetch.Decision.Canonical.
+type Metrics struct {
+	requests metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+// NewMetrics returns Metrics that record measurements with a meter obtained from mp.
+func NewMetrics(mp metric.MeterProvider) (*Metrics, error) {
+	meter := mp.Meter(scope)
+	requests, err := meter.Int64Counter("secfetch.requests",
+		metric.WithDescription("Requests evaluated by Fetch Metadata policies."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram("secfetch.evaluation.duration",
+		metric.WithDescription("Time spent evaluating requests against Fetch Metadata policies."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	return &Metrics{requests: requests, duration: duration}, nil
+}
+
+// RecordDecision implements secfetch.MetricsRecorder.
+func (m *Metrics) RecordDecision(ctx context.Context, ms *secfetch.Measurement) {
+	d := ms.Decision.Canonical()
+	attrs := metric.WithAttributes(
+		attribute.String("secfetch.outcome", string(ms.Outcome)),
+		attribute.String("secfetch.enforcement", ms.Mode.String()),
+		attribute.String("secfetch.rule", string(d.Rule)),
+		attribute.String("secfetch.site", d.Site),
+		attribute.String("secfetch.mode", d.Mode),
+		attribute.String("secfetch.dest", d.Dest),
+	)
+	m.requests.Add(ctx, 1, attrs)
+	m.duration.Record(ctx, ms.Elapsed.Seconds(), attrs)
+}
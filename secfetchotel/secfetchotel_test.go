@@ -0,0 +1,81 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchotel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	m, err := NewMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatalf("NewMetrics: %v", err)
+	}
+	p := secfetch.ResourceIsolationPolicy(secfetch.RecordMetrics(m))
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, site := range []string{"same-origin", "same-origin", "cross-site"} {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("sec-fetch-site", site)
+		r.Header.Set("sec-fetch-mode", "cors")
+		p.Protect(noop).ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if len(rm.ScopeMetrics) != 1 {
+		t.Fatalf("got %d scopes, want 1", len(rm.ScopeMetrics))
+	}
+	got := map[string]map[string]uint64{}
+	for _, md := range rm.ScopeMetrics[0].Metrics {
+		counts := map[string]uint64{}
+		switch data := md.Data.(type) {
+		case metricdata.Sum[int64]:
+			for _, dp := range data.DataPoints {
+				counts[outcome(dp.Attributes)] += uint64(dp.Value)
+			}
+		case metricdata.Histogram[float64]:
+			for _, dp := range data.DataPoints {
+				counts[outcome(dp.Attributes)] += dp.Count
+			}
+		default:
+			t.Fatalf("%s: unexpected data type %T", md.Name, md.Data)
+		}
+		got[md.Name] = counts
+	}
+	want := map[string]uint64{"allowed": 2, "blocked": 1}
+	for _, name := range []string{"secfetch.requests", "secfetch.evaluation.duration"} {
+		for k, v := range want {
+			if got[name][k] != v {
+				t.Errorf("%s{outcome=%q}: got %d, want %d", name, k, got[name][k], v)
+			}
+		}
+	}
+}
+
+func outcome(s attribute.Set) string {
+	v, _ := s.Value("secfetch.outcome")
+	return v.AsString()
+}
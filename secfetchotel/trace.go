@@ -0,0 +1,60 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchotel
+
+import (
+	"context"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanAnnotator is a secfetch.MetricsRecorder that annotates the span active in the request
+// context, if any, with the Fetch Metadata of the request and the decision taken for it.
+// It also adds a "secfetch.blocked" or "secfetch.would_block" event to the span when the request
+// is rejected.
+//
+// Example usage:
+//
+//	h := secfetch.ProtectHandler(mux, secfetch.RecordMetrics(secfetchotel.SpanAnnotator{}))
+//
+// The span must be started before the protected handler runs, e.g. by wrapping it with
+// otelhttp.NewHandler.
+type SpanAnnotator struct{}
+
+// RecordDecision implements secfetch.MetricsRecorder.
+func (SpanAnnotator) RecordDecision(ctx context.Context, ms *secfetch.Measurement) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	d := ms.Decision
+	span.SetAttributes(
+		attribute.String("secfetch.site", d.Site),
+		attribute.String("secfetch.mode", d.Mode),
+		attribute.String("secfetch.dest", d.Dest),
+		attribute.String("secfetch.user", d.User),
+		attribute.String("secfetch.rule", string(d.Rule)),
+		attribute.String("secfetch.outcome", string(ms.Outcome)),
+		attribute.String("secfetch.enforcement", ms.Mode.String()),
+	)
+	switch ms.Outcome {
+	case secfetch.OutcomeBlocked:
+		span.AddEvent("secfetch.blocked", trace.WithAttributes(attribute.String("secfetch.rule", string(d.Rule))))
+	case secfetch.OutcomeWouldBlock:
+		span.AddEvent("secfetch.would_block", trace.WithAttributes(attribute.String("secfetch.rule", string(d.Rule))))
+	}
+}
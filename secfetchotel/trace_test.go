@@ -0,0 +1,73 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchotel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSpanAnnotator(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test")
+	p := secfetch.ResourceIsolationPolicy(secfetch.RecordMetrics(SpanAnnotator{}))
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		name, site string
+		h          http.Handler
+		wantEvent  string
+	}{
+		{name: "allowed", site: "same-origin", h: p.Protect(noop)},
+		{name: "blocked", site: "cross-site", h: p.Protect(noop), wantEvent: "secfetch.blocked"},
+		{name: "would block", site: "cross-site", h: p.ProtectLogOnly(noop, nil), wantEvent: "secfetch.would_block"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			r.Header.Set("sec-fetch-mode", "cors")
+			ctx, span := tracer.Start(r.Context(), tt.name)
+			tt.h.ServeHTTP(httptest.NewRecorder(), r.WithContext(ctx))
+			span.End()
+
+			spans := sr.Ended()
+			got := spans[len(spans)-1]
+			found := map[string]string{}
+			for _, kv := range got.Attributes() {
+				found[string(kv.Key)] = kv.Value.AsString()
+			}
+			if found["secfetch.site"] != tt.site || found["secfetch.mode"] != "cors" || found["secfetch.rule"] != string(p.Check(r).Rule) {
+				t.Errorf("got attributes %v", found)
+			}
+			var events []string
+			for _, e := range got.Events() {
+				events = append(events, e.Name)
+			}
+			if tt.wantEvent == "" && len(events) != 0 || tt.wantEvent != "" && (len(events) != 1 || events[0] != tt.wantEvent) {
+				t.Errorf("got events %v, want %q", events, tt.wantEvent)
+			}
+		})
+	}
+
+	// Requests without an active span are ignored.
+	r := httptest.NewRequest("POST", "/", nil)
+	p.Protect(noop).ServeHTTP(httptest.NewRecorder(), r)
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchprom exports the decisions taken by secfetch policies as Prometheus metrics.
+//
+// Example usage:
+//
+//	m := secfetchprom.New()
+//	prometheus.MustRegister(m)
+//	h := secfetch.ProtectHandler(mux, secfetch.RecordMetrics(m))
+package secfetchprom
+
+import (
+	"context"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics is a secfetch.MetricsRecorder that counts decisions, and a prometheus.Collector that
+// exports the counts as the secfetch_requests_total counter.
+//
+// The counter is labeled by outcome ("allowed", "blocked" or "would-block"), enforcement mode,
+// rule, and the Fetch Metadata site, mode and dest. Fetch Metadata values not defined by the
+// specification are reported as "other", see secfetch.Decision.Canonical.
+type Metrics struct {
+	requests *prometheus.CounterVec
+}
+
+// New returns Metrics that need to be registered to be exported.
+func New() *Metrics {
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "secfetch",
+			Name:      "requests_total",
+			Help:      "Requests evaluated by Fetch Metadata policies.",
+		}, []string{"outcome", "enforcement", "rule", "site", "mode", "dest"}),
+	}
+}
+
+// RecordDecision implements secfetch.MetricsRecorder.
+func (m *Metrics) RecordDecision(ctx context.Context, ms *secfetch.Measurement) {
+	d := ms.Decision.Canonical()
+	m.requests.WithLabelValues(string(ms.Outcome), ms.Mode.String(), string(d.Rule), d.Site, d.Mode, d.Dest).Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(m)
+
+	p := secfetch.ResourceIsolationPolicy(secfetch.RecordMetrics(m))
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	send := func(h http.Handler, method, site, mode, dest string) {
+		r := httptest.NewRequest(method, "/", nil)
+		r.Header.Set("sec-fetch-site", site)
+		r.Header.Set("sec-fetch-mode", mode)
+		r.Header.Set("sec-fetch-dest", dest)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	send(p.Protect(noop), "GET", "same-origin", "cors", "empty")
+	send(p.Protect(noop), "GET", "same-origin", "cors", "empty")
+	send(p.Protect(noop), "POST", "cross-site", "navigate", "document")
+	send(p.ProtectLogOnly(noop, nil), "POST", "cross-site", "bogus", "bogus")
+
+	want := `
+# HELP secfetch_requests_total Requests evaluated by Fetch Metadata policies.
+# TYPE secfetch_requests_total counter
+secfetch_requests_total{dest="document",enforcement="enforce",mode="navigate",outcome="blocked",rule="cross-site-method",site="cross-site"} 1
+secfetch_requests_total{dest="empty",enforcement="enforce",mode="cors",outcome="allowed",rule="trusted-site",site="same-origin"} 2
+secfetch_requests_total{dest="other",enforcement="log-only",mode="other",outcome="would-block",rule="cross-site-method",site="cross-site"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "secfetch_requests_total"); err != nil {
+		t.Error(err)
+	}
+}
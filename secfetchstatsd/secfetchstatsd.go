@@ -0,0 +1,140 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchstatsd exports the decisions taken by secfetch policies as StatsD metrics,
+// optionally tagged with the DogStatsD extension.
+//
+// Example usage:
+//
+//	m, err := secfetchstatsd.Dial("127.0.0.1:8125")
+//	if err != nil {
+//		// Handle error.
+//	}
+//	defer m.Close()
+//	m.Tags = []string{"service:myapp", "env:prod"}
+//	h := secfetch.ProtectHandler(mux, secfetch.RecordMetrics(m))
+package secfetchstatsd
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+)
+
+// DefaultPrefix is the default prefix of the names of metrics.
+const DefaultPrefix = "secfetch."
+
+// Metrics is a secfetch.MetricsRecorder that sends, for every evaluated request, a
+// <prefix>requests.<outcome> counter, where outcome is "allowed", "blocked" or "would-block",
+// and the evaluation time as the <prefix>evaluation timer, in milliseconds.
+//
+// With DogStatsD, metrics are tagged with Tags and with the enforcement mode, rule, and the Fetch
+// Metadata site, mode and dest. Fetch Metadata values not defined by the specification are
+// reported as "other", see secfetch.Decision.Canonical.
+//
+// The exported fields must not be modified once Metrics are in use.
+type Metrics struct {
+	// Prefix is prepended to the names of metrics. It defaults to DefaultPrefix.
+	Prefix string
+	// DogStatsD enables tags, which plain StatsD servers do not support. It defaults to true.
+	DogStatsD bool
+	// Tags are added to every metric with DogStatsD, e.g. "env:prod". Characters that are
+	// reserved by the protocol are replaced by underscores.
+	Tags []string
+
+	mu  sync.Mutex
+	buf []byte
+	w   io.Writer
+}
+
+// New returns Metrics that write to w, one write per evaluated request.
+func New(w io.Writer) *Metrics {
+	return &Metrics{Prefix: DefaultPrefix, DogStatsD: true, w: w}
+}
+
+// Dial returns Metrics that send datagrams to the StatsD server at the UDP address addr.
+func Dial(addr string) (*Metrics, error) {
+	c, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return New(c), nil
+}
+
+// Close closes the underlying writer, if it is an io.Closer.
+func (m *Metrics) Close() error {
+	if c, ok := m.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// RecordDecision implements secfetch.MetricsRecorder.
+//
+// Both metrics are sent in a single write, separated by a newline. Write errors are ignored, as
+// StatsD is a best-effort protocol.
+func (m *Metrics) RecordDecision(ctx context.Context, ms *secfetch.Measurement) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.buf[:0]
+	b = append(b, m.Prefix...)
+	b = append(b, "requests."...)
+	b = append(b, ms.Outcome...)
+	b = append(b, ":1|c"...)
+	b = m.appendTags(b, ms)
+	b = append(b, '\n')
+	b = append(b, m.Prefix...)
+	b = append(b, "evaluation:"...)
+	b = strconv.AppendFloat(b, float64(ms.Elapsed.Microseconds())/1000, 'f', -1, 64)
+	b = append(b, "|ms"...)
+	b = m.appendTags(b, ms)
+	m.w.Write(b)
+	m.buf = b
+}
+
+func (m *Metrics) appendTags(b []byte, ms *secfetch.Measurement) []byte {
+	if !m.DogStatsD {
+		return b
+	}
+	d := ms.Decision.Canonical()
+	b = append(b, "|#"...)
+	for _, t := range m.Tags {
+		b = append(b, tagReplacer.Replace(t)...)
+		b = append(b, ',')
+	}
+	for _, t := range [...]struct{ k, v string }{
+		{"enforcement", ms.Mode.String()},
+		{"rule", string(d.Rule)},
+		{"site", d.Site},
+		{"mode", d.Mode},
+		{"dest", d.Dest},
+	} {
+		if t.v == "" {
+			continue
+		}
+		b = append(b, t.k...)
+		b = append(b, ':')
+		b = append(b, t.v...)
+		b = append(b, ',')
+	}
+	return b[:len(b)-1]
+}
+
+// tagReplacer removes the characters that delimit metrics, fields and tags in DogStatsD.
+var tagReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_", "\r", "_")
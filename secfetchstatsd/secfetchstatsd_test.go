@@ -0,0 +1,118 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchstatsd
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+)
+
+// writes records each write separately.
+type writes []string
+
+func (w *writes) Write(b []byte) (int, error) {
+	*w = append(*w, string(b))
+	return len(b), nil
+}
+
+func TestRecordDecision(t *testing.T) {
+	blocked := &secfetch.Measurement{
+		Decision: secfetch.Decision{Rule: secfetch.RuleCrossSiteMethod, Site: "cross-site", Mode: "bogus", Dest: "document"},
+		Mode:     secfetch.Enforce,
+		Outcome:  secfetch.OutcomeBlocked,
+		Elapsed:  1500 * time.Microsecond,
+	}
+	allowed := &secfetch.Measurement{
+		Decision: secfetch.Decision{Allowed: true, Rule: secfetch.RuleMissingMetadata},
+		Mode:     secfetch.LogOnly,
+		Outcome:  secfetch.OutcomeAllowed,
+		Elapsed:  2 * time.Millisecond,
+	}
+	tests := []struct {
+		name  string
+		setup func(m *Metrics)
+		ms    *secfetch.Measurement
+		want  string
+	}{
+		{
+			name: "dogstatsd",
+			ms:   blocked,
+			want: "secfetch.requests.blocked:1|c|#enforcement:enforce,rule:cross-site-method,site:cross-site,mode:other,dest:document\n" +
+				"secfetch.evaluation:1.5|ms|#enforcement:enforce,rule:cross-site-method,site:cross-site,mode:other,dest:document",
+		},
+		{
+			name: "missing metadata",
+			ms:   allowed,
+			want: "secfetch.requests.allowed:1|c|#enforcement:log-only,rule:missing-metadata\n" +
+				"secfetch.evaluation:2|ms|#enforcement:log-only,rule:missing-metadata",
+		},
+		{
+			name:  "constant tags",
+			setup: func(m *Metrics) { m.Tags = []string{"env:prod", "bad|tag,#"} },
+			ms:    allowed,
+			want: "secfetch.requests.allowed:1|c|#env:prod,bad_tag__,enforcement:log-only,rule:missing-metadata\n" +
+				"secfetch.evaluation:2|ms|#env:prod,bad_tag__,enforcement:log-only,rule:missing-metadata",
+		},
+		{
+			name:  "plain statsd",
+			setup: func(m *Metrics) { m.DogStatsD, m.Prefix, m.Tags = false, "app.sf.", []string{"env:prod"} },
+			ms:    blocked,
+			want:  "app.sf.requests.blocked:1|c\napp.sf.evaluation:1.5|ms",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w writes
+			m := New(&w)
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+			m.RecordDecision(context.Background(), tt.ms)
+			m.RecordDecision(context.Background(), tt.ms)
+			if len(w) != 2 || w[0] != tt.want || w[1] != tt.want {
+				t.Errorf("got writes %q, want twice %q", w, tt.want)
+			}
+		})
+	}
+}
+
+func TestDial(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	m, err := Dial(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	m.RecordDecision(context.Background(), &secfetch.Measurement{Mode: secfetch.Enforce, Outcome: secfetch.OutcomeWouldBlock})
+
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "secfetch.requests.would-block:1|c|#enforcement:enforce\n"; !bytes.HasPrefix(buf[:n], []byte(want)) {
+		t.Errorf("got datagram %q, want prefix %q", buf[:n], want)
+	}
+}
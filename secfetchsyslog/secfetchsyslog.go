@@ -0,0 +1,234 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchsyslog sends the requests rejected by secfetch policies to syslog collectors,
+// as RFC 5424 messages whose structured data carries the fields of the reports.
+//
+// Example usage:
+//
+//	l, err := secfetchsyslog.Dial("tcp", "syslog.internal:601", "myapp")
+//	if err != nil {
+//		// Handle error.
+//	}
+//	defer l.Close()
+//	h := secfetch.ProtectHandler(mux, secfetch.ReportTo(l))
+//
+// Loggers write messages synchronously, so slow or unreachable collectors delay the rejected
+// requests they log. To keep them off the request path, wrap Loggers with
+// secfetch.NewAsyncLogger:
+//
+//	al := secfetch.NewAsyncLogger(l, 1000, 1)
+//	defer al.Close()
+//	h := secfetch.ProtectHandler(mux, secfetch.ReportTo(al))
+package secfetchsyslog
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+)
+
+// Facilities and severities of syslog messages, see RFC 5424 section 6.2.1.
+const (
+	FacilityAuth     = 4
+	FacilityAuthPriv = 10
+	FacilityLocal0   = 16
+
+	SeverityError   = 3
+	SeverityWarning = 4
+	SeverityNotice  = 5
+	SeverityInfo    = 6
+)
+
+// DefaultSDID is the default ID of the structured data element of messages. It uses the private
+// enterprise number reserved for documentation by RFC 5612, as RFC 5424 requires the IDs of
+// custom elements to have the form name@number.
+const DefaultSDID = "secfetch@32473"
+
+// Logger is a secfetch.RequestLogger, a secfetch.ReportLogger and a secfetch.SummaryLogger that
+// writes RFC 5424 messages. The fields of Reports are sent as parameters of a structured data
+// element, with the names of secfetch.Report.Fields, and Summaries as path, method, site, mode
+// and count parameters.
+//
+// The exported fields must not be modified once the Logger is in use.
+type Logger struct {
+	// Facility and Severity set the priority of messages. They default to FacilityAuth and
+	// SeverityWarning.
+	Facility, Severity int
+	// Hostname and AppName identify the sender of messages. Hostname defaults to the name
+	// reported by the kernel.
+	Hostname, AppName string
+	// SDID is the ID of the structured data element of messages. It defaults to DefaultSDID.
+	SDID string
+	// OctetCounting frames messages with their length, as required by stream transports like
+	// TCP, see RFC 6587 section 3.4.1. Dial sets it for stream networks.
+	OctetCounting bool
+
+	procID string
+
+	mu sync.Mutex
+	w  io.Writer
+	// dial connects to the collector again after write errors, for Loggers returned by Dial.
+	dial func() (io.Writer, error)
+	// redial is the time before which dial is not retried after failing.
+	redial time.Time
+	closed bool
+}
+
+// Connection parameters of the Loggers returned by Dial.
+const (
+	dialTimeout = 5 * time.Second
+	// redialInterval is the time during which messages are dropped after a failed reconnection,
+	// so that an unreachable collector doesn't delay every message by dialTimeout.
+	redialInterval = time.Second
+)
+
+// New returns a Logger that writes messages for appName to w.
+func New(w io.Writer, appName string) *Logger {
+	host, err := os.Hostname()
+	if err != nil {
+		host = ""
+	}
+	return &Logger{
+		Facility: FacilityAuth,
+		Severity: SeverityWarning,
+		Hostname: host,
+		AppName:  appName,
+		SDID:     DefaultSDID,
+		procID:   strconv.Itoa(os.Getpid()),
+		w:        w,
+	}
+}
+
+// Dial returns a Logger that sends messages for appName to the collector at addr, see
+// net.Dial. Messages are framed with their length for stream networks, like "tcp".
+//
+// If a message cannot be written, e.g. because the collector restarted, the Logger connects
+// again and retries it once. Messages are dropped while the collector is unreachable, and
+// reconnections are attempted at most once per second.
+func Dial(network, addr, appName string) (*Logger, error) {
+	dial := func() (io.Writer, error) {
+		return net.DialTimeout(network, addr, dialTimeout)
+	}
+	c, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	l := New(c, appName)
+	l.dial = dial
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		l.OctetCounting = true
+	}
+	return l, nil
+}
+
+// Close closes the underlying writer, if it is an io.Closer.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// LogRequest implements secfetch.RequestLogger.
+func (l *Logger) LogRequest(r *http.Request) {
+	secfetch.LogRequestReport(l, r)
+}
+
+// LogReport implements secfetch.ReportLogger.
+func (l *Logger) LogReport(rep *secfetch.Report) {
+	var sd strings.Builder
+	for _, f := range rep.Fields() {
+		writeParam(&sd, f.Key, f.Value)
+	}
+	l.write(rep.Time, "report", sd.String(), rep.Message())
+}
+
+// LogSummary implements secfetch.SummaryLogger.
+func (l *Logger) LogSummary(s *secfetch.Summary) {
+	var sd strings.Builder
+	writeParam(&sd, "path", s.Path)
+	writeParam(&sd, "method", s.Method)
+	writeParam(&sd, "site", s.Site)
+	writeParam(&sd, "mode", s.Mode)
+	writeParam(&sd, "count", strconv.Itoa(s.Count))
+	writeParam(&sd, "first", s.First.Format(time.RFC3339Nano))
+	writeParam(&sd, "last", s.Last.Format(time.RFC3339Nano))
+	l.write(s.Last, "summary", sd.String(), secfetch.SummaryMessage)
+}
+
+// paramEscaper escapes the characters that RFC 5424 section 6.3.3 requires to be escaped in
+// parameter values.
+var paramEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+func writeParam(sd *strings.Builder, name, value string) {
+	sd.WriteByte(' ')
+	sd.WriteString(name)
+	sd.WriteString(`="`)
+	paramEscaper.WriteString(sd, value)
+	sd.WriteByte('"')
+}
+
+func (l *Logger) write(t time.Time, msgID, params, msg string) {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	m := fmt.Sprintf("<%d>1 %s %s %s %s %s [%s%s] %s",
+		l.Facility*8+l.Severity, t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		nilValue(l.Hostname), nilValue(l.AppName), nilValue(l.procID), msgID, l.SDID, params, msg)
+	if l.OctetCounting {
+		m = strconv.Itoa(len(m)) + " " + m
+	} else {
+		m += "\n"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := io.WriteString(l.w, m); err == nil || l.dial == nil || l.closed {
+		return
+	}
+	now := time.Now()
+	if now.Before(l.redial) {
+		return
+	}
+	if c, ok := l.w.(io.Closer); ok {
+		c.Close()
+	}
+	w, err := l.dial()
+	if err != nil {
+		l.redial = now.Add(redialInterval)
+		return
+	}
+	l.w = w
+	io.WriteString(l.w, m)
+}
+
+// nilValue returns s, or the NILVALUE of RFC 5424 if s is empty.
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchsyslog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+)
+
+func TestLogReport(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "myapp")
+	l.Hostname = "web-1"
+	l.procID = "42"
+	t0 := time.Date(2019, 7, 1, 10, 0, 0, 123000, time.UTC)
+	l.LogReport(&secfetch.Report{
+		Time:       t0,
+		Enforced:   true,
+		Rule:       secfetch.RuleCrossSiteMethod,
+		Method:     "POST",
+		Path:       `/a"b\c]`,
+		RemoteAddr: "192.0.2.1:1234",
+		Site:       "cross-site",
+		Mode:       "cors",
+		Dest:       "empty",
+		RequestID:  "req-1",
+	})
+	want := `<36>1 2019-07-01T10:00:00.000123Z web-1 myapp 42 report [secfetch@32473 path="/a\"b\\c\]" method="POST" site="cross-site" mode="cors" dest="empty" remote_addr="192.0.2.1:1234" rule="cross-site-method" request_id="req-1"] secfetch: request rejected by policy` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLogSummary(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "")
+	l.Hostname = ""
+	l.procID = "42"
+	l.Facility, l.Severity = FacilityLocal0, SeverityInfo
+	l.SDID = "sf@1"
+	t0 := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	l.LogSummary(&secfetch.Summary{Path: "/a", Method: "POST", Site: "cross-site", Mode: "cors", Count: 3, First: t0, Last: t0})
+	want := `<134>1 2019-07-01T10:00:00.000000Z - - 42 summary [sf@1 path="/a" method="POST" site="cross-site" mode="cors" count="3" first="2019-07-01T10:00:00Z" last="2019-07-01T10:00:00Z"] ` + secfetch.SummaryMessage + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDial(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan string, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		defer c.Close()
+		br := bufio.NewReader(c)
+		n, err := br.ReadString(' ')
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(n))
+		msg := make([]byte, size)
+		if _, err := br.Read(msg); err != nil {
+			got <- err.Error()
+			return
+		}
+		got <- string(msg)
+	}()
+
+	l, err := Dial("tcp", ln.Addr().String(), "myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.LogReport(&secfetch.Report{Path: "/"})
+	msg := <-got
+	if !strings.HasPrefix(msg, "<36>1 ") || !strings.HasSuffix(msg, "secfetch: request would be rejected by policy") {
+		t.Errorf("got message %q", msg)
+	}
+}
+
+// brokenConn is a connection whose writes fail.
+type brokenConn struct{ closed bool }
+
+func (c *brokenConn) Write(b []byte) (int, error) { return 0, errors.New("broken pipe") }
+func (c *brokenConn) Close() error                { c.closed = true; return nil }
+
+func TestReconnect(t *testing.T) {
+	var (
+		buf     bytes.Buffer
+		dials   int
+		dialErr error
+	)
+	c := &brokenConn{}
+	l := New(c, "myapp")
+	l.dial = func() (io.Writer, error) {
+		dials++
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		return &buf, nil
+	}
+	l.LogReport(&secfetch.Report{Path: "/a"})
+	if !c.closed || dials != 1 || !strings.Contains(buf.String(), `path="/a"`) {
+		t.Fatalf("got closed %v, %d dials, messages %q, want the message to be sent on a new connection", c.closed, dials, buf.String())
+	}
+
+	// Failed reconnections are not retried for every message.
+	buf.Reset()
+	l.w, dialErr = &brokenConn{}, errors.New("connection refused")
+	l.LogReport(&secfetch.Report{Path: "/b"})
+	l.LogReport(&secfetch.Report{Path: "/c"})
+	if dials != 2 {
+		t.Errorf("got %d dials, want 2", dials)
+	}
+	l.redial, dialErr = time.Time{}, nil
+	l.LogReport(&secfetch.Report{Path: "/d"})
+	if dials != 3 || !strings.Contains(buf.String(), `path="/d"`) {
+		t.Errorf("got %d dials, messages %q, want a reconnection", dials, buf.String())
+	}
+
+	l.Close()
+	l.w = &brokenConn{}
+	l.LogReport(&secfetch.Report{Path: "/e"})
+	if dials != 3 {
+		t.Errorf("closed Logger reconnected")
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+)
+
+// Requests built by this package target https://example.com, and those issued by pages other than
+// same-origin ones come from the following origins.
+const (
+	SameSiteOrigin  = "https://app.example.com"
+	CrossSiteOrigin = "https://cross-site.example"
+)
+
+// newRequest returns a request for path, as sent by a browser with the given Fetch Metadata.
+// An empty site omits all Fetch Metadata headers.
+func newRequest(method, path, site, mode, dest, origin string) *http.Request {
+	r := httptest.NewRequest(method, "https://example.com"+path, nil)
+	if site != "" {
+		r.Header.Set("Sec-Fetch-Site", site)
+		r.Header.Set("Sec-Fetch-Mode", mode)
+		r.Header.Set("Sec-Fetch-Dest", dest)
+	}
+	// Navigations of the top-level document are emulated as triggered by the user.
+	if mode == "navigate" && dest == "document" {
+		r.Header.Set("Sec-Fetch-User", "?1")
+	}
+	if origin != "" {
+		if mode == "cors" || method != http.MethodGet && method != http.MethodHead {
+			r.Header.Set("Origin", origin)
+		}
+		r.Header.Set("Referer", origin+"/")
+	}
+	return r
+}
+
+// SameOriginFetch returns a GET fetch() request for path from a same-origin page.
+func SameOriginFetch(path string) *http.Request {
+	return newRequest(http.MethodGet, path, "same-origin", "cors", "empty", "https://example.com")
+}
+
+// SameOriginPost returns a POST fetch() request for path from a same-origin page.
+func SameOriginPost(path string) *http.Request {
+	return newRequest(http.MethodPost, path, "same-origin", "cors", "empty", "https://example.com")
+}
+
+// SameSiteFetch returns a POST fetch() request for path from SameSiteOrigin.
+func SameSiteFetch(path string) *http.Request {
+	return newRequest(http.MethodPost, path, "same-site", "cors", "empty", SameSiteOrigin)
+}
+
+// CrossSiteFetch returns a POST fetch() request for path from CrossSiteOrigin.
+func CrossSiteFetch(path string) *http.Request {
+	return newRequest(http.MethodPost, path, "cross-site", "cors", "empty", CrossSiteOrigin)
+}
+
+// CrossSiteFormPost returns a form submission to path from a page on CrossSiteOrigin, the
+// typical CSRF attack.
+func CrossSiteFormPost(path string) *http.Request {
+	r := newRequest(http.MethodPost, path, "cross-site", "navigate", "document", CrossSiteOrigin)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// CrossSiteNavigation returns a navigation to path triggered by following a link on a page on
+// CrossSiteOrigin.
+func CrossSiteNavigation(path string) *http.Request {
+	return newRequest(http.MethodGet, path, "cross-site", "navigate", "document", CrossSiteOrigin)
+}
+
+// CrossSiteIframe returns a request to load path in an iframe on a page on CrossSiteOrigin.
+func CrossSiteIframe(path string) *http.Request {
+	return newRequest(http.MethodGet, path, "cross-site", "navigate", "iframe", CrossSiteOrigin)
+}
+
+// CrossSiteSubresource returns a request for path loaded as dest, e.g. "image" or "script", by a
+// page on CrossSiteOrigin.
+func CrossSiteSubresource(path, dest string) *http.Request {
+	return newRequest(http.MethodGet, path, "cross-site", "no-cors", dest, CrossSiteOrigin)
+}
+
+// UserNavigation returns a navigation to path initiated by the user, e.g. by typing the URL.
+func UserNavigation(path string) *http.Request {
+	return newRequest(http.MethodGet, path, "none", "navigate", "document", "")
+}
+
+// LegacyRequest returns a request for path without Fetch Metadata, as sent by old browsers and
+// non-browser clients.
+func LegacyRequest(method, path string) *http.Request {
+	return newRequest(method, path, "", "", "", "")
+}
+
+// TB is the subset of testing.TB used by the assertion helpers.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertAllowed reports an error on t for each of rs that p rejects.
+func AssertAllowed(t TB, p *secfetch.Policy, rs ...*http.Request) {
+	t.Helper()
+	for _, r := range rs {
+		if d := p.Check(r); !d.Allowed {
+			t.Errorf("%s: got %v, want allowed", describe(r), d)
+		}
+	}
+}
+
+// AssertBlocked reports an error on t for each of rs that p allows.
+func AssertBlocked(t TB, p *secfetch.Policy, rs ...*http.Request) {
+	t.Helper()
+	for _, r := range rs {
+		if d := p.Check(r); d.Allowed {
+			t.Errorf("%s: got %v, want blocked", describe(r), d)
+		}
+	}
+}
+
+// describe summarizes r for assertion failures.
+func describe(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method + " " + r.URL.Path)
+	for _, h := range []string{"Sec-Fetch-Site", "Sec-Fetch-Mode", "Sec-Fetch-Dest", "Origin"} {
+		if v := r.Header.Get(h); v != "" {
+			b.WriteString(" " + h + "=" + v)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchtest
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+)
+
+func TestRequests(t *testing.T) {
+	p := secfetch.ResourceIsolationPolicy()
+	AssertAllowed(t, p,
+		SameOriginFetch("/"),
+		SameOriginPost("/"),
+		SameSiteFetch("/"),
+		CrossSiteNavigation("/"),
+		CrossSiteIframe("/"),
+		UserNavigation("/"),
+		LegacyRequest("POST", "/"),
+	)
+	AssertBlocked(t, p,
+		CrossSiteFetch("/"),
+		CrossSiteFormPost("/"),
+		CrossSiteSubresource("/", "image"),
+	)
+	AssertAllowed(t, secfetch.ResourceIsolationPolicy(secfetch.ExemptPaths("/hooks/*")), CrossSiteFormPost("/hooks/a"))
+	AssertBlocked(t, secfetch.ResourceIsolationPolicy(secfetch.FramingIsolation()), CrossSiteIframe("/"))
+}
+
+type recordingTB struct {
+	errs []string
+}
+
+func (t *recordingTB) Helper() {}
+
+func (t *recordingTB) Errorf(format string, args ...interface{}) {
+	t.errs = append(t.errs, fmt.Sprintf(format, args...))
+}
+
+func TestAssertFailures(t *testing.T) {
+	p := secfetch.ResourceIsolationPolicy()
+	var tb recordingTB
+	AssertAllowed(&tb, p, CrossSiteFormPost("/transfer"), SameOriginFetch("/"))
+	AssertBlocked(&tb, p, SameOriginFetch("/"))
+	want := []string{
+		"POST /transfer Sec-Fetch-Site=cross-site Sec-Fetch-Mode=navigate Sec-Fetch-Dest=document Origin=https://cross-site.example: got blocked; rule=cross-site-method, want allowed",
+		"GET / Sec-Fetch-Site=same-origin Sec-Fetch-Mode=cors Sec-Fetch-Dest=empty Origin=https://example.com: got allowed; rule=trusted-site, want blocked",
+	}
+	if fmt.Sprint(tb.errs) != fmt.Sprint(want) {
+		t.Errorf("got errors\n%q\nwant\n%q", tb.errs, want)
+	}
+	if r := UserNavigation("/"); r.Header.Get("Sec-Fetch-User") != "?1" || r.Method != http.MethodGet {
+		t.Errorf("UserNavigation: got %s with headers %v", r.Method, r.Header)
+	}
+}
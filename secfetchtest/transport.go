@@ -0,0 +1,136 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchtest provides utilities to test servers protected by secfetch policies:
+// builders of requests as sent by browsers and assertions, to unit test policies, and a
+// browser-emulating Transport, to test servers end to end.
+//
+// Example usage:
+//
+//	p := secfetch.ResourceIsolationPolicy(secfetch.ExemptPaths("/webhooks/*"))
+//	secfetchtest.AssertAllowed(t, p, secfetchtest.CrossSiteFormPost("/webhooks/github"))
+//	secfetchtest.AssertBlocked(t, p, secfetchtest.CrossSiteFormPost("/settings"))
+package secfetchtest
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Transport is an http.RoundTripper that adds the Fetch Metadata headers a browser would send
+// with requests issued by a page, so that protected servers can be tested end to end:
+//
+//	c := &http.Client{Transport: secfetchtest.FetchFrom("https://evil.example")}
+//	resp, err := c.Post(srv.URL+"/api", "application/json", body)
+//
+// Sec-Fetch-Site is computed from Origin and the URL of each request, like browsers do.
+// Redirects are followed by http.Client as new requests from the same page, while browsers
+// also take the previous hops into account, so requests that were redirected cross-site may
+// be reported as same-site.
+type Transport struct {
+	// Origin is the origin of the page sending the requests, e.g. "https://app.example". An
+	// empty Origin emulates requests initiated by the user, e.g. by typing a URL.
+	Origin string
+	// Mode and Dest are the values of Sec-Fetch-Mode and Sec-Fetch-Dest.
+	Mode, Dest string
+	// User reports whether navigations are triggered by a user activation.
+	User bool
+
+	// Base is the RoundTripper used to send requests. The default is http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+// FetchFrom returns a Transport emulating fetch() calls from a page on origin.
+func FetchFrom(origin string) *Transport {
+	return &Transport{Origin: origin, Mode: "cors", Dest: "empty"}
+}
+
+// NavigationFrom returns a Transport emulating navigations triggered by the user on a page on
+// origin, like following links or submitting forms.
+func NavigationFrom(origin string) *Transport {
+	return &Transport{Origin: origin, Mode: "navigate", Dest: "document", User: true}
+}
+
+// SubresourceFrom returns a Transport emulating the load of subresources for dest, e.g. "image"
+// or "script", by a page on origin.
+func SubresourceFrom(origin, dest string) *Transport {
+	return &Transport{Origin: origin, Mode: "no-cors", Dest: dest}
+}
+
+// UserInitiated returns a Transport emulating navigations initiated by the user outside of any
+// page, e.g. by typing a URL or opening a bookmark.
+func UserInitiated() *Transport {
+	return &Transport{Mode: "navigate", Dest: "document", User: true}
+}
+
+// RoundTrip sends a copy of r with the Fetch Metadata, Origin and Referer headers set.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+	r.Header.Set("Sec-Fetch-Site", Site(t.Origin, r.URL))
+	r.Header.Set("Sec-Fetch-Mode", t.Mode)
+	r.Header.Set("Sec-Fetch-Dest", t.Dest)
+	if t.User && (t.Mode == "navigate" || t.Mode == "nested-navigate") {
+		r.Header.Set("Sec-Fetch-User", "?1")
+	}
+	if t.Origin != "" {
+		// Browsers send Origin with CORS requests and all requests that are not GET or HEAD.
+		if t.Mode == "cors" || r.Method != http.MethodGet && r.Method != http.MethodHead {
+			r.Header.Set("Origin", t.Origin)
+		}
+		r.Header.Set("Referer", t.Origin+"/")
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
+
+// Site returns the Sec-Fetch-Site value browsers send with requests to u from a page on origin:
+// "none" if origin is empty, "same-origin", "same-site" or "cross-site".
+func Site(origin string, u *url.URL) string {
+	if origin == "" {
+		return "none"
+	}
+	o, err := url.Parse(origin)
+	if err != nil {
+		return "cross-site"
+	}
+	if strings.EqualFold(o.Scheme, u.Scheme) && strings.EqualFold(o.Host, u.Host) {
+		return "same-origin"
+	}
+	if strings.EqualFold(o.Scheme, u.Scheme) && strings.EqualFold(site(o.Hostname()), site(u.Hostname())) {
+		return "same-site"
+	}
+	return "cross-site"
+}
+
+// site returns the registrable domain of host.
+func site(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	d, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return d
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+)
+
+func TestSite(t *testing.T) {
+	u, _ := url.Parse("https://www.example.com/path")
+	var tests = []struct {
+		origin string
+		want   string
+	}{
+		{origin: "", want: "none"},
+		{origin: "https://www.example.com", want: "same-origin"},
+		{origin: "https://app.example.com", want: "same-site"},
+		{origin: "http://www.example.com", want: "cross-site"},
+		{origin: "https://example.org", want: "cross-site"},
+	}
+	for _, tt := range tests {
+		if got := Site(tt.origin, u); got != tt.want {
+			t.Errorf("Site(%q): got %q, want %q", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(secfetch.ProtectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer srv.Close()
+	var tests = []struct {
+		name   string
+		tr     *Transport
+		method string
+		want   int
+	}{
+		{name: "same-origin fetch", tr: FetchFrom(srv.URL), method: "POST", want: http.StatusOK},
+		{name: "cross-site fetch", tr: FetchFrom("https://evil.example"), method: "POST", want: http.StatusForbidden},
+		{name: "cross-site form post", tr: NavigationFrom("https://evil.example"), method: "POST", want: http.StatusForbidden},
+		{name: "cross-site link", tr: NavigationFrom("https://evil.example"), method: "GET", want: http.StatusOK},
+		{name: "cross-site image", tr: SubresourceFrom("https://evil.example", "image"), method: "GET", want: http.StatusForbidden},
+		{name: "user navigation", tr: UserInitiated(), method: "GET", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &http.Client{Transport: tt.tr}
+			req, err := http.NewRequest(tt.method, srv.URL+"/", strings.NewReader(""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+module github.com/empijei/go-sec-fetch/secfetchtwirp
+
+go 1.22
+
+require (
+	github.com/empijei/go-sec-fetch v0.1.0
+	github.com/twitchtv/twirp v8.1.3+incompatible
+)
+
+require (
+	github.com/pkg/errors v0.9.1 // indirect
+	go.yaml.in/yaml/v3 v3.0.5 // indirect
+	golang.org/x/net v0.35.0 // indirect
+)
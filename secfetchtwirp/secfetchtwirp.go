@@ -0,0 +1,87 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchtwirp rejects cross-site Twirp calls with secfetch policies, reporting
+// rejections as Twirp errors.
+//
+// Twirp hooks don't have access to the HTTP request, so requests are checked against the policy
+// by Handler, which must wrap the Twirp server, and the decision is applied and enforced by the
+// hooks returned by ServerHooks:
+//
+//	hooks := secfetchtwirp.ServerHooks()
+//	srv := pb.NewHaberdasherServer(impl, twirp.WithServerHooks(hooks))
+//	mux.Handle(srv.PathPrefix(), secfetchtwirp.Handler(secfetch.ResourceIsolationPolicy(), srv))
+package secfetchtwirp
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/twitchtv/twirp"
+)
+
+// RuleMetaKey is the Twirp error metadata key the rule that rejected a call is reported with.
+const RuleMetaKey = "secfetch_rule"
+
+// evaluation is the check of a request by Handler, applied by the hooks.
+type evaluation struct {
+	p *secfetch.Policy
+	w http.ResponseWriter
+	r *http.Request
+	d secfetch.Decision
+	// applied is set once the hooks applied the decision.
+	applied atomic.Bool
+}
+
+type evaluationKey struct{}
+
+// Handler checks requests against p and passes all of them to h, which must be a Twirp server
+// using ServerHooks to reject the calls p rejected.
+//
+// The decision is applied, like p.Protect does, by the hooks once the call is routed, so that the
+// reports, metrics and hooks of p only account for the calls that reach a method. Requests that
+// are not routed, e.g. because the method doesn't exist, are evaluated by Handler after h
+// returns.
+func Handler(p *secfetch.Policy, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ev := &evaluation{p: p, w: w, r: r, d: p.Check(r)}
+		ctx := context.WithValue(secfetch.NewContext(r.Context(), ev.d), evaluationKey{}, ev)
+		h.ServeHTTP(w, r.WithContext(ctx))
+		if !ev.applied.Load() {
+			p.EvaluateDecision(w, r, ev.d)
+		}
+	})
+}
+
+// ServerHooks returns hooks that reject, before the RPC method runs, the calls rejected by the
+// policy of Handler, with a twirp.PermissionDenied error carrying the rule in its RuleMetaKey
+// metadata. Calls that didn't go through Handler are rejected with a twirp.Internal error.
+func ServerHooks() *twirp.ServerHooks {
+	return &twirp.ServerHooks{
+		RequestRouted: func(ctx context.Context) (context.Context, error) {
+			ev, ok := ctx.Value(evaluationKey{}).(*evaluation)
+			if !ok {
+				return ctx, twirp.InternalError("secfetch: request was not evaluated by secfetchtwirp.Handler")
+			}
+			ev.applied.Store(true)
+			if _, reject := ev.p.EvaluateDecision(ev.w, ev.r, ev.d); !reject {
+				return ctx, nil
+			}
+			err := twirp.NewError(twirp.PermissionDenied, "Invalid resource access")
+			return ctx, err.WithMeta(RuleMetaKey, string(ev.d.Rule))
+		},
+	}
+}
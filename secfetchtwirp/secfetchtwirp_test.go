@@ -0,0 +1,87 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchtwirp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/twitchtv/twirp"
+)
+
+func TestServerHooks(t *testing.T) {
+	hooks := ServerHooks()
+	var gotErr error
+	// The fake server only runs the hook, as generated Twirp servers do after routing.
+	srv := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, gotErr = hooks.RequestRouted(r.Context())
+	})
+	h := Handler(secfetch.ResourceIsolationPolicy(), srv)
+	var tests = []struct {
+		site     string
+		wantCode twirp.ErrorCode
+		wantRule string
+	}{
+		{site: "same-origin"},
+		{site: "cross-site", wantCode: twirp.PermissionDenied, wantRule: string(secfetch.RuleCrossSiteMethod)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.site, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/twirp/pkg.Service/Method", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			var twerr twirp.Error
+			if !errors.As(gotErr, &twerr) {
+				if tt.wantCode != "" {
+					t.Fatalf("got error %v, want %s", gotErr, tt.wantCode)
+				}
+				return
+			}
+			if twerr.Code() != tt.wantCode || twerr.Meta(RuleMetaKey) != tt.wantRule {
+				t.Errorf("got %s with rule %q, want %s with rule %q", twerr.Code(), twerr.Meta(RuleMetaKey), tt.wantCode, tt.wantRule)
+			}
+		})
+	}
+
+	// Calls that bypassed Handler fail closed.
+	_, err := hooks.RequestRouted(context.Background())
+	if twerr, ok := err.(twirp.Error); !ok || twerr.Code() != twirp.Internal {
+		t.Errorf("got error %v, want an internal error", err)
+	}
+}
+
+func TestHandlerReportsOnce(t *testing.T) {
+	var blocked int
+	p := secfetch.ResourceIsolationPolicy(secfetch.OnBlock(func(*http.Request, secfetch.Decision, bool) { blocked++ }))
+	hooks := ServerHooks()
+	for _, routed := range []bool{true, false} {
+		blocked = 0
+		srv := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if routed {
+				hooks.RequestRouted(r.Context())
+			}
+		})
+		r := httptest.NewRequest("POST", "/twirp/pkg.Service/Method", nil)
+		r.Header.Set("sec-fetch-site", "cross-site")
+		Handler(p, srv).ServeHTTP(httptest.NewRecorder(), r)
+		if blocked != 1 {
+			t.Errorf("routed %v: got %d rejections, want 1", routed, blocked)
+		}
+	}
+}
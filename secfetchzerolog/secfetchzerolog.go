@@ -0,0 +1,76 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secfetchzerolog logs the requests rejected by secfetch policies with zerolog.
+//
+// Example usage:
+//
+//	l := secfetchzerolog.New(log.Logger, zerolog.WarnLevel)
+//	h := secfetch.ProtectHandler(mux, secfetch.ReportTo(l))
+//
+// Records have the same message and field names as the ones of secfetch.SlogLogger, see
+// secfetch.Report.Fields.
+package secfetchzerolog
+
+import (
+	"net/http"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/rs/zerolog"
+)
+
+// Logger is a secfetch.RequestLogger, a secfetch.ReportLogger and a secfetch.SummaryLogger that
+// emits records to a zerolog.Logger.
+type Logger struct {
+	l     zerolog.Logger
+	level zerolog.Level
+}
+
+// New returns a Logger that emits records to l at level.
+func New(l zerolog.Logger, level zerolog.Level) *Logger {
+	return &Logger{l: l, level: level}
+}
+
+// LogRequest implements secfetch.RequestLogger.
+func (l *Logger) LogRequest(r *http.Request) {
+	secfetch.LogRequestReport(l, r)
+}
+
+// LogReport implements secfetch.ReportLogger.
+func (l *Logger) LogReport(rep *secfetch.Report) {
+	e := l.l.WithLevel(l.level)
+	if e == nil {
+		return
+	}
+	for _, f := range rep.Fields() {
+		e.Str(f.Key, f.Value)
+	}
+	e.Msg(rep.Message())
+}
+
+// LogSummary implements secfetch.SummaryLogger.
+func (l *Logger) LogSummary(s *secfetch.Summary) {
+	e := l.l.WithLevel(l.level)
+	if e == nil {
+		return
+	}
+	e.Str("path", s.Path).
+		Str("method", s.Method).
+		Str("site", s.Site).
+		Str("mode", s.Mode).
+		Int("count", s.Count).
+		Time("first", s.First).
+		Time("last", s.Last).
+		Msg(secfetch.SummaryMessage)
+}
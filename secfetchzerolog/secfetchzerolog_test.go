@@ -0,0 +1,113 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetchzerolog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	secfetch "github.com/empijei/go-sec-fetch"
+	"github.com/rs/zerolog"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(zerolog.New(&buf), zerolog.WarnLevel)
+	p := secfetch.ResourceIsolationPolicy(secfetch.ReportTo(l))
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	r := httptest.NewRequest("POST", "/transfer", nil)
+	r.Header.Set("sec-fetch-site", "cross-site")
+	r.Header.Set("sec-fetch-mode", "navigate")
+	r.Header.Set("X-Request-Id", "req-1")
+	r.RemoteAddr = "192.0.2.1:1234"
+	p.Protect(noop).ServeHTTP(httptest.NewRecorder(), r)
+	p.ProtectLogOnly(noop, l).ServeHTTP(httptest.NewRecorder(), r)
+
+	var got []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec map[string]interface{}
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rec)
+	}
+	want := map[string]interface{}{
+		"level":       "warn",
+		"message":     "secfetch: request rejected by policy",
+		"path":        "/transfer",
+		"method":      "POST",
+		"site":        "cross-site",
+		"mode":        "navigate",
+		"dest":        "",
+		"remote_addr": "192.0.2.1:1234",
+		"rule":        "cross-site-method",
+		"request_id":  "req-1",
+	}
+	// The log-only handler logs both the report and the request.
+	if len(got) != 3 {
+		t.Fatalf("got %d records, want 3: %v", len(got), got)
+	}
+	if !reflect.DeepEqual(got[0], want) {
+		t.Errorf("got record %v, want %v", got[0], want)
+	}
+	want["message"] = "secfetch: request would be rejected by policy"
+	for _, rec := range got[1:] {
+		if !reflect.DeepEqual(rec, want) {
+			t.Errorf("got record %v, want %v", rec, want)
+		}
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(zerolog.New(&buf).Level(zerolog.ErrorLevel), zerolog.InfoLevel)
+	l.LogReport(&secfetch.Report{Path: "/"})
+	l.LogSummary(&secfetch.Summary{Path: "/"})
+	if buf.Len() != 0 {
+		t.Errorf("got records below the logger level: %s", buf.String())
+	}
+}
+
+func TestLogSummary(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(zerolog.New(&buf), zerolog.InfoLevel)
+	t0 := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	l.LogSummary(&secfetch.Summary{Path: "/a", Method: "POST", Site: "cross-site", Mode: "cors", Count: 3, First: t0, Last: t0.Add(time.Second)})
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"level":   "info",
+		"message": secfetch.SummaryMessage,
+		"path":    "/a",
+		"method":  "POST",
+		"site":    "cross-site",
+		"mode":    "cors",
+		"count":   float64(3),
+		"first":   t0.Format(time.RFC3339),
+		"last":    t0.Add(time.Second).Format(time.RFC3339),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got record %v, want %v", got, want)
+	}
+}
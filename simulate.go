@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+)
+
+// A RequestDescriptor describes a request to evaluate with Policy.Simulate. Its JSON encoding
+// matches the one of Report, so recorded Reports can be replayed against other policies.
+type RequestDescriptor struct {
+	// Method defaults to GET, and Path to "/".
+	Method string `json:"method"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	TLS    bool   `json:"tls,omitempty"`
+
+	// Site, Mode, Dest and User are the values of the Fetch Metadata request headers.
+	Site string `json:"site"`
+	Mode string `json:"mode"`
+	Dest string `json:"dest"`
+	User string `json:"user"`
+	// Origin, Referer and UserAgent are the values of the corresponding request headers.
+	Origin    string `json:"origin"`
+	Referer   string `json:"referer"`
+	UserAgent string `json:"user_agent"`
+
+	// Header holds additional request headers, e.g. Content-Type.
+	Header map[string]string `json:"header,omitempty"`
+}
+
+// request returns the http.Request described by rd.
+func (rd *RequestDescriptor) request() *http.Request {
+	r := &http.Request{
+		Method:     rd.Method,
+		URL:        &url.URL{Path: rd.Path},
+		Host:       rd.Host,
+		Header:     make(http.Header),
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Body:       http.NoBody,
+	}
+	if r.Method == "" {
+		r.Method = http.MethodGet
+	}
+	if r.URL.Path == "" {
+		r.URL.Path = "/"
+	}
+	r.RequestURI = r.URL.RequestURI()
+	if rd.TLS {
+		r.URL.Scheme = "https"
+		r.TLS = &tls.ConnectionState{}
+	}
+	for k, v := range map[string]string{
+		"Sec-Fetch-Site": rd.Site,
+		"Sec-Fetch-Mode": rd.Mode,
+		"Sec-Fetch-Dest": rd.Dest,
+		"Sec-Fetch-User": rd.User,
+		"Origin":         rd.Origin,
+		"Referer":        rd.Referer,
+		"User-Agent":     rd.UserAgent,
+	} {
+		if v != "" {
+			r.Header.Set(k, v)
+		}
+	}
+	for k, v := range rd.Header {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+// Simulate evaluates the described requests against p, e.g. to validate a configuration in CI
+// before deploying it, and returns their Decisions in the same order.
+//
+// Simulated requests have no side effects: they are not counted, reported or recorded as metrics.
+func (p *Policy) Simulate(requests []RequestDescriptor) []Decision {
+	ds := make([]Decision, len(requests))
+	for i := range requests {
+		ds[i] = p.Check(requests[i].request())
+	}
+	return ds
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	p := ResourceIsolationPolicy(ExemptPaths("/hooks/*"), AllowRPCOrigins("https://app.example"))
+	rds := []RequestDescriptor{
+		{Method: "POST", Path: "/transfer", Site: "cross-site", Mode: "navigate", Dest: "document"},
+		{Method: "POST", Path: "/hooks/github", Site: "cross-site", Mode: "cors"},
+		{Path: "/", Site: "none", Mode: "navigate", Dest: "document", User: "?1"},
+		{},
+		{
+			Method: "POST", Path: "/rpc", Site: "cross-site", Mode: "cors", Dest: "empty", Origin: "https://app.example",
+			Header: map[string]string{"Content-Type": "application/grpc-web"},
+		},
+		{Method: "POST", Host: "example.com", Site: "cross-site", Referer: "https://example.com/"},
+	}
+	want := []Decision{
+		{Allowed: false, Rule: RuleCrossSiteMethod},
+		{Allowed: true, Rule: RuleExempt},
+		{Allowed: true, Rule: RuleTrustedSite},
+		{Allowed: true, Rule: RuleMissingMetadata},
+		{Allowed: true, Rule: RuleRPCOrigin},
+		{Allowed: false, Rule: RuleCrossSiteMethod},
+	}
+	got := p.Simulate(rds)
+	if len(got) != len(want) {
+		t.Fatalf("got %d decisions, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Allowed != want[i].Allowed || got[i].Rule != want[i].Rule {
+			t.Errorf("request %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+	if n := p.stats.counts[Enforce][0].Load() + p.stats.counts[Enforce][1].Load(); n != 0 {
+		t.Errorf("simulated requests were counted: %d", n)
+	}
+}
+
+func TestSimulateReports(t *testing.T) {
+	// Reports of a log-only rollout can be replayed against a candidate configuration.
+	var rl testReportLogger
+	h := ResourceIsolationPolicy(ReportTo(&rl)).ProtectLogOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), nil)
+	r := httptest.NewRequest("POST", "/hooks/github", nil)
+	r.Header.Set("sec-fetch-site", "cross-site")
+	r.Header.Set("sec-fetch-mode", "cors")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	b, err := json.Marshal(rl.reps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rds []RequestDescriptor
+	if err := json.Unmarshal(b, &rds); err != nil {
+		t.Fatal(err)
+	}
+	got := ResourceIsolationPolicy(ExemptPaths("/hooks/*")).Simulate(rds)
+	if len(got) != 1 || got[0].Rule != RuleExempt {
+		t.Errorf("got %v, want one exempt decision", got)
+	}
+}
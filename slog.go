@@ -0,0 +1,87 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// SlogLogger is a RequestLogger, a ReportLogger and a SummaryLogger that emits structured
+// records to a slog.Logger.
+//
+// Records carry the path, method, Fetch Metadata, remote address and, when available, the rule
+// that rejected the request.
+type SlogLogger struct {
+	// Logger is the logger records are emitted to. If nil, slog.Default() is used.
+	Logger *slog.Logger
+	// Level is the level records are emitted at. The zero value is slog.LevelInfo.
+	Level slog.Level
+}
+
+func (l *SlogLogger) logger() *slog.Logger {
+	if l.Logger == nil {
+		return slog.Default()
+	}
+	return l.Logger
+}
+
+// LogRequest implements RequestLogger.
+func (l *SlogLogger) LogRequest(r *http.Request) {
+	ctx := r.Context()
+	if !l.logger().Enabled(ctx, l.Level) {
+		return
+	}
+	d, _ := FromContext(ctx)
+	rep := getReport(r, d, false)
+	l.log(ctx, rep)
+	putReport(rep)
+}
+
+// LogReport implements ReportLogger.
+func (l *SlogLogger) LogReport(rep *Report) {
+	ctx := context.Background()
+	if !l.logger().Enabled(ctx, l.Level) {
+		return
+	}
+	l.log(ctx, rep)
+}
+
+func (l *SlogLogger) log(ctx context.Context, rep *Report) {
+	fields := rep.Fields()
+	attrs := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		attrs[i] = slog.String(f.Key, f.Value)
+	}
+	l.logger().LogAttrs(ctx, l.Level, rep.Message(), attrs...)
+}
+
+// LogSummary implements SummaryLogger.
+func (l *SlogLogger) LogSummary(s *Summary) {
+	ctx := context.Background()
+	if !l.logger().Enabled(ctx, l.Level) {
+		return
+	}
+	l.logger().LogAttrs(ctx, l.Level, SummaryMessage,
+		slog.String("path", s.Path),
+		slog.String("method", s.Method),
+		slog.String("site", s.Site),
+		slog.String("mode", s.Mode),
+		slog.Int("count", s.Count),
+		slog.Time("first", s.First),
+		slog.Time("last", s.Last),
+	)
+}
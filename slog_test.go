@@ -0,0 +1,88 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := &SlogLogger{
+		Logger: slog.New(slog.NewJSONHandler(&buf, nil)),
+		Level:  slog.LevelWarn,
+	}
+	h := ProtectHandlerLogOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), l)
+	r := httptest.NewRequest("POST", "/account", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("sec-fetch-site", "cross-site")
+	r.Header.Set("sec-fetch-mode", "navigate")
+	r.Header.Set("sec-fetch-dest", "document")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("cannot decode record %q: %v", buf.String(), err)
+	}
+	want := map[string]string{
+		"level":       "WARN",
+		"msg":         "secfetch: request would be rejected by policy",
+		"path":        "/account",
+		"method":      "POST",
+		"site":        "cross-site",
+		"mode":        "navigate",
+		"dest":        "document",
+		"remote_addr": "192.0.2.1:1234",
+		"rule":        "cross-site-method",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %v, want %q", k, got[k], v)
+		}
+	}
+
+	buf.Reset()
+	l.Level = slog.LevelDebug
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if buf.Len() != 0 {
+		t.Errorf("got record %q for a disabled level", buf.String())
+	}
+}
+
+func TestSlogLoggerReport(t *testing.T) {
+	var buf bytes.Buffer
+	l := &SlogLogger{Logger: slog.New(slog.NewJSONHandler(&buf, nil))}
+	l.LogReport(&Report{Enforced: true, Rule: RuleFraming, Method: "GET", Path: "/", Site: "cross-site", Dest: "iframe"})
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("cannot decode record %q: %v", buf.String(), err)
+	}
+	want := map[string]string{
+		"level": "INFO",
+		"msg":   "secfetch: request rejected by policy",
+		"rule":  "framing",
+		"dest":  "iframe",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %v, want %q", k, got[k], v)
+		}
+	}
+}
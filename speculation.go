@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// A SpeculationAction is how a policy treats speculative requests, i.e. the prefetches and
+// prerenders that browsers send, with the Sec-Purpose header, before users navigate.
+type SpeculationAction int
+
+// Speculation actions.
+const (
+	// SpeculationAllow evaluates speculative requests like the other ones.
+	SpeculationAllow SpeculationAction = iota
+	// SpeculationDeny rejects all speculative requests.
+	SpeculationDeny
+	// SpeculationMark evaluates speculative requests like the other ones, and marks the ones
+	// that are served, allowed or rejected in LogOnly mode, so handlers can skip side effects, see
+	// IsSpeculative.
+	SpeculationMark
+	// SpeculationLogOnly evaluates speculative requests in LogOnly mode, so that they are only
+	// reported instead of rejected, and marks them like SpeculationMark.
+	SpeculationLogOnly
+)
+
+func (a SpeculationAction) String() string {
+	switch a {
+	case SpeculationAllow:
+		return "allow"
+	case SpeculationDeny:
+		return "deny"
+	case SpeculationMark:
+		return "mark"
+	case SpeculationLogOnly:
+		return "log-only"
+	}
+	return "unknown"
+}
+
+// Speculation sets how the policy treats speculative requests. The default is SpeculationAllow.
+//
+// Prerendered pages are fully loaded, including their subresources and scripts, before users
+// navigate to them, so their requests may change state unexpectedly. Rejected speculative
+// requests are reported with RuleSpeculative.
+func Speculation(a SpeculationAction) Option {
+	return func(p *Policy) {
+		p.speculation = a
+	}
+}
+
+// isSpeculative reports whether r is a prefetch or a prerender.
+func isSpeculative(r *http.Request) bool {
+	v := r.Header.Get("Sec-Purpose")
+	if v == "" {
+		// Sent by older browsers.
+		v = r.Header.Get("Purpose")
+	}
+	return strings.HasPrefix(v, "prefetch") || strings.Contains(v, "prerender")
+}
+
+func (p *Policy) checkSpeculative(r *http.Request, d *Decision) (Rule, bool) {
+	if p.speculation == SpeculationDeny && isSpeculative(r) {
+		return RuleSpeculative, false
+	}
+	return "", true
+}
+
+type speculativeKey struct{}
+
+// IsSpeculative reports whether ctx belongs to a speculative request marked by a policy that uses
+// SpeculationMark or SpeculationLogOnly.
+func IsSpeculative(ctx context.Context) bool {
+	return ctx.Value(speculativeKey{}) != nil
+}
+
+// markSpeculative returns r, which is about to be served, marked as speculative if p requires it.
+func (p *Policy) markSpeculative(r *http.Request) *http.Request {
+	if p.speculation != SpeculationMark && p.speculation != SpeculationLogOnly || !isSpeculative(r) {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), speculativeKey{}, true))
+}
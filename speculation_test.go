@@ -0,0 +1,80 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpeculation(t *testing.T) {
+	var tests = []struct {
+		name          string
+		action        SpeculationAction
+		site, purpose string
+		legacy        bool
+		logOnly       bool
+		wantStatus    int
+		wantMarked    bool
+		wantHeader    string
+	}{
+		{name: "allow prerender", action: SpeculationAllow, site: "same-origin", purpose: "prefetch;prerender", wantStatus: http.StatusOK},
+		{name: "deny prefetch", action: SpeculationDeny, site: "same-origin", purpose: "prefetch", wantStatus: http.StatusForbidden, wantHeader: "blocked; rule=speculative"},
+		{name: "deny legacy purpose", action: SpeculationDeny, site: "same-origin", purpose: "prefetch", legacy: true, wantStatus: http.StatusForbidden},
+		{name: "deny regular", action: SpeculationDeny, site: "same-origin", wantStatus: http.StatusOK},
+		{name: "mark prerender", action: SpeculationMark, site: "same-origin", purpose: "prefetch;prerender", wantStatus: http.StatusOK, wantMarked: true},
+		{name: "mark regular", action: SpeculationMark, site: "same-origin", wantStatus: http.StatusOK},
+		{name: "mark rejected", action: SpeculationMark, site: "cross-site", purpose: "prefetch", wantStatus: http.StatusForbidden},
+		{name: "mark log-only rejected", action: SpeculationMark, site: "cross-site", purpose: "prefetch", logOnly: true, wantStatus: http.StatusOK, wantMarked: true},
+		{name: "mark log-only regular", action: SpeculationMark, site: "cross-site", logOnly: true, wantStatus: http.StatusOK},
+		{name: "log only prefetch", action: SpeculationLogOnly, site: "cross-site", purpose: "prefetch", wantStatus: http.StatusOK, wantMarked: true, wantHeader: "would-block; rule=cross-site-method"},
+		{name: "log only allowed prefetch", action: SpeculationLogOnly, site: "same-origin", purpose: "prefetch", wantStatus: http.StatusOK, wantMarked: true},
+		{name: "log only regular", action: SpeculationLogOnly, site: "cross-site", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := ResourceIsolationPolicy(Speculation(tt.action), DebugHeader())
+			var marked bool
+			var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				marked = IsSpeculative(r.Context())
+			})
+			if tt.logOnly {
+				h = p.ProtectLogOnly(h, nil)
+			} else {
+				h = p.Protect(h)
+			}
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("sec-fetch-site", tt.site)
+			switch {
+			case tt.legacy:
+				r.Header.Set("purpose", tt.purpose)
+			case tt.purpose != "":
+				r.Header.Set("sec-purpose", tt.purpose)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if marked != tt.wantMarked {
+				t.Errorf("got marked %v, want %v", marked, tt.wantMarked)
+			}
+			if got := w.Header().Get("X-SecFetch-Decision"); tt.wantHeader != "" && got != tt.wantHeader {
+				t.Errorf("got debug header %q, want %q", got, tt.wantHeader)
+			}
+		})
+	}
+}
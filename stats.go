@@ -0,0 +1,286 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// recentReports is the number of rejected requests kept by a policy for StatsHandler.
+const recentReports = 50
+
+// stats holds the statistics served by StatsHandler.
+type stats struct {
+	// counts is indexed by Mode, except Off, and then by outcome: allowed, rejected.
+	counts [Off][2]atomic.Uint64
+	used   [Off]atomic.Uint32
+	// coverage is indexed by User-Agent family, and then by whether requests carried Fetch
+	// Metadata: with, without.
+	coverage [numUAFamilies][2]atomic.Uint64
+	// anonymize is set by AnonymizeReports.
+	anonymize bool
+	// enabled is set once StatsHandler is called: until then, requests are not recorded.
+	enabled atomic.Bool
+
+	mu     sync.Mutex
+	recent []Report
+	next   int
+}
+
+func (s *stats) record(r *http.Request, d Decision, m Mode) {
+	if !s.enabled.Load() {
+		return
+	}
+	i := 0
+	if !d.Allowed {
+		i = 1
+	}
+	if s.used[m].Load() == 0 {
+		s.used[m].Store(1)
+	}
+	s.counts[m][i].Add(1)
+	j := 0
+	if d.Site == "" {
+		j = 1
+	}
+	s.coverage[classifyUserAgent(r.Header.Get("User-Agent"))][j].Add(1)
+	if d.Allowed {
+		return
+	}
+	var rep Report
+	rep.fill(r, d, m == Enforce)
+	if s.anonymize {
+		rep.anonymize()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.recent) < recentReports {
+		s.recent = append(s.recent, rep)
+		return
+	}
+	s.recent[s.next] = rep
+	s.next = (s.next + 1) % recentReports
+}
+
+type statsResponse struct {
+	Modes    []string                      `json:"modes"`
+	Counters map[string]map[Outcome]uint64 `json:"counters"`
+	Policy   policyDescription             `json:"policy"`
+	Coverage []headerCoverage              `json:"header_coverage"`
+	Recent   []Report                      `json:"recent"`
+}
+
+// headerCoverage counts the requests of a User-Agent family by presence of Fetch Metadata.
+type headerCoverage struct {
+	Family          string `json:"user_agent_family"`
+	WithMetadata    uint64 `json:"with_metadata"`
+	WithoutMetadata uint64 `json:"without_metadata"`
+}
+
+// headerCoverage returns the families that sent requests, the ones that sent most requests
+// without Fetch Metadata first.
+func (s *stats) headerCoverage() []headerCoverage {
+	hc := []headerCoverage{}
+	for f := range s.coverage {
+		c := headerCoverage{
+			Family:          uaFamilies[f],
+			WithMetadata:    s.coverage[f][0].Load(),
+			WithoutMetadata: s.coverage[f][1].Load(),
+		}
+		if c.WithMetadata != 0 || c.WithoutMetadata != 0 {
+			hc = append(hc, c)
+		}
+	}
+	sort.SliceStable(hc, func(i, j int) bool {
+		if hc[i].WithoutMetadata != hc[j].WithoutMetadata {
+			return hc[i].WithoutMetadata > hc[j].WithoutMetadata
+		}
+		return hc[i].WithMetadata > hc[j].WithMetadata
+	})
+	return hc
+}
+
+// policyDescription describes the configuration of a Policy.
+type policyDescription struct {
+	Mode                  string   `json:"mode"`
+	CustomDecider         bool     `json:"custom_decider,omitempty"`
+	EnforcedCohort        *int     `json:"enforced_cohort_percent,omitempty"`
+	CrossSiteDestinations []string `json:"cross_site_destinations"`
+	RequireUserActivation bool     `json:"require_user_activation"`
+	AllowedOrigins        []string `json:"allowed_origins,omitempty"`
+	AllowedOriginFuncs    int      `json:"allowed_origin_funcs,omitempty"`
+	AllowedRPCOrigins     []string `json:"allowed_rpc_origins,omitempty"`
+	AllowedWSOrigins      []string `json:"allowed_websocket_origins,omitempty"`
+	CORSPreflights        bool     `json:"cors_preflights"`
+	FramingIsolation      string   `json:"framing_isolation"`
+	FramingPaths          []string `json:"framing_allowed_paths,omitempty"`
+	ImageHotlinking       string   `json:"image_hotlinking"`
+	ScriptInclusion       bool     `json:"block_script_inclusion"`
+	EmbeddableDests       bool     `json:"block_embeddable_destinations"`
+	FencedFrames          bool     `json:"block_fenced_frames"`
+	SameOriginOnly        bool     `json:"same_origin_only"`
+	SameOriginOnlyPaths   []string `json:"same_origin_only_paths,omitempty"`
+	UntrustedSubdomains   []string `json:"untrusted_subdomains,omitempty"`
+	RejectMalformed       bool     `json:"reject_malformed_metadata"`
+	Speculation           string   `json:"speculation"`
+	RejectMissingMetadata bool     `json:"reject_missing_metadata"`
+	MissingMetadataPaths  []string `json:"missing_metadata_paths,omitempty"`
+	MissingMetadataAgents []string `json:"missing_metadata_user_agents,omitempty"`
+	RefererFallback       string   `json:"referer_fallback"`
+	Exemptions            []string `json:"exemptions,omitempty"`
+	Routes                []string `json:"routes,omitempty"`
+	Deny                  string   `json:"deny"`
+	DenyRedirect          string   `json:"deny_redirect,omitempty"`
+	DenyTemplate          string   `json:"deny_template,omitempty"`
+	DenyLocalized         bool     `json:"deny_localized,omitempty"`
+	Tarpit                string   `json:"tarpit,omitempty"`
+	Vary                  bool     `json:"vary"`
+	DebugHeader           bool     `json:"debug_header"`
+	CorrelateRequests     bool     `json:"correlate_requests"`
+	CaptureBody           int      `json:"capture_body_bytes,omitempty"`
+	RedactedHeaders       []string `json:"redacted_headers,omitempty"`
+	AnonymizeReports      bool     `json:"anonymize_reports,omitempty"`
+	BlockRateAlerts       []string `json:"block_rate_alerts,omitempty"`
+}
+
+func (p *Policy) describe() policyDescription {
+	pd := policyDescription{
+		Mode:                  p.Mode().String(),
+		CustomDecider:         p.decider != nil,
+		CrossSiteDestinations: keys(p.crossSiteDests),
+		RequireUserActivation: p.requireUser,
+		AllowedOrigins:        keys(p.origins),
+		AllowedOriginFuncs:    len(p.originFuncs),
+		AllowedRPCOrigins:     keys(p.rpcOrigins),
+		AllowedWSOrigins:      keys(p.wsOrigins),
+		CORSPreflights:        p.preflights,
+		FramingIsolation:      [...]string{"off", "cross-site", "same-site"}[p.framing],
+		ScriptInclusion:       p.blockedDests["script"].rule == RuleScriptInclusion,
+		EmbeddableDests:       p.blockedDests["object"].rule == RuleEmbeddableDestination,
+		FencedFrames:          p.blockedDests["fencedframe"].rule == RuleFencedFrame,
+		FramingPaths:          p.framingDesc,
+		SameOriginOnly:        p.sameOrigin,
+		SameOriginOnlyPaths:   p.sameOriginDesc,
+		UntrustedSubdomains:   p.untrustedHosts,
+		RejectMalformed:       p.rejectMalformed,
+		Speculation:           p.speculation.String(),
+		RejectMissingMetadata: p.strict,
+		MissingMetadataPaths:  p.strictPaths,
+		MissingMetadataAgents: p.strictUserAgents,
+		RefererFallback:       [...]string{"off", "enforce", "log-only"}[p.referer],
+		Deny:                  p.denyDesc,
+		DenyRedirect:          p.denyRedirect,
+		DenyLocalized:         p.messages != nil,
+		Vary:                  !p.noVary,
+		DebugHeader:           p.debugHeader,
+		CorrelateRequests:     p.correlate,
+		CaptureBody:           p.captureBody,
+		RedactedHeaders:       p.redacted,
+		AnonymizeReports:      p.anonymize,
+	}
+	switch {
+	case p.hotlinkImage != nil:
+		pd.ImageHotlinking = "placeholder " + p.hotlinkType
+	case p.blockedDests["image"].rule == RuleImageHotlink:
+		pd.ImageHotlinking = "block"
+	default:
+		pd.ImageHotlinking = "off"
+	}
+	if pd.Deny == "" {
+		pd.Deny = "default"
+	}
+	if p.tarpit != nil {
+		pd.Tarpit = p.tarpit.String()
+	}
+	if p.denyTemplate != nil {
+		pd.DenyTemplate = p.denyTemplate.Name()
+	}
+	for _, e := range p.exemptions {
+		pd.Exemptions = append(pd.Exemptions, e.desc)
+	}
+	for _, rr := range p.routes {
+		pd.Routes = append(pd.Routes, rr.desc)
+	}
+	if p.cohortKey != nil {
+		pd.EnforcedCohort = &p.cohortPercent
+	}
+	for _, br := range p.blockRates {
+		pd.BlockRateAlerts = append(pd.BlockRateAlerts, br.String())
+	}
+	return pd
+}
+
+func keys(m map[string]bool) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+// StatsHandler returns a handler that serves, as JSON, the number of requests evaluated by p
+// by enforcement mode and outcome, the configuration of p, the number of requests with and
+// without Fetch Metadata by User-Agent family, see UserAgentFamily, and the most recent requests
+// p rejected.
+//
+// Statistics are only collected once StatsHandler has been called, so that policies that don't
+// serve them don't pay for classifying the User-Agent of every request: the handler should be
+// created along with the protected handlers, and only counts the requests evaluated since then.
+//
+// The response discloses the policy and details of the rejected requests, so the handler must
+// only be served to administrators, e.g. on an internal port.
+func (p *Policy) StatsHandler() http.Handler {
+	p.stats.enabled.Store(true)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &p.stats
+		resp := statsResponse{
+			Modes:    []string{},
+			Counters: map[string]map[Outcome]uint64{},
+			Policy:   p.describe(),
+			Coverage: s.headerCoverage(),
+		}
+		for _, m := range [...]Mode{Enforce, LogOnly, Disabled} {
+			if s.used[m].Load() != 0 {
+				resp.Modes = append(resp.Modes, m.String())
+			}
+			rejected := OutcomeBlocked
+			if m != Enforce {
+				rejected = OutcomeWouldBlock
+			}
+			resp.Counters[m.String()] = map[Outcome]uint64{
+				OutcomeAllowed: s.counts[m][0].Load(),
+				rejected:       s.counts[m][1].Load(),
+			}
+		}
+		s.mu.Lock()
+		// Serve the most recent reports first.
+		resp.Recent = make([]Report, 0, len(s.recent))
+		for i := len(s.recent) - 1; i >= 0; i-- {
+			resp.Recent = append(resp.Recent, s.recent[(s.next+i)%len(s.recent)])
+		}
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(resp)
+	})
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestStatsHandler(t *testing.T) {
+	p := ResourceIsolationPolicy(
+		FramingIsolation(),
+		ExemptPaths("/public/*"),
+		DenyStatus(http.StatusNotFound),
+		AllowOrigins("https://partner.example"),
+	)
+	sh := p.StatsHandler()
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	enforce := p.Protect(noop)
+	send := func(h http.Handler, path, site string) {
+		r := httptest.NewRequest("POST", path, nil)
+		r.Header.Set("sec-fetch-site", site)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	send(enforce, "/", "same-origin")
+	send(enforce, "/public/a", "cross-site")
+	for i := 0; i < recentReports+5; i++ {
+		send(enforce, fmt.Sprintf("/%d", i), "cross-site")
+	}
+
+	w := httptest.NewRecorder()
+	sh.ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q", got)
+	}
+	var got struct {
+		Modes    []string
+		Counters map[string]map[string]uint64
+		Policy   map[string]interface{}
+		Recent   []Report
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("cannot decode %q: %v", w.Body.String(), err)
+	}
+	if want := []string{"enforce"}; !reflect.DeepEqual(got.Modes, want) {
+		t.Errorf("modes: got %v, want %v", got.Modes, want)
+	}
+	wantCounters := map[string]map[string]uint64{
+		"enforce":  {"allowed": 2, "blocked": recentReports + 5},
+		"log-only": {"allowed": 0, "would-block": 0},
+		"disabled": {"allowed": 0, "would-block": 0},
+	}
+	if !reflect.DeepEqual(got.Counters, wantCounters) {
+		t.Errorf("counters: got %v, want %v", got.Counters, wantCounters)
+	}
+	wantPolicy := map[string]interface{}{
+		"mode":              "enforce",
+		"framing_isolation": "cross-site",
+		"deny":              "status 404",
+		"exemptions":        []interface{}{"paths /public/*"},
+		"allowed_origins":   []interface{}{"https://partner.example"},
+	}
+	for k, v := range wantPolicy {
+		if !reflect.DeepEqual(got.Policy[k], v) {
+			t.Errorf("policy %s: got %v, want %v", k, got.Policy[k], v)
+		}
+	}
+	if len(got.Recent) != recentReports {
+		t.Fatalf("got %d recent reports, want %d", len(got.Recent), recentReports)
+	}
+	for i, rep := range got.Recent {
+		if want := fmt.Sprintf("/%d", recentReports+4-i); rep.Path != want || !rep.Enforced {
+			t.Errorf("recent report %d: got %+v, want path %q", i, rep, want)
+		}
+	}
+}
+
+func TestStatsHeaderCoverage(t *testing.T) {
+	p := ResourceIsolationPolicy()
+	sh := p.StatsHandler()
+	h := p.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	send := func(ua, site string) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", ua)
+		r.Header.Set("Sec-Fetch-Site", site)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	const firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+	send(firefox, "same-origin")
+	send(firefox, "cross-site")
+	send(firefox, "")
+	send("curl/8.5.0", "")
+	send("curl/8.5.0", "")
+	send("", "")
+
+	w := httptest.NewRecorder()
+	sh.ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	var got struct {
+		Coverage []headerCoverage `json:"header_coverage"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("cannot decode %q: %v", w.Body.String(), err)
+	}
+	want := []headerCoverage{
+		{Family: "cli", WithoutMetadata: 2},
+		{Family: "firefox", WithMetadata: 2, WithoutMetadata: 1},
+		{Family: "none", WithoutMetadata: 1},
+	}
+	if !reflect.DeepEqual(got.Coverage, want) {
+		t.Errorf("got coverage %+v, want %+v", got.Coverage, want)
+	}
+}
+
+func TestStatsDisabled(t *testing.T) {
+	p := ResourceIsolationPolicy()
+	h := p.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if n := p.stats.counts[Enforce][1].Load(); n != 0 || len(p.stats.recent) != 0 {
+		t.Errorf("got %d rejected requests and %d reports before StatsHandler was called", n, len(p.stats.recent))
+	}
+	sh := p.StatsHandler()
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	w := httptest.NewRecorder()
+	sh.ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	var got statsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if n := got.Counters["enforce"][OutcomeBlocked]; n != 1 || len(got.Recent) != 1 {
+		t.Errorf("got %d rejected requests and %d reports, want 1", n, len(got.Recent))
+	}
+}
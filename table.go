@@ -0,0 +1,182 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import "net/http"
+
+// A decisionTable holds the decisions for cross-site requests that only depend on their Fetch
+// Metadata and method, precomputed when the policy is built so that they are looked up rather
+// than evaluated for every request.
+//
+// Entries are indexed by mode, destination, method class (GET and HEAD, or any other method) and
+// user activation. Modes and destinations that are not known to the table share the index 0.
+type decisionTable struct {
+	modes, dests map[string]int
+	entries      []tableEntry
+}
+
+type tableEntry struct {
+	rule    Rule
+	allowed bool
+}
+
+// unknownValue stands for the modes and destinations that are not known to decision tables.
+// Header values cannot contain NUL bytes, so it cannot collide with an actual value.
+const unknownValue = "\x00"
+
+// buildTable precomputes the decisions of p for cross-site requests.
+func (p *Policy) buildTable() {
+	t := &decisionTable{modes: map[string]int{}, dests: map[string]int{}}
+	for _, m := range append(keys(knownModes), "") {
+		t.modes[m] = len(t.modes) + 1
+	}
+	// CrossSiteDestinations accepts arbitrary values, which must not be classified as unknown.
+	for _, d := range append(append(keys(knownDests), ""), keys(p.crossSiteDests)...) {
+		if _, ok := t.dests[d]; !ok {
+			t.dests[d] = len(t.dests) + 1
+		}
+	}
+	t.entries = make([]tableEntry, (len(t.modes)+1)*(len(t.dests)+1)*2*2)
+	for mode := range withUnknown(t.modes) {
+		for dest := range withUnknown(t.dests) {
+			for _, method := range [...]string{http.MethodGet, http.MethodPost} {
+				for _, user := range [...]string{"", "?1"} {
+					d := Decision{Mode: mode, Dest: dest, User: user}
+					rule, allowed := p.crossSiteRule(method, &d)
+					t.entries[t.index(&d, method)] = tableEntry{rule, allowed}
+				}
+			}
+		}
+	}
+	p.table = t
+}
+
+// withUnknown returns the keys of index and unknownValue.
+func withUnknown(index map[string]int) map[string]bool {
+	vs := map[string]bool{unknownValue: true}
+	for v := range index {
+		vs[v] = true
+	}
+	return vs
+}
+
+// index returns the index of the entry for d and method.
+func (t *decisionTable) index(d *Decision, method string) int {
+	i := t.modes[d.Mode]*(len(t.dests)+1) + t.dests[d.Dest]
+	i *= 2
+	if method != http.MethodGet && method != http.MethodHead {
+		i++
+	}
+	i *= 2
+	if d.User == "?1" {
+		i++
+	}
+	return i
+}
+
+// lookupCrossSite returns the decision of p for a cross-site request with d and method that was
+// not allowed by any of the options that depend on the rest of the request.
+func (p *Policy) lookupCrossSite(method string, d *Decision) (Rule, bool) {
+	if p.table == nil {
+		return p.crossSiteRule(method, d)
+	}
+	e := p.table.entries[p.table.index(d, method)]
+	return e.rule, e.allowed
+}
+
+// A TableEntry is the decision a policy takes on requests with the given Fetch Metadata and
+// method. Method is either GET, which stands for GET and HEAD requests, or POST, which stands for
+// requests with any other method.
+type TableEntry struct {
+	Site    string `json:"site"`
+	Mode    string `json:"mode"`
+	Dest    string `json:"dest"`
+	User    string `json:"user"`
+	Method  string `json:"method"`
+	Rule    Rule   `json:"rule"`
+	Allowed bool   `json:"allowed"`
+}
+
+// DecisionTable returns the decisions p takes on requests based on their Fetch Metadata and
+// method alone, for every combination of the values defined by the Fetch Metadata specification,
+// the empty value, and the destinations passed to CrossSiteDestinations. User activation is only
+// listed for navigations. The table can be stored and compared across policy changes, e.g. to
+// audit their effect before deploying them.
+//
+// The decisions do not account for the options that depend on the rest of requests, which take
+// precedence over the table: exemptions, route rules and presets, allowed origins, CORS
+// preflights, WebSocket origins, the paths passed to AllowFramingPaths, SameOriginOnlyPaths and
+// AllowMissingMetadataPaths, and the checks of RejectMalformedMetadata, Speculation and
+// RefererFallback.
+//
+// If p uses a custom Decider, see UseDecider, the entries are the decisions of the Decider on
+// requests for "/" that only carry the Fetch Metadata headers of the entry.
+func (p *Policy) DecisionTable() []TableEntry {
+	var es []TableEntry
+	for _, site := range append([]string{""}, keys(knownSites)...) {
+		for _, mode := range append([]string{""}, keys(knownModes)...) {
+			users := []string{""}
+			if isNavigation(mode) {
+				users = append(users, "?1")
+			}
+			dests := map[string]bool{"": true}
+			for _, ds := range []map[string]bool{knownDests, p.crossSiteDests} {
+				for d := range ds {
+					dests[d] = true
+				}
+			}
+			for _, dest := range keys(dests) {
+				for _, user := range users {
+					for _, method := range [...]string{http.MethodGet, http.MethodPost} {
+						d := Decision{Site: site, Mode: mode, Dest: dest, User: user}
+						rule, allowed := p.headerRule(method, &d)
+						es = append(es, TableEntry{site, mode, dest, user, method, rule, allowed})
+					}
+				}
+			}
+		}
+	}
+	return es
+}
+
+// headerRule decides on requests with d and method like decide, skipping the options that
+// depend on the rest of the request.
+func (p *Policy) headerRule(method string, d *Decision) (Rule, bool) {
+	if p.decider != nil {
+		r, _ := http.NewRequest(method, "/", http.NoBody)
+		for h, v := range map[string]string{
+			"Sec-Fetch-Site": d.Site, "Sec-Fetch-Mode": d.Mode, "Sec-Fetch-Dest": d.Dest, "Sec-Fetch-User": d.User,
+		} {
+			if v != "" {
+				r.Header.Set(h, v)
+			}
+		}
+		cd := p.decider.Decide(r)
+		return cd.Rule, cd.Allowed
+	}
+	if rule, ok := p.checkBlockedDest(d); ok {
+		return rule, false
+	}
+	if d.Site == "" {
+		return RuleMissingMetadata, !p.strict
+	}
+	if p.framingRejected(d) {
+		return RuleFraming, false
+	}
+	if d.Site == "same-origin" || d.Site == "none" || d.Site == "same-site" && !p.sameOrigin {
+		return RuleTrustedSite, true
+	}
+	return p.lookupCrossSite(method, d)
+}
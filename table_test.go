@@ -0,0 +1,90 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecisionTable(t *testing.T) {
+	var policies = []struct {
+		name string
+		opts []Option
+	}{
+		{name: "default"},
+		{name: "user activation", opts: []Option{RequireUserActivation()}},
+		{name: "destinations", opts: []Option{CrossSiteDestinations("image", "script", "custom")}},
+		{name: "blocked destinations", opts: []Option{BlockScriptInclusion(), BlockEmbeddableDestinations()}},
+		{name: "framing", opts: []Option{SameSiteFramingIsolation()}},
+		{name: "same-origin", opts: []Option{SameOriginOnly(), RejectMissingMetadata()}},
+	}
+	for _, pp := range policies {
+		t.Run(pp.name, func(t *testing.T) {
+			p := ResourceIsolationPolicy(pp.opts...)
+			table := p.DecisionTable()
+			if len(table) == 0 {
+				t.Fatal("empty table")
+			}
+			// Without options that depend on the rest of requests, the table must agree with
+			// the decisions taken on actual requests.
+			for _, e := range table {
+				r := httptest.NewRequest(e.Method, "/", nil)
+				for h, v := range map[string]string{
+					"Sec-Fetch-Site": e.Site, "Sec-Fetch-Mode": e.Mode, "Sec-Fetch-Dest": e.Dest, "Sec-Fetch-User": e.User,
+				} {
+					if v != "" {
+						r.Header.Set(h, v)
+					}
+				}
+				if d := p.Check(r); d.Rule != e.Rule || d.Allowed != e.Allowed {
+					t.Errorf("%+v: Check got %v", e, d)
+				}
+			}
+		})
+	}
+}
+
+func TestDecisionTableUnknownValues(t *testing.T) {
+	p := ResourceIsolationPolicy(CrossSiteDestinations("image", "custom"), RequireUserActivation())
+	for _, mode := range []string{"", "navigate", "no-cors", "bogus"} {
+		for _, dest := range []string{"", "document", "image", "custom", "script", "bogus", unknownValue} {
+			for _, method := range []string{"GET", "HEAD", "POST", "OPTIONS", "BREW"} {
+				for _, user := range []string{"", "?1", "?0"} {
+					d := Decision{Site: "cross-site", Mode: mode, Dest: dest, User: user}
+					gotRule, gotAllowed := p.lookupCrossSite(method, &d)
+					wantRule, wantAllowed := p.crossSiteRule(method, &d)
+					if gotRule != wantRule || gotAllowed != wantAllowed {
+						t.Errorf("%s %+v: got %v %v, want %v %v", method, d, gotRule, gotAllowed, wantRule, wantAllowed)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDecisionTableDecider(t *testing.T) {
+	p := ResourceIsolationPolicy(UseDecider(ResourceIsolationPolicy(SameOriginOnly())))
+	want := ResourceIsolationPolicy(SameOriginOnly()).DecisionTable()
+	got := p.DecisionTable()
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("got %+v, want %+v", got[i], want[i])
+		}
+	}
+}
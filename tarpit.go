@@ -0,0 +1,72 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// Tarpit makes the policy wait a random delay between minDelay and maxDelay before responding
+// to rejected requests, to slow down automated cross-site probing. Allowed requests are never
+// delayed.
+//
+// The wait ends early if the request is canceled, e.g. because the client went away. To bound
+// the connections and goroutines held by slow responses, at most maxConcurrent rejected requests
+// are delayed at any time, and further ones are responded to immediately.
+//
+// The delay is applied by ServeDenied, so it also applies to frameworks using Evaluate. Tarpit
+// panics if minDelay is negative, maxDelay is less than minDelay, or maxConcurrent is not
+// positive.
+func Tarpit(minDelay, maxDelay time.Duration, maxConcurrent int) Option {
+	if minDelay < 0 || maxDelay < minDelay || maxConcurrent <= 0 {
+		panic(fmt.Sprintf("secfetch: invalid tarpit %v-%v with %d concurrent requests", minDelay, maxDelay, maxConcurrent))
+	}
+	return func(p *Policy) {
+		p.tarpit = &tarpit{min: minDelay, max: maxDelay, slots: make(chan struct{}, maxConcurrent)}
+	}
+}
+
+type tarpit struct {
+	min, max time.Duration
+	// slots holds a value for every request being delayed.
+	slots chan struct{}
+}
+
+// wait delays r, unless too many requests are already being delayed.
+func (t *tarpit) wait(r *http.Request) {
+	select {
+	case t.slots <- struct{}{}:
+		defer func() { <-t.slots }()
+	default:
+		return
+	}
+	d := t.min
+	if t.max > t.min {
+		d += rand.N(t.max - t.min + 1)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
+
+func (t *tarpit) String() string {
+	return fmt.Sprintf("%v-%v, %d concurrent", t.min, t.max, cap(t.slots))
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTarpit(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	p := ResourceIsolationPolicy(Tarpit(delay, delay, 1))
+	h := p.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(ctx context.Context, site string) time.Duration {
+		r := httptest.NewRequest("POST", "/", nil).WithContext(ctx)
+		r.Header.Set("Sec-Fetch-Site", site)
+		start := time.Now()
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		return time.Since(start)
+	}
+	if got := serve(context.Background(), "cross-site"); got < delay {
+		t.Errorf("rejected request: got %v, want at least %v", got, delay)
+	}
+	if got := serve(context.Background(), "same-origin"); got >= delay {
+		t.Errorf("allowed request was delayed by %v", got)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := serve(ctx, "cross-site"); got >= delay {
+		t.Errorf("canceled request was delayed by %v", got)
+	}
+
+	// While a request is being delayed, others are not.
+	p.tarpit.slots <- struct{}{}
+	if got := serve(context.Background(), "cross-site"); got >= delay {
+		t.Errorf("request over the concurrency cap was delayed by %v", got)
+	}
+	<-p.tarpit.slots
+}
+
+func TestTarpitInvalid(t *testing.T) {
+	var tests = []struct {
+		name     string
+		min, max time.Duration
+		n        int
+	}{
+		{name: "negative", min: -time.Second, max: time.Second, n: 1},
+		{name: "inverted", min: time.Second, max: time.Millisecond, n: 1},
+		{name: "no concurrency", min: 0, max: time.Second, n: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Tarpit(%v, %v, %d) didn't panic", tt.min, tt.max, tt.n)
+				}
+			}()
+			Tarpit(tt.min, tt.max, tt.n)
+		})
+	}
+}
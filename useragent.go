@@ -0,0 +1,101 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import "strings"
+
+// User-Agent families, indexes of uaFamilies.
+const (
+	uaNone = iota
+	uaHealthCheck
+	uaBot
+	uaCLI
+	uaLibrary
+	uaEdge
+	uaOpera
+	uaSamsung
+	uaFirefox
+	uaChrome
+	uaSafari
+	uaOther
+	numUAFamilies
+)
+
+// uaFamilies are the values returned by UserAgentFamily.
+var uaFamilies = [numUAFamilies]string{
+	uaNone:        "none",
+	uaHealthCheck: "health-check",
+	uaBot:         "bot",
+	uaCLI:         "cli",
+	uaLibrary:     "library",
+	uaEdge:        "edge",
+	uaOpera:       "opera",
+	uaSamsung:     "samsung",
+	uaFirefox:     "firefox",
+	uaChrome:      "chrome",
+	uaSafari:      "safari",
+	uaOther:       "other",
+}
+
+// uaTokens are the tokens that identify the User-Agent families, in the order they are looked
+// for: browsers based on Chromium also claim to be Chrome and Safari, and bots often claim to be
+// browsers.
+var uaTokens = []struct {
+	token  string
+	family int
+}{
+	{"bot", uaBot}, {"Bot", uaBot}, {"crawler", uaBot}, {"Crawler", uaBot},
+	{"spider", uaBot}, {"Spider", uaBot}, {"Slurp", uaBot},
+	{"curl/", uaCLI}, {"Wget/", uaCLI}, {"HTTPie/", uaCLI},
+	{"Go-http-client/", uaLibrary}, {"python-", uaLibrary}, {"Python-urllib/", uaLibrary},
+	{"aiohttp/", uaLibrary}, {"okhttp/", uaLibrary}, {"Java/", uaLibrary},
+	{"Apache-HttpClient/", uaLibrary}, {"axios/", uaLibrary}, {"node-fetch", uaLibrary},
+	{"Edg/", uaEdge}, {"EdgA/", uaEdge}, {"EdgiOS/", uaEdge},
+	{"OPR/", uaOpera}, {"OPiOS/", uaOpera},
+	{"SamsungBrowser/", uaSamsung},
+	{"Firefox/", uaFirefox}, {"FxiOS/", uaFirefox},
+	{"Chrome/", uaChrome}, {"CriOS/", uaChrome}, {"Chromium/", uaChrome},
+	{"Safari/", uaSafari},
+}
+
+// UserAgentFamily classifies the User-Agent header ua into a coarse family: "chrome", "edge",
+// "firefox", "opera", "safari" or "samsung" for browsers, "bot" for crawlers, "cli" for command
+// line clients like curl, "library" for HTTP libraries like Go's net/http, "health-check" for the
+// load balancer probes recognized by ExemptHealthChecks, "none" if ua is empty and "other"
+// otherwise.
+//
+// The classification is meant to break down traffic in reports, e.g. to find out which clients
+// don't send Fetch Metadata before enabling RejectMissingMetadata, and must not be relied upon
+// for security decisions, as the User-Agent header is chosen by clients.
+func UserAgentFamily(ua string) string {
+	return uaFamilies[classifyUserAgent(ua)]
+}
+
+func classifyUserAgent(ua string) int {
+	if ua == "" {
+		return uaNone
+	}
+	for _, p := range probeUserAgents {
+		if strings.HasPrefix(ua, p) {
+			return uaHealthCheck
+		}
+	}
+	for _, t := range uaTokens {
+		if strings.Contains(ua, t.token) {
+			return t.family
+		}
+	}
+	return uaOther
+}
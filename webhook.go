@@ -0,0 +1,88 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxWebhookBody is the largest webhook body read to verify its signature.
+const maxWebhookBody = 1 << 20
+
+// Webhook allows the POST requests whose path matches pattern if verify returns true, and
+// rejects them otherwise, regardless of their Fetch Metadata. It is meant for incoming webhooks,
+// which are legitimately cross-site and usually lack Fetch Metadata, but are signed by their
+// senders, so that exempting them doesn't make them unauthenticated:
+//
+//	secfetch.Webhook("/webhooks/github", secfetch.VerifyHMACSHA256("X-Hub-Signature-256", "sha256=", secret))
+//
+// verify is called with the request and its body, which is read up to 1MiB and then restored
+// for the handler. Larger bodies are rejected. verify must be safe for concurrent use.
+//
+// Webhooks are route rules, see AllowCrossSite for their evaluation order. Verified requests are
+// reported with RuleWebhook, the others with RuleWebhookSignature. Webhook panics if pattern is
+// malformed.
+func Webhook(pattern string, verify func(r *http.Request, body []byte) bool) Option {
+	return func(p *Policy) {
+		p.routes = append(p.routes, routeRule{
+			desc:   "webhook POST " + pattern,
+			method: "POST",
+			globs:  compileGlobs([]string{pattern}),
+			verify: verify,
+		})
+	}
+}
+
+// verifyWebhook reads the body of r, restores it, and returns whether verify accepts it.
+func verifyWebhook(r *http.Request, verify func(*http.Request, []byte) bool) bool {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxWebhookBody+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil || len(body) > maxWebhookBody {
+			return false
+		}
+	}
+	return verify(r, body)
+}
+
+// VerifyHMACSHA256 returns a verification function for Webhook that checks that the header of
+// the request holds prefix followed by the hex-encoded HMAC-SHA256 of the body, keyed with
+// secret, as sent e.g. by GitHub with the "X-Hub-Signature-256" header and the "sha256=" prefix.
+func VerifyHMACSHA256(header, prefix string, secret []byte) func(r *http.Request, body []byte) bool {
+	return func(r *http.Request, body []byte) bool {
+		sig, ok := strings.CutPrefix(r.Header.Get(header), prefix)
+		if !ok {
+			return false
+		}
+		got, err := hex.DecodeString(sig)
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		return hmac.Equal(got, mac.Sum(nil))
+	}
+}
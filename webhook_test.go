@@ -0,0 +1,82 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhook(t *testing.T) {
+	secret := []byte("s3cr3t")
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	const payload = `{"action":"opened"}`
+	var rule Rule
+	p := ResourceIsolationPolicy(
+		Webhook("/webhooks/github", VerifyHMACSHA256("X-Hub-Signature-256", "sha256=", secret)),
+		OnAllow(func(r *http.Request, d Decision) { rule = d.Rule }),
+		OnBlock(func(r *http.Request, d Decision, enforced bool) { rule = d.Rule }),
+	)
+	var tests = []struct {
+		name, method, path, site, body, sig string
+		want                                bool
+		wantRule                            Rule
+	}{
+		{name: "signed", method: "POST", path: "/webhooks/github", body: payload, sig: sign(payload), want: true, wantRule: RuleWebhook},
+		{name: "signed cross-site", method: "POST", path: "/webhooks/github", site: "cross-site", body: payload, sig: sign(payload), want: true, wantRule: RuleWebhook},
+		{name: "unsigned", method: "POST", path: "/webhooks/github", body: payload, wantRule: RuleWebhookSignature},
+		{name: "unsigned same-origin", method: "POST", path: "/webhooks/github", site: "same-origin", body: payload, wantRule: RuleWebhookSignature},
+		{name: "wrong signature", method: "POST", path: "/webhooks/github", body: payload, sig: sign("{}"), wantRule: RuleWebhookSignature},
+		{name: "malformed signature", method: "POST", path: "/webhooks/github", body: payload, sig: "sha256=zz", wantRule: RuleWebhookSignature},
+		{name: "missing prefix", method: "POST", path: "/webhooks/github", body: payload, sig: strings.TrimPrefix(sign(payload), "sha256="), wantRule: RuleWebhookSignature},
+		{name: "too large", method: "POST", path: "/webhooks/github", body: strings.Repeat("a", maxWebhookBody+1), sig: sign(strings.Repeat("a", maxWebhookBody+1)), wantRule: RuleWebhookSignature},
+		{name: "other method", method: "GET", path: "/webhooks/github", site: "cross-site", wantRule: RuleCrossSiteDest},
+		{name: "other path", method: "POST", path: "/webhooks/stripe", site: "cross-site", body: payload, sig: sign(payload), wantRule: RuleCrossSiteMethod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := p.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				got = string(b)
+			}))
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.site != "" {
+				r.Header.Set("sec-fetch-site", tt.site)
+			}
+			if tt.sig != "" {
+				r.Header.Set("X-Hub-Signature-256", tt.sig)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if (w.Code == http.StatusOK) != tt.want || rule != tt.wantRule {
+				t.Fatalf("got status %d by %q, want allowed %v by %q", w.Code, rule, tt.want, tt.wantRule)
+			}
+			if tt.want && got != tt.body {
+				t.Errorf("handler read body %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
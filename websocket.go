@@ -0,0 +1,107 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AllowWebSocketOrigins allows pages on the given origins, for example "https://app.example", to
+// open cross-site WebSocket connections to the protected handlers. Cross-site WebSocket upgrades
+// are otherwise rejected, as their destination is not a document.
+//
+// It also protects against Cross-Site WebSocket Hijacking from browsers that don't send Fetch
+// Metadata: upgrades from those browsers carrying an Origin header are only allowed if the Origin
+// is the one of the server or one of the given ones.
+//
+// WebSocket libraries check the Origin of upgrades themselves and reject cross-origin ones by
+// default, so they should be configured to accept the same origins, see
+// Policy.CheckWebSocketOrigin and Policy.WebSocketOriginPatterns.
+func AllowWebSocketOrigins(origins ...string) Option {
+	return func(p *Policy) {
+		if p.wsOrigins == nil {
+			p.wsOrigins = make(map[string]bool, len(origins))
+		}
+		for _, o := range origins {
+			p.wsOrigins[normalizeOrigin(o)] = true
+		}
+	}
+}
+
+// isWebSocket reports whether r is a WebSocket upgrade.
+func isWebSocket(r *http.Request, d *Decision) bool {
+	return d.Mode == "websocket" || r.Method == http.MethodGet && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// checkWebSocket applies AllowWebSocketOrigins to r. The returned bool reports whether the
+// option applies to r, in which case allowed holds the outcome.
+func (p *Policy) checkWebSocket(r *http.Request, d *Decision) (applies, allowed bool) {
+	if len(p.wsOrigins) == 0 || !isWebSocket(r, d) {
+		return false, false
+	}
+	switch d.Site {
+	case "":
+		if r.Header.Get("Origin") == "" {
+			return false, false
+		}
+		return true, p.CheckWebSocketOrigin(r)
+	}
+	if p.trustedSite(r, d.Site) {
+		return false, false
+	}
+	if p.allowedOrigin(r) {
+		// Leave requests from origins allowed by AllowOrigins to the regular checks.
+		return false, false
+	}
+	return true, p.wsOrigins[normalizeOrigin(r.Header.Get("Origin"))]
+}
+
+// CheckWebSocketOrigin reports whether the Origin of the WebSocket upgrade r is the one of the
+// server or one of the origins allowed by AllowWebSocketOrigins. Upgrades without an Origin
+// header, which are not sent by browsers, are accepted.
+//
+// It can be used as the CheckOrigin function of a gorilla/websocket Upgrader:
+//
+//	upgrader := websocket.Upgrader{CheckOrigin: p.CheckWebSocketOrigin}
+func (p *Policy) CheckWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if p.wsOrigins[normalizeOrigin(origin)] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// WebSocketOriginPatterns returns the hosts of the origins allowed by AllowWebSocketOrigins, to
+// be used as the OriginPatterns of coder/websocket (formerly nhooyr/websocket) AcceptOptions:
+//
+//	websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: p.WebSocketOriginPatterns()})
+//
+// Patterns only match hosts, so unlike CheckWebSocketOrigin they don't check the scheme of the
+// origins.
+func (p *Policy) WebSocketOriginPatterns() []string {
+	var patterns []string
+	for _, o := range keys(p.wsOrigins) {
+		if u, err := url.Parse(o); err == nil && u.Host != "" {
+			patterns = append(patterns, u.Host)
+		}
+	}
+	return patterns
+}
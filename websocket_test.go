@@ -0,0 +1,88 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secfetch
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAllowWebSocketOrigins(t *testing.T) {
+	p := ResourceIsolationPolicy(AllowWebSocketOrigins("https://app.example"), AllowOrigins("https://partner.example"))
+	var tests = []struct {
+		name   string
+		site   string
+		mode   string
+		origin string
+		want   Decision
+	}{
+		{name: "same-origin", site: "same-origin", mode: "websocket", origin: "https://example.com", want: Decision{Allowed: true, Rule: RuleTrustedSite}},
+		{name: "allowed origin", site: "cross-site", mode: "websocket", origin: "https://app.example", want: Decision{Allowed: true, Rule: RuleWebSocketOrigin}},
+		{name: "other origin", site: "cross-site", mode: "websocket", origin: "https://evil.example", want: Decision{Rule: RuleWebSocketOrigin}},
+		{name: "AllowOrigins", site: "cross-site", mode: "websocket", origin: "https://partner.example", want: Decision{Allowed: true, Rule: RuleAllowedOrigin}},
+		{name: "not an upgrade", site: "cross-site", mode: "cors", origin: "https://app.example", want: Decision{Rule: RuleCrossSiteDest}},
+		{name: "no metadata same origin", origin: "http://example.com", want: Decision{Allowed: true, Rule: RuleWebSocketOrigin}},
+		{name: "no metadata allowed origin", origin: "https://app.example", want: Decision{Allowed: true, Rule: RuleWebSocketOrigin}},
+		{name: "no metadata hijacking", origin: "https://evil.example", want: Decision{Rule: RuleWebSocketOrigin}},
+		{name: "no metadata no origin", want: Decision{Allowed: true, Rule: RuleMissingMetadata}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws", nil)
+			if tt.mode != "cors" {
+				// Pages cannot set the Upgrade header on other requests.
+				r.Header.Set("upgrade", "websocket")
+				r.Header.Set("connection", "Upgrade")
+			}
+			if tt.site != "" {
+				r.Header.Set("sec-fetch-site", tt.site)
+				r.Header.Set("sec-fetch-mode", tt.mode)
+				r.Header.Set("sec-fetch-dest", "websocket")
+			}
+			if tt.origin != "" {
+				r.Header.Set("origin", tt.origin)
+			}
+			got := p.Check(r)
+			if got.Allowed != tt.want.Allowed || got.Rule != tt.want.Rule {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckWebSocketOrigin(t *testing.T) {
+	p := ResourceIsolationPolicy(AllowWebSocketOrigins("https://app.example", "http://localhost:3000"))
+	var tests = []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "", want: true},
+		{origin: "http://example.com", want: true},
+		{origin: "https://app.example", want: true},
+		{origin: "https://evil.example", want: false},
+		{origin: "null", want: false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.Header.Set("origin", tt.origin)
+		if got := p.CheckWebSocketOrigin(r); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+	if got, want := p.WebSocketOriginPatterns(), []string{"localhost:3000", "app.example"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WebSocketOriginPatterns: got %v, want %v", got, want)
+	}
+}